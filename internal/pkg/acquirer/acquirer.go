@@ -9,7 +9,19 @@ import (
 
 type Acquirer interface {
 	acquire(dest string) error
+	// Returns an acquirer pinned to an exact version, e.g. by resolving
+	// version constraints
+	resolve() (Acquirer, error)
+	// Returns an immutable identifier (e.g. a commit SHA) for the version
+	// that would currently be acquired
+	revision() (string, error)
+	// Returns a copy of the acquirer that will acquire an exact revision
+	pin(revision string) Acquirer
+	// Returns the revision of a previously acquired source
+	cachedRevision(dest string) (string, error)
 	Id() (string, error)
+	// Returns the branch, tag or version constraint to acquire
+	Ref() string
 	Name() string
 	Path() string
 }
@@ -22,13 +34,17 @@ func acquirerFactory(name string, settings map[string]string) (Acquirer, error)
 	log.Debugf("Returning new %s acquirer", name)
 
 	if name == GIT {
-		if settings[URI] == "" || settings[BRANCH] == "" || settings[PATH] == "" {
+		if settings[URI] == "" || settings[PATH] == "" ||
+			(settings[BRANCH] == "" && settings[VERSION] == "") {
 			return nil, errors.New("Invalid git parameters. The uri, " +
-				"branch and path are all mandatory.")
+				"path and either a branch or version are all mandatory.")
 		}
 
-		return NewGitAcquirer(settings[NAME], settings[URI], settings[BRANCH],
-			settings[PATH]), nil
+		gitAcquirer := NewGitAcquirer(settings[NAME], settings[URI], settings[BRANCH],
+			settings[PATH])
+		gitAcquirer.version = settings[VERSION]
+
+		return gitAcquirer, nil
 	}
 
 	return nil, errors.New(fmt.Sprintf("Acquirer '%s' doesn't exist", name))
@@ -52,3 +68,24 @@ func NewAcquirer(settings map[string]string) (Acquirer, error) {
 func Acquire(a Acquirer, dest string) error {
 	return a.acquire(dest)
 }
+
+// Returns an acquirer pinned to an exact version, resolving any version
+// constraints
+func Resolve(a Acquirer) (Acquirer, error) {
+	return a.resolve()
+}
+
+// Returns an immutable identifier for the version an acquirer would acquire
+func Revision(a Acquirer) (string, error) {
+	return a.revision()
+}
+
+// Returns a copy of an acquirer that will acquire an exact revision
+func Pin(a Acquirer, revision string) Acquirer {
+	return a.pin(revision)
+}
+
+// Returns the revision of a source previously acquired into `dest`
+func CachedRevision(a Acquirer, dest string) (string, error) {
+	return a.cachedRevision(dest)
+}
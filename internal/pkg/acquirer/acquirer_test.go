@@ -39,6 +39,19 @@ func TestNewGitAcquirerFull(t *testing.T) {
 		"Fully-defined git acquirer incorrectly created")
 }
 
+func TestNewGitAcquirerVersion(t *testing.T) {
+	actual, err := acquirerFactory(GIT, map[string]string{
+		"uri":     "git@github.com:sugarkube/kapps.git",
+		"version": "tiller-~0.1",
+		"path":    "incubator/tiller/",
+	})
+	assert.Nil(t, err)
+
+	id, err := actual.Id()
+	assert.Nil(t, err)
+	assert.Equal(t, "sugarkube-kapps-tiller-tilde0.1-tiller", id)
+}
+
 func TestNewAcquirerGit(t *testing.T) {
 	actual, err := NewAcquirer(defaultSettings)
 	assert.Nil(t, err)
@@ -16,6 +16,14 @@ type GitAcquirer struct {
 	uri    string
 	branch string
 	path   string
+	// optional version constraint, e.g. `wordpress-~0.1`, used to select
+	// a tag if no branch is given
+	version string
+	// optional commit to check out instead of the branch, e.g. from a lockfile
+	commit string
+	// the tag a version constraint resolved to. Not part of the ID so sources
+	// are cached at the same path whether or not they've been resolved.
+	tag string
 }
 
 // todo - make configurable
@@ -25,6 +33,7 @@ const NAME = "name"
 const URI = "uri"
 const BRANCH = "branch"
 const PATH = "path"
+const VERSION = "version"
 
 // Returns an instance. This allows us to build objects for testing instead of
 // directly instantiating objects in the acquirer factory.
@@ -41,7 +50,25 @@ func NewGitAcquirer(name string, uri string, branch string, path string) GitAcqu
 	}
 }
 
-// Generate an ID
+// Replaces the operators in version constraints so IDs can be used as
+// directory names, e.g. `wordpress-~0.1` becomes `wordpress-tilde0.1`
+var constraintReplacer = strings.NewReplacer(
+	"~", "tilde",
+	"^", "caret",
+	">=", "gte",
+	"<=", "lte",
+	">", "gt",
+	"<", "lt",
+	"=", "eq",
+	"*", "x",
+	" ", "",
+	",", "_",
+	"/", "-",
+)
+
+// Generate an ID. It's derived from the declared branch or version constraint
+// rather than what it resolves to, so it's the same before and after
+// resolving.
 func (a GitAcquirer) Id() (string, error) {
 	// testing here simplifies testing but does mean invalid objects can be created...
 	if strings.Count(a.uri, ":") != 1 {
@@ -53,12 +80,130 @@ func (a GitAcquirer) Id() (string, error) {
 	orgRepo := strings.SplitAfter(a.uri, ":")
 	hyphenatedOrg := strings.Replace(orgRepo[1], "/", "-", -1)
 	hyphenatedOrg = strings.TrimSuffix(hyphenatedOrg, ".git")
-	hyphenatedBranc := strings.Replace(a.branch, "/", "-", -1)
+	hyphenatedBranc := constraintReplacer.Replace(a.Ref())
 	hyphenatedName := strings.Replace(a.name, "/", "-", -1)
 
 	return strings.Join([]string{hyphenatedOrg, hyphenatedBranc, hyphenatedName}, "-"), nil
 }
 
+// Returns the branch if set, otherwise the version constraint
+func (a GitAcquirer) Ref() string {
+	if a.branch != "" {
+		return a.branch
+	}
+	return a.version
+}
+
+// Returns a copy of the acquirer that checks out the newest tag on the remote
+// matching any version constraint. Acquirers with a branch that isn't a
+// constraint are returned unchanged. Its ID isn't changed.
+func (a GitAcquirer) resolve() (Acquirer, error) {
+	if a.commit != "" {
+		return a, nil
+	}
+
+	branch, err := a.resolvedBranch()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	resolved := a
+	if branch != a.Ref() {
+		resolved.tag = branch
+	}
+	return resolved, nil
+}
+
+// Returns the branch, or the newest tag matching the version constraint
+func (a GitAcquirer) resolvedBranch() (string, error) {
+	if a.tag != "" {
+		return a.tag, nil
+	}
+
+	constraint := a.Ref()
+
+	if _, _, ok := SplitRefConstraint(constraint); !ok {
+		return constraint, nil
+	}
+
+	tag, err := LatestMatchingTag(a.uri, constraint)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	log.Infof("Resolved version constraint '%s' for %s to tag '%s'",
+		constraint, a.uri, tag)
+
+	return tag, nil
+}
+
+// Returns the SHA of the commit the branch or tag currently points to on the
+// remote
+func (a GitAcquirer) revision() (string, error) {
+	if a.commit != "" {
+		return a.commit, nil
+	}
+
+	ref, err := a.resolvedBranch()
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	var stdoutBuf, stderrBuf bytes.Buffer
+
+	lsRemoteCmd := exec.Command(GIT_PATH, "ls-remote", a.uri, ref, ref+"^{}")
+	lsRemoteCmd.Stdout = &stdoutBuf
+	lsRemoteCmd.Stderr = &stderrBuf
+	err = lsRemoteCmd.Run()
+	if err != nil {
+		return "", errors.Wrapf(err, "Error running: %s. Stderr=%s",
+			strings.Join(lsRemoteCmd.Args, " "), stderrBuf.String())
+	}
+
+	sha := ""
+	for _, line := range strings.Split(stdoutBuf.String(), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+
+		// prefer the commit an annotated tag points to over the tag object
+		if strings.HasSuffix(fields[1], "^{}") || sha == "" {
+			sha = fields[0]
+		}
+	}
+
+	if sha == "" {
+		return "", errors.New(fmt.Sprintf("Ref '%s' not found in %s", ref, a.uri))
+	}
+
+	return sha, nil
+}
+
+// Returns a copy of the acquirer that checks out an exact commit
+func (a GitAcquirer) pin(revision string) Acquirer {
+	pinned := a
+	pinned.commit = revision
+	return pinned
+}
+
+// Returns the SHA of the commit checked out in a previously acquired source
+func (a GitAcquirer) cachedRevision(dest string) (string, error) {
+	var stdoutBuf, stderrBuf bytes.Buffer
+
+	revParseCmd := exec.Command(GIT_PATH, "rev-parse", "HEAD")
+	revParseCmd.Dir = dest
+	revParseCmd.Stdout = &stdoutBuf
+	revParseCmd.Stderr = &stderrBuf
+	err := revParseCmd.Run()
+	if err != nil {
+		return "", errors.Wrapf(err, "Error running: %s in %s. Stderr=%s",
+			strings.Join(revParseCmd.Args, " "), dest, stderrBuf.String())
+	}
+
+	return strings.TrimSpace(stdoutBuf.String()), nil
+}
+
 // return the name
 func (a GitAcquirer) Name() string {
 	return a.name
@@ -134,7 +279,15 @@ func (a GitAcquirer) acquire(dest string) error {
 
 	stderrBuf.Reset()
 
-	checkoutCmd := exec.Command(GIT_PATH, "checkout", a.branch)
+	// sources may only declare an exact version
+	ref := a.Ref()
+	if a.commit != "" {
+		ref = a.commit
+	} else if a.tag != "" {
+		ref = a.tag
+	}
+
+	checkoutCmd := exec.Command(GIT_PATH, "checkout", ref)
 	checkoutCmd.Dir = dest
 	checkoutCmd.Stderr = &stderrBuf
 	err = checkoutCmd.Run()
@@ -1,7 +1,12 @@
 package acquirer
 
 import (
+	"fmt"
 	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
 	"testing"
 )
 
@@ -43,6 +48,16 @@ func TestId(t *testing.T) {
 				"examples/values/wordpress/site1/"),
 			expectValues: "sugarkube-sugarkube-master-site1-values",
 		},
+		{
+			name: "good_constraint",
+			desc: "check version constraints are made safe to use as directory names",
+			input: NewGitAcquirer(
+				"",
+				"git@github.com:helm/charts.git",
+				"wordpress->=0.1, <1.0",
+				"stable/wordpress"),
+			expectValues: "helm-charts-wordpress-gte0.1_lt1.0-wordpress",
+		},
 		{
 			name: "error_invalid_uri",
 			desc: "check invalid git URIs cause errors",
@@ -67,3 +82,77 @@ func TestId(t *testing.T) {
 		}
 	}
 }
+
+// Creates a git repo with a commit of `chart/` for each tag
+func testRepo(t *testing.T, dir string, tags ...string) {
+	git := func(args ...string) {
+		cmd := exec.Command("git", append([]string{"-c", "user.name=test",
+			"-c", "user.email=test@example.com"}, args...)...)
+		cmd.Dir = dir
+		output, err := cmd.CombinedOutput()
+		assert.Nil(t, err, string(output))
+	}
+
+	git("init", "-q")
+	for _, tag := range tags {
+		err := os.MkdirAll(filepath.Join(dir, "chart"), 0755)
+		assert.Nil(t, err)
+		err = ioutil.WriteFile(filepath.Join(dir, "chart", "version"), []byte(tag), 0644)
+		assert.Nil(t, err)
+
+		git("add", "-A")
+		git("commit", "-q", "-m", tag)
+		git("tag", tag)
+	}
+}
+
+func TestAcquireVersion(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "sugarkube-git-")
+	assert.Nil(t, err)
+	defer os.RemoveAll(tempDir)
+
+	repoDir := filepath.Join(tempDir, "repo.git")
+	err = os.MkdirAll(repoDir, 0755)
+	assert.Nil(t, err)
+	testRepo(t, repoDir, "wordpress-0.1.0", "wordpress-0.1.1", "wordpress-0.2.0")
+
+	tests := []struct {
+		name     string
+		desc     string
+		version  string
+		expected string
+	}{
+		{
+			name:     "exact",
+			desc:     "sources with only an exact version should check out its tag",
+			version:  "wordpress-0.1.0",
+			expected: "wordpress-0.1.0",
+		},
+		{
+			name:     "constraint",
+			desc:     "sources with a version constraint should check out the newest matching tag",
+			version:  "wordpress-~0.1",
+			expected: "wordpress-0.1.1",
+		},
+	}
+
+	for _, test := range tests {
+		acquirerImpl, err := NewAcquirer(map[string]string{
+			URI:     fmt.Sprintf("file://%s", repoDir),
+			PATH:    "chart",
+			VERSION: test.version,
+		})
+		assert.Nil(t, err, test.desc)
+
+		resolved, err := Resolve(acquirerImpl)
+		assert.Nil(t, err, test.desc)
+
+		dest := filepath.Join(tempDir, test.name)
+		err = Acquire(resolved, dest)
+		assert.Nil(t, err, test.desc)
+
+		version, err := ioutil.ReadFile(filepath.Join(dest, "chart", "version"))
+		assert.Nil(t, err, test.desc)
+		assert.Equal(t, test.expected, string(version), test.desc)
+	}
+}
@@ -0,0 +1,118 @@
+package acquirer
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/sugarkube/sugarkube/internal/pkg/log"
+	"github.com/sugarkube/sugarkube/internal/pkg/semver"
+	"os/exec"
+	"regexp"
+	"strings"
+)
+
+// Kapp releases are tagged as `<prefix><version>`, e.g. `wordpress-0.1.0`, so
+// constraints are written the same way, e.g. `wordpress-~0.1`.
+var wildcardRefRegex = regexp.MustCompile(`^(.*?)(v?\d+(\.\d+)*\.[xX*])$`)
+
+// Splits a ref like `wordpress-~0.1` into the tag prefix (`wordpress-`) and
+// the version constraint (`~0.1`). Returns false if the ref doesn't contain a
+// constraint.
+func SplitRefConstraint(ref string) (string, string, bool) {
+	if i := strings.IndexAny(ref, "~^<>="); i >= 0 {
+		return ref[:i], ref[i:], true
+	}
+
+	if matches := wildcardRefRegex.FindStringSubmatch(ref); matches != nil {
+		return matches[1], matches[2], true
+	}
+
+	return "", "", false
+}
+
+// Returns the tag with the highest version that satisfies a ref constraint
+// like `wordpress-~0.1`. Tags with a different prefix are ignored.
+func MatchTag(ref string, tags []string) (string, error) {
+	prefix, rawConstraint, ok := SplitRefConstraint(ref)
+	if !ok {
+		return "", errors.New(fmt.Sprintf("'%s' doesn't contain a version constraint", ref))
+	}
+
+	constraint, err := semver.ParseConstraint(rawConstraint)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	bestTag := ""
+	var bestVersion semver.Version
+
+	for _, tag := range tags {
+		if !strings.HasPrefix(tag, prefix) {
+			continue
+		}
+
+		version, err := semver.Parse(strings.TrimPrefix(tag, prefix))
+		if err != nil {
+			continue
+		}
+
+		if !constraint.Check(version) {
+			continue
+		}
+
+		if bestTag == "" || version.Compare(bestVersion) > 0 {
+			bestTag = tag
+			bestVersion = version
+		}
+	}
+
+	if bestTag == "" {
+		return "", errors.New(fmt.Sprintf("No tags match the version "+
+			"constraint '%s'", ref))
+	}
+
+	return bestTag, nil
+}
+
+// Lists the tags of a remote git repo and returns the newest one that
+// satisfies a ref constraint
+func LatestMatchingTag(uri string, ref string) (string, error) {
+	tags, err := listRemoteTags(uri)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	tag, err := MatchTag(ref, tags)
+	if err != nil {
+		return "", errors.Wrapf(err, "Error resolving tags for %s", uri)
+	}
+
+	return tag, nil
+}
+
+// Returns the names of all tags in a remote git repo
+func listRemoteTags(uri string) ([]string, error) {
+	var stdoutBuf, stderrBuf bytes.Buffer
+
+	lsRemoteCmd := exec.Command(GIT_PATH, "ls-remote", "--tags", "--refs", uri)
+	lsRemoteCmd.Stdout = &stdoutBuf
+	lsRemoteCmd.Stderr = &stderrBuf
+	err := lsRemoteCmd.Run()
+	if err != nil {
+		return nil, errors.Wrapf(err, "Error running: %s. Stderr=%s",
+			strings.Join(lsRemoteCmd.Args, " "), stderrBuf.String())
+	}
+
+	tags := make([]string, 0)
+	for _, line := range strings.Split(stdoutBuf.String(), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		tags = append(tags, strings.TrimPrefix(fields[1], "refs/tags/"))
+	}
+
+	log.Debugf("Found %d tags in %s", len(tags), uri)
+
+	return tags, nil
+}
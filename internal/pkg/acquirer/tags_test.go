@@ -0,0 +1,84 @@
+package acquirer
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+var testTags = []string{
+	"wordpress-0.1.0",
+	"wordpress-0.1.3",
+	"wordpress-0.2.0",
+	"wordpress-0.2.1-rc1",
+	"wordpress-sites-0.9.0",
+	"nginx-ingress-0.1.5",
+}
+
+func TestSplitRefConstraint(t *testing.T) {
+	prefix, constraint, ok := SplitRefConstraint("wordpress-~0.1")
+	assert.True(t, ok)
+	assert.Equal(t, "wordpress-", prefix)
+	assert.Equal(t, "~0.1", constraint)
+
+	prefix, constraint, ok = SplitRefConstraint("nginx-ingress-0.1.x")
+	assert.True(t, ok)
+	assert.Equal(t, "nginx-ingress-", prefix)
+	assert.Equal(t, "0.1.x", constraint)
+
+	_, _, ok = SplitRefConstraint("wordpress-0.1.0")
+	assert.False(t, ok)
+
+	_, _, ok = SplitRefConstraint("master")
+	assert.False(t, ok)
+}
+
+func TestMatchTag(t *testing.T) {
+	tests := []struct {
+		name          string
+		desc          string
+		input         string
+		expectValue   string
+		expectedError bool
+	}{
+		{
+			name:        "good_tilde",
+			desc:        "check the newest patch version is selected",
+			input:       "wordpress-~0.1",
+			expectValue: "wordpress-0.1.3",
+		},
+		{
+			name:        "good_skip_prerelease_and_other_prefixes",
+			desc:        "check prereleases and tags with longer prefixes are ignored",
+			input:       "wordpress->=0.1",
+			expectValue: "wordpress-0.2.0",
+		},
+		{
+			name:        "good_wildcard",
+			desc:        "check wildcard constraints work",
+			input:       "nginx-ingress-0.1.x",
+			expectValue: "nginx-ingress-0.1.5",
+		},
+		{
+			name:          "error_no_match",
+			desc:          "check an error is returned if nothing matches",
+			input:         "wordpress-^1.0",
+			expectedError: true,
+		},
+		{
+			name:          "error_not_constraint",
+			desc:          "check an error is returned for refs without constraints",
+			input:         "master",
+			expectedError: true,
+		},
+	}
+
+	for _, test := range tests {
+		result, err := MatchTag(test.input, testTags)
+		if test.expectedError {
+			assert.NotNil(t, err, "expected an error for %s", test.name)
+		} else {
+			assert.Nil(t, err, "unexpected error for %s", test.name)
+			assert.Equal(t, test.expectValue, result, "unexpected tag for %s", test.name)
+		}
+	}
+}
@@ -7,7 +7,7 @@ import (
 	"github.com/sugarkube/sugarkube/internal/pkg/log"
 	"os"
 	"path/filepath"
-	"strings"
+	"sync"
 )
 
 const CACHE_DIR = ".sugarkube"
@@ -28,6 +28,39 @@ func getKappCachePath(kappRootPath string) string {
 	return filepath.Join(kappRootPath, CACHE_DIR)
 }
 
+// Returns the path a source is acquired into for a kapp. Sources a kapp
+// inherits from a template are shared by all instances of the template so are
+// acquired into the manifest's cache dir.
+func GetSourceCachePath(manifestCacheDir string, kappObj kapp.Kapp,
+	sourceName string, acquirerId string) string {
+	if kappObj.SharesSource(sourceName) {
+		return filepath.Join(manifestCacheDir, CACHE_DIR, acquirerId)
+	}
+
+	return filepath.Join(getKappCachePath(GetKappRootPath(manifestCacheDir, kappObj)),
+		acquirerId)
+}
+
+// Records which shared sources have been acquired so they're only acquired once
+type sharedSources struct {
+	mutex    sync.Mutex
+	acquired map[string]bool
+}
+
+// Returns true if the source at the given path should be acquired, marking it
+// as acquired
+func (s *sharedSources) claim(sourceDest string) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.acquired[sourceDest] {
+		return false
+	}
+
+	s.acquired[sourceDest] = true
+	return true
+}
+
 // Build a cache for a manifest into a directory
 func CacheManifest(manifest kapp.Manifest, cacheDir string, dryRun bool) error {
 
@@ -40,6 +73,10 @@ func CacheManifest(manifest kapp.Manifest, cacheDir string, dryRun bool) error {
 		return errors.WithStack(err)
 	}
 
+	shared := &sharedSources{
+		acquired: map[string]bool{},
+	}
+
 	// acquire each kapp and cache it
 	for _, kappObj := range manifest.Kapps {
 		// build a directory path for the kapp in the manifest cache directory
@@ -53,7 +90,7 @@ func CacheManifest(manifest kapp.Manifest, cacheDir string, dryRun bool) error {
 			return errors.WithStack(err)
 		}
 
-		err = acquireSource(manifest, kappObj.Sources, kappRootPath, kappCacheDir, dryRun)
+		err = acquireSource(manifest, kappObj, manifestCacheDir, shared, dryRun)
 		if err != nil {
 			return errors.WithStack(err)
 		}
@@ -62,26 +99,74 @@ func CacheManifest(manifest kapp.Manifest, cacheDir string, dryRun bool) error {
 	return nil
 }
 
+// Caches a single kapp for a manifest into a directory, replacing anything
+// already cached for it there. This lets kapps be cached with their sources
+// pinned to other revisions, e.g. to roll them back. Sources it shares with
+// other instances of its template are acquired into its own cache dir instead
+// so the other instances aren't affected.
+func CacheKapp(manifest kapp.Manifest, kappObj kapp.Kapp, cacheDir string, dryRun bool) error {
+	manifestCacheDir := GetManifestCachePath(cacheDir, manifest)
+	kappRootPath := GetKappRootPath(manifestCacheDir, kappObj)
+
+	kappObj = kappObj.WithoutSharedSources()
+
+	if !dryRun {
+		log.Debugf("Removing previously cached kapp from: %s", kappRootPath)
+		err := os.RemoveAll(kappRootPath)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		err = os.MkdirAll(getKappCachePath(kappRootPath), 0755)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	shared := &sharedSources{
+		acquired: map[string]bool{},
+	}
+
+	return acquireSource(manifest, kappObj, manifestCacheDir, shared, dryRun)
+}
+
 // Acquires each source and symlinks it to the target path in the cache directory.
 // Runs all acquirers in parallel.
-func acquireSource(manifest kapp.Manifest, acquirers []acquirer.Acquirer, rootDir string,
-	cacheDir string, dryRun bool) error {
+func acquireSource(manifest kapp.Manifest, kappObj kapp.Kapp, manifestCacheDir string,
+	shared *sharedSources, dryRun bool) error {
 	doneCh := make(chan bool)
 	errCh := make(chan error)
 
+	acquirers := kappObj.Sources
+	rootDir := GetKappRootPath(manifestCacheDir, kappObj)
+
 	log.Debugf("Acquiring sources for manifest: %s", manifest.Id)
 
 	for _, acquirerImpl := range acquirers {
 		go func(a acquirer.Acquirer) {
+			if dryRun {
+				log.Debugf("Dry run: Not resolving version constraints for source: %s", a.Name())
+			} else {
+				resolved, err := acquirer.Resolve(a)
+				if err != nil {
+					errCh <- errors.Wrap(err, "Error resolving source version")
+					return
+				}
+				a = resolved
+			}
+
 			acquirerId, err := a.Id()
 			if err != nil {
 				errCh <- errors.Wrap(err, "Invalid acquirer ID")
 			}
 
-			sourceDest := filepath.Join(cacheDir, acquirerId)
+			sourceDest := GetSourceCachePath(manifestCacheDir, kappObj, a.Name(),
+				acquirerId)
 
 			if dryRun {
 				log.Debugf("Dry run: Would acquire source into: %s", sourceDest)
+			} else if kappObj.SharesSource(a.Name()) && !shared.claim(sourceDest) {
+				log.Debugf("Shared source already acquired into: %s", sourceDest)
 			} else {
 				err := acquirer.Acquire(a, sourceDest)
 				if err != nil {
@@ -89,11 +174,11 @@ func acquireSource(manifest kapp.Manifest, acquirers []acquirer.Acquirer, rootDi
 				}
 			}
 
-			// todo - this doesn't actually create relative symlinks. Probably need
-			// need to use exec.Command and set `command.Dir`, using `ln` directly.
-			sourcePath := filepath.Join(sourceDest, a.Path())
-			sourcePath = strings.TrimPrefix(sourcePath, rootDir)
-			sourcePath = strings.TrimPrefix(sourcePath, "/")
+			// symlinks are relative to the kapp root dir so caches can be moved
+			sourcePath, err := filepath.Rel(rootDir, filepath.Join(sourceDest, a.Path()))
+			if err != nil {
+				errCh <- errors.WithStack(err)
+			}
 
 			symLinkTarget := filepath.Join(rootDir, a.Name())
 
@@ -0,0 +1,113 @@
+package cacher
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/sugarkube/sugarkube/internal/pkg/acquirer"
+	"github.com/sugarkube/sugarkube/internal/pkg/kapp"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Creates a git repo with a commit of `chart/` for each tag and returns the
+// SHAs of the commits
+func testRepo(t *testing.T, dir string, tags ...string) []string {
+	git := func(args ...string) string {
+		cmd := exec.Command("git", append([]string{"-c", "user.name=test",
+			"-c", "user.email=test@example.com"}, args...)...)
+		cmd.Dir = dir
+		output, err := cmd.CombinedOutput()
+		assert.Nil(t, err, string(output))
+		return strings.TrimSpace(string(output))
+	}
+
+	git("init", "-q")
+
+	shas := make([]string, 0)
+	for _, tag := range tags {
+		err := os.MkdirAll(filepath.Join(dir, "chart"), 0755)
+		assert.Nil(t, err)
+		err = ioutil.WriteFile(filepath.Join(dir, "chart", "version"), []byte(tag), 0644)
+		assert.Nil(t, err)
+
+		git("add", "-A")
+		git("commit", "-q", "-m", tag)
+		git("tag", tag)
+		shas = append(shas, git("rev-parse", "HEAD"))
+	}
+
+	return shas
+}
+
+func TestCacheKappSharedSources(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "sugarkube-cacher-")
+	assert.Nil(t, err)
+	defer os.RemoveAll(tempDir)
+
+	repoDir := filepath.Join(tempDir, "repo.git")
+	err = os.MkdirAll(repoDir, 0755)
+	assert.Nil(t, err)
+	shas := testRepo(t, repoDir, "site-0.1.0", "site-0.2.0")
+
+	manifestPath := filepath.Join(tempDir, "sites.yaml")
+	err = ioutil.WriteFile(manifestPath, []byte(fmt.Sprintf(`
+templates:
+  site:
+    sources:
+    - uri: file://%s
+      branch: site-0.2.0
+      path: chart
+      name: chart
+
+present:
+  site1:
+    template: site
+  site2:
+    template: site
+`, repoDir)), 0644)
+	assert.Nil(t, err)
+
+	manifest, err := kapp.ParseManifestFile(manifestPath)
+	assert.Nil(t, err)
+
+	cacheDir := filepath.Join(tempDir, "cache")
+	err = CacheManifest(*manifest, cacheDir, false)
+	assert.Nil(t, err)
+
+	// returns the version of the chart a kapp's source symlink points to
+	cachedVersion := func(kappId string) string {
+		data, err := ioutil.ReadFile(filepath.Join(cacheDir, manifest.Id, kappId,
+			"chart", "version"))
+		assert.Nil(t, err)
+		return string(data)
+	}
+
+	assert.Equal(t, "site-0.2.0", cachedVersion("site1"))
+	assert.Equal(t, "site-0.2.0", cachedVersion("site2"))
+
+	// roll back one instance in the same cache dir
+	site1 := manifest.Kapps[0]
+	assert.Equal(t, "site1", site1.Id)
+	assert.True(t, site1.SharesSource("chart"))
+	site1.Sources = []acquirer.Acquirer{acquirer.Pin(site1.Sources[0], shas[0])}
+
+	err = CacheKapp(*manifest, site1, cacheDir, false)
+	assert.Nil(t, err)
+
+	assert.Equal(t, "site-0.1.0", cachedVersion("site1"),
+		"the rolled back instance should use the pinned revision")
+	assert.Equal(t, "site-0.2.0", cachedVersion("site2"),
+		"other instances of the template shouldn't be affected")
+
+	id, err := manifest.Kapps[1].Sources[0].Id()
+	assert.Nil(t, err)
+	revision, err := acquirer.CachedRevision(manifest.Kapps[1].Sources[0],
+		GetSourceCachePath(GetManifestCachePath(cacheDir, *manifest), manifest.Kapps[1],
+			"chart", id))
+	assert.Nil(t, err)
+	assert.Equal(t, shas[1], revision, "the shared source should be left alone")
+}
@@ -9,18 +9,23 @@ import (
 	"github.com/sugarkube/sugarkube/internal/pkg/cmd"
 	"github.com/sugarkube/sugarkube/internal/pkg/cmd/cli/cluster"
 	"github.com/sugarkube/sugarkube/internal/pkg/kapp"
+	"github.com/sugarkube/sugarkube/internal/pkg/locker"
 	"github.com/sugarkube/sugarkube/internal/pkg/log"
+	"github.com/sugarkube/sugarkube/internal/pkg/provider"
 	"io"
 	"io/ioutil"
 )
 
 type createCmd struct {
-	out       io.Writer
-	dryRun    bool
-	stackName string
-	stackFile string
-	manifests cmd.Files
-	cacheDir  string
+	out           io.Writer
+	dryRun        bool
+	frozen        bool
+	stackName     string
+	stackFile     string
+	manifests     cmd.Files
+	cacheDir      string
+	selector      kapp.Selector
+	manifestRange kapp.ManifestRange
 }
 
 func newCreateCmd(out io.Writer) *cobra.Command {
@@ -37,10 +42,23 @@ func newCreateCmd(out io.Writer) *cobra.Command {
 
 	f := cmd.Flags()
 	f.BoolVar(&c.dryRun, "dry-run", false, "show what would happen but don't create a cluster")
+	f.BoolVar(&c.frozen, "frozen", false, "fail if the manifests and the stack's lockfile disagree")
 	f.StringVarP(&c.stackName, "stack-name", "n", "", "name of a stack to launch (required when passing --stack-config)")
 	f.StringVarP(&c.stackFile, "stack-config", "s", "", "path to file defining stacks by name")
 	f.StringVarP(&c.cacheDir, "dir", "d", "", "Directory to build the cache in. A temp directory will be generated if not supplied.")
 	f.VarP(&c.manifests, "manifest", "m", "YAML manifest file to load (can specify multiple)")
+	f.StringVar(&c.manifestRange.From, "from-manifest", "", "ID of the first manifest to cache. Earlier "+
+		"manifests are left out")
+	f.StringVar(&c.manifestRange.To, "to-manifest", "", "ID of the last manifest to cache. Later "+
+		"manifests are left out")
+	f.StringArrayVar(&c.manifestRange.Only, "only-manifest", []string{}, "ID of a manifest to cache, "+
+		"leaving out the others. Can't be used with --from-manifest or --to-manifest (can specify multiple)")
+	f.StringArrayVar(&c.selector.Include, "include", []string{}, "only cache kapps matching a selector, e.g. "+
+		"'manifest:kapp-id', 'web:word*' or 'label=db' (can specify multiple)")
+	f.StringArrayVar(&c.selector.Exclude, "exclude", []string{}, "don't cache kapps matching a selector "+
+		"(can specify multiple)")
+	f.BoolVar(&c.selector.WithDependencies, "with-dependencies", false, "also cache the kapps selected "+
+		"kapps depend on")
 
 	return cmd
 }
@@ -72,11 +90,27 @@ func (c *createCmd) run(cmd *cobra.Command, args []string) error {
 
 	log.Debugf("Loaded %d manifest(s)", len(stackConfig.Manifests))
 
-	for _, manifest := range stackConfig.Manifests {
-		err = kapp.ValidateManifest(&manifest)
-		if err != nil {
-			return errors.WithStack(err)
-		}
+	// overlays also apply to manifests given on the CLI
+	err = provider.ApplyManifestOverlays(stackConfig)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	_, err = locker.ApplyToStack(stackConfig, c.frozen)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	// lockfiles cover all the stack's manifests so they can only be sliced
+	// once it's been applied
+	err = stackConfig.SetManifestRange(c.manifestRange)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	err = stackConfig.SetSelector(c.selector)
+	if err != nil {
+		return errors.WithStack(err)
 	}
 
 	cacheDir := c.cacheDir
@@ -91,7 +125,8 @@ func (c *createCmd) run(cmd *cobra.Command, args []string) error {
 	log.Debugf("Kapps validated. Caching manifests into %s...", cacheDir)
 
 	for _, manifest := range stackConfig.Manifests {
-		err := cacher.CacheManifest(manifest, cacheDir, c.dryRun)
+		// unselected kapps aren't cached
+		err := cacher.CacheManifest(stackConfig.FilterSelected(manifest), cacheDir, c.dryRun)
 		if err != nil {
 			return errors.WithStack(err)
 		}
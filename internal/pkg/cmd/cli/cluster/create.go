@@ -92,6 +92,8 @@ func (c *createCmd) run(cmd *cobra.Command, args []string) error {
 		Provisioner:   c.provisioner,
 		Profile:       c.profile,
 		Cluster:       c.cluster,
+		Account:       c.account,
+		Region:        c.region,
 		VarsFilesDirs: c.varsFilesDirs,
 		Manifests:     cliManifests,
 		ReadyTimeout:  c.readyTimeout,
@@ -155,6 +157,11 @@ func ParseStackCliArgs(stackName string, stackFile string) (*kapp.StackConfig, e
 			if err != nil {
 				return nil, errors.WithStack(err)
 			}
+
+			err = provider.ApplyManifestOverlays(stackConfig)
+			if err != nil {
+				return nil, errors.WithStack(err)
+			}
 		}
 	}
 
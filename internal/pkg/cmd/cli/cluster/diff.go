@@ -2,13 +2,23 @@ package cluster
 
 import (
 	"fmt"
+	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
+	"github.com/sugarkube/sugarkube/internal/pkg/kapp"
+	"github.com/sugarkube/sugarkube/internal/pkg/plan"
+	"gopkg.in/yaml.v2"
 	"io"
+	"io/ioutil"
 )
 
 type diffCmd struct {
-	out      io.Writer
-	extended bool
+	out       io.Writer
+	extended  bool
+	stackName string
+	stackFile string
+	cacheDir  string
+	outPath   string
+	selector  kapp.Selector
 }
 
 // Diff may not be the best term, since the output isn't only a diff but also
@@ -22,7 +32,7 @@ func newDiffCmd(out io.Writer) *cobra.Command {
 	}
 
 	cmd := &cobra.Command{
-		Use:   "diff [flags]",
+		Use:   "diff [cache-dir] [flags]",
 		Short: fmt.Sprintf("Diff the state of a cluster with manifests"),
 		Long: `Discovers the differences between the actual kapps installed on a cluster compared 
 to the kapps that should be present/absent according to the manifests.
@@ -30,24 +40,85 @@ to the kapps that should be present/absent according to the manifests.
 This command checks the current state of a cluster by consulting the configured 
 Source-of-Truth. It compares that against the list of kapps specified in the 
 manifests to be present or absent and then calculates which kapps should be 
-installed and destroyed.
+installed, upgraded and destroyed, and which are already as they should be. The
+diff is printed as YAML and can be passed to 'kapps install --diff-path'.
+
+Versions of installed kapps are compared with the refs of their main sources, 
+so kapps should be tagged like their charts are versioned, e.g. 
+'wordpress-0.1.0'. Kapps whose sources are branches are always upgraded.
 
 When run with '--extended' this command will also include the contents of each
 kapp's 'sugarkube.yaml' file (if it exists). This can be used to inform e.g.
-a CI/CD system about the secrets that a kapp needs during installation.
+a CI/CD system about the secrets that a kapp needs during installation. The 
+files are read from the cache dir, so it must be given.
 `,
 		RunE: c.run,
 	}
 
 	f := cmd.Flags()
 	f.BoolVar(&c.extended, "extended", false, "include each kapp's 'sugarkube.yaml' file in output")
+	f.StringVarP(&c.stackName, "stack-name", "n", "", "name of the stack to diff")
+	f.StringVarP(&c.stackFile, "stack-config", "s", "", "path to file defining stacks by name")
+	f.StringVarP(&c.outPath, "out", "o", "", "path to write the diff to instead of stdout")
+	f.StringArrayVar(&c.selector.Include, "include", []string{}, "only diff kapps matching a selector, e.g. "+
+		"'manifest:kapp-id', 'web:word*' or 'label=db'. Other kapps are skipped (can specify multiple)")
+	f.StringArrayVar(&c.selector.Exclude, "exclude", []string{}, "skip kapps matching a selector "+
+		"(can specify multiple)")
+	f.BoolVar(&c.selector.WithDependencies, "with-dependencies", false, "also select the kapps "+
+		"selected kapps depend on")
 
 	return cmd
 }
 
 func (c *diffCmd) run(cmd *cobra.Command, args []string) error {
-	// todo the diff should include a timestamp so that we can allow them to
-	// only be valid as inputs to `kapps install` for a certain amount of time.
+	// todo - only allow diffs to be used as inputs to `kapps install` for a
+	// certain amount of time after they were created
+
+	if c.stackName == "" || c.stackFile == "" {
+		return errors.New("A stack name and the path to a stack config file are required.")
+	}
+
+	if len(args) > 0 {
+		c.cacheDir = args[0]
+	}
+
+	stackConfig, err := ParseStackCliArgs(c.stackName, c.stackFile)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	err = stackConfig.SetSelector(c.selector)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	actionPlan, err := plan.Create(stackConfig, c.cacheDir)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	diff, err := actionPlan.Diff(c.extended)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	data, err := yaml.Marshal(diff)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if c.outPath != "" {
+		err = ioutil.WriteFile(c.outPath, data, 0644)
+		if err != nil {
+			return errors.Wrapf(err, "Error writing diff to %s", c.outPath)
+		}
+		return nil
+	}
+
+	_, err = c.out.Write(data)
+	if err != nil {
+		return errors.WithStack(err)
+	}
 
 	return nil
 }
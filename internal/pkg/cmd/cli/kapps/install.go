@@ -1,26 +1,41 @@
 package kapps
 
 import (
+	"bufio"
+	"context"
 	"fmt"
 	"github.com/imdario/mergo"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 	"github.com/sugarkube/sugarkube/internal/pkg/cmd"
 	"github.com/sugarkube/sugarkube/internal/pkg/cmd/cli/cluster"
+	"github.com/sugarkube/sugarkube/internal/pkg/config"
+	"github.com/sugarkube/sugarkube/internal/pkg/installer"
 	"github.com/sugarkube/sugarkube/internal/pkg/kapp"
+	"github.com/sugarkube/sugarkube/internal/pkg/locker"
 	"github.com/sugarkube/sugarkube/internal/pkg/log"
 	"github.com/sugarkube/sugarkube/internal/pkg/plan"
+	"github.com/sugarkube/sugarkube/internal/pkg/provider"
+	"golang.org/x/crypto/ssh/terminal"
 	"io"
+	"os"
+	"strings"
+	"time"
 )
 
 type installCmd struct {
 	out           io.Writer
 	diffPath      string
+	planPath      string
 	cacheDir      string
 	dryRun        bool
 	approved      bool
 	oneShot       bool
+	autoApprove   bool
 	force         bool
+	frozen        bool
+	resume        bool
+	rollback      bool
 	stackName     string
 	stackFile     string
 	provider      string
@@ -31,9 +46,13 @@ type installCmd struct {
 	cluster       string
 	region        string
 	manifests     cmd.Files
-	// todo - add options to :
-	// * filter the kapps to be processed (use strings like e.g. manifest:kapp-id to refer to kapps)
-	// * exclude manifests / kapps from being processed
+	ignored       []string
+	phaseOrder    []string
+	onError       string
+	gracePeriod   time.Duration
+	parallelism   int
+	selector      kapp.Selector
+	manifestRange kapp.ManifestRange
 }
 
 func newInstallCmd(out io.Writer) *cobra.Command {
@@ -49,6 +68,20 @@ func newInstallCmd(out io.Writer) *cobra.Command {
 			if len(args) == 0 {
 				return errors.New("the path to the kapp cache dir is required")
 			}
+			if c.planPath != "" && (c.diffPath != "" || c.force) {
+				return errors.New("--plan can't be used with --diff-path or --force")
+			}
+			if c.resume && (c.diffPath != "" || c.force) {
+				return errors.New("--resume can't be used with --diff-path or --force")
+			}
+			if (c.planPath != "" || c.resume) && !c.selector.IsEmpty() {
+				return errors.New("--include and --exclude can't be used with --plan or " +
+					"--resume because plans record which kapps were selected")
+			}
+			if (c.planPath != "" || c.resume) && !c.manifestRange.IsEmpty() {
+				return errors.New("--from-manifest, --to-manifest and --only-manifest can't be " +
+					"used with --plan or --resume because plans record which manifests were selected")
+			}
 			c.cacheDir = args[0]
 			return c.run()
 		},
@@ -61,10 +94,19 @@ func newInstallCmd(out io.Writer) *cobra.Command {
 		"apply it).")
 	f.BoolVar(&c.oneShot, "one-shot", false, "apply a cluster diff in a single pass by invoking each kapp with "+
 		"'APPROVED=false' then 'APPROVED=true' to install/destroy kapps in a single invocation of sugarkube")
+	f.BoolVar(&c.autoApprove, "auto-approve", false, "with --one-shot, apply destructive changes found when "+
+		"kapps plan their changes without asking for confirmation")
 	f.BoolVar(&c.force, "force", false, "don't require a cluster diff, just blindly install/destroy all the kapps "+
 		"defined in a manifest(s)/stack config, even if they're already present/absent in the target cluster")
+	f.BoolVar(&c.frozen, "frozen", false, "fail if the manifests, the stack's lockfile and the cache disagree")
+	f.BoolVar(&c.resume, "resume", false, "resume the last run using the journal in the cache dir, skipping kapps "+
+		"that already succeeded. It's refused if the plan, cache or stack have changed since")
+	f.BoolVar(&c.rollback, "rollback", false, "if a kapp fails to install, reinstall it with the revisions "+
+		"it was last installed with successfully, found in the cache dir's history or the source of truth")
 	f.StringVarP(&c.diffPath, "diff-path", "d", "", "Path to the cluster diff to apply. If not given, a "+
 		"diff will be generated")
+	f.StringVar(&c.planPath, "plan", "", "Path to a plan saved by 'kapps plan --out' to apply. It's refused "+
+		"if the stack or cache have changed since it was created")
 	f.StringVarP(&c.stackName, "stack-name", "n", "", "name of a stack to launch (required when passing --stack-config)")
 	f.StringVarP(&c.stackFile, "stack-config", "s", "", "path to file defining stacks by name")
 	f.StringVarP(&c.provider, "provider", "p", "", "name of provider, e.g. aws, local, etc.")
@@ -75,6 +117,28 @@ func newInstallCmd(out io.Writer) *cobra.Command {
 	f.StringVarP(&c.region, "region", "r", "", "name of region (for providers that support it)")
 	f.VarP(&c.varsFilesDirs, "vars-file-or-dir", "f", "YAML vars file or directory to load (can specify multiple)")
 	f.VarP(&c.manifests, "manifest", "m", "YAML manifest file to load (can specify multiple but will replace any configured in a stack)")
+	f.StringSliceVar(&c.phaseOrder, "phase-order", plan.DEFAULT_PHASE_ORDER, "order to run the phases "+
+		"of the plan in. Kapps are destroyed walking manifests in reverse and installed walking them forwards")
+	f.StringArrayVar(&c.ignored, "ignore", []string{}, "kapp to leave alone, e.g. 'manifest:kapp-id', in addition to "+
+		"any ignored by the stack or manifests (can specify multiple)")
+	f.StringArrayVar(&c.selector.Include, "include", []string{}, "only install/destroy kapps matching a selector, e.g. "+
+		"'manifest:kapp-id', 'web:word*' or 'label=db'. Other kapps are skipped (can specify multiple)")
+	f.StringArrayVar(&c.selector.Exclude, "exclude", []string{}, "skip kapps matching a selector "+
+		"(can specify multiple)")
+	f.BoolVar(&c.selector.WithDependencies, "with-dependencies", false, "also select the kapps "+
+		"selected kapps depend on")
+	f.StringVar(&c.manifestRange.From, "from-manifest", "", "ID of the first manifest to run. Earlier "+
+		"manifests are left out")
+	f.StringVar(&c.manifestRange.To, "to-manifest", "", "ID of the last manifest to run. Later "+
+		"manifests are left out")
+	f.StringArrayVar(&c.manifestRange.Only, "only-manifest", []string{}, "ID of a manifest to run, "+
+		"leaving out the others. Can't be used with --from-manifest or --to-manifest (can specify multiple)")
+	f.StringVar(&c.onError, "on-error", plan.ON_ERROR_FAIL_FAST, "what to do when a kapp fails. 'fail-fast' "+
+		"cancels the other kapps in its tranche, 'continue' lets them finish. Later tranches are never run")
+	f.IntVar(&c.parallelism, "parallelism", 0, "maximum number of kapps to process at once. 0 means no "+
+		"limit. Manifests can set lower limits with 'max_parallel' or 'serial' in the stack config")
+	f.DurationVar(&c.gracePeriod, "grace-period", config.Config().GetDuration("kill_grace_period"),
+		"how long kapps have to exit after being interrupted (e.g. by Ctrl-C) before they're killed")
 	return cmd
 }
 
@@ -98,72 +162,316 @@ func (c *installCmd) run() error {
 		Provisioner:   c.provisioner,
 		Profile:       c.profile,
 		Cluster:       c.cluster,
+		Account:       c.account,
+		Region:        c.region,
 		VarsFilesDirs: c.varsFilesDirs,
 		Manifests:     cliManifests,
 	}
 
 	mergo.Merge(stackConfig, cliStackConfig, mergo.WithOverride)
 
+	// kapps ignored on the CLI add to the configured ones
+	stackConfig.Ignored = append(stackConfig.Ignored, c.ignored...)
+
+	// kapp IDs must still be unique in manifests given on the CLI, and
+	// unqualified IDs of ignored kapps unambiguous
+	err = kapp.ValidateStackConfig(stackConfig)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
 	log.Debugf("Final stack config: %#v", stackConfig)
 
-	var actionPlan *plan.Plan
+	// CLI args may select different overlays, and overlays also apply to
+	// manifests given on the CLI
+	err = provider.ApplyManifestOverlays(stackConfig)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	stackLock, err := locker.ApplyToStack(stackConfig, c.frozen)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	// lockfiles cover all the stack's manifests so they can only be sliced
+	// once it's been applied
+	err = stackConfig.SetManifestRange(c.manifestRange)
+	if err != nil {
+		return errors.WithStack(err)
+	}
 
-	if !c.force {
-		panic("Not implemented. Pass --force")
+	err = stackConfig.SetSelector(c.selector)
+	if err != nil {
+		return errors.WithStack(err)
+	}
 
-		if c.diffPath != "" {
-			// todo load a cluster diff from a file
+	var actionPlan *plan.Plan
+	var journal *plan.Journal
 
-			// todo - validate that the embedded stack config matches the target cluster.
+	if c.resume {
+		journal, err = plan.LoadJournal(c.cacheDir)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if journal == nil {
+			return errors.New(fmt.Sprintf("Can't resume because there's no "+
+				"journal in cache dir '%s'", c.cacheDir))
+		}
+	}
 
-			// in future we may want to be able to work entirely from a cluster
-			// diff, in which case it'd really be a plan for us
-			if len(stackConfig.Manifests) > 0 {
-				// todo - validate that the cluster diff matches the manifests, e.g. that
-				// the versions of kapps in the manifests match the versions in the cluster
-				// diff
+	if c.planPath != "" || journal != nil {
+		var planFile *plan.PlanFile
+		if c.planPath != "" {
+			planFile, err = plan.LoadPlan(c.planPath)
+			if err != nil {
+				return errors.WithStack(err)
 			}
 		} else {
-			// todo - create a cluster diff based on stackConfig.Manifests
+			planFile = journal.Plan
 		}
 
-		// todo - diff the cache against the kapps in the cluster diff and abort if
-		// it's out-of-sync (unless flags are set to ignore cache changes), e.g.:
-		//cacheDiff, err := cacher.DiffKappCache(clusterDiff, c.cacheDir)
-		//if err != nil {
-		//	return errors.WithStack(err)
-		//}
-		//if len(diff) != 0 {
-		//	return errors.New("Cache out-of-sync with manifests: %s", diff)
-		//}
+		// refuses plans for other stacks or that the cache no longer matches
+		actionPlan, err = plan.FromFile(planFile, stackConfig, c.cacheDir)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	} else {
+		actionPlan, err = createPlan(stackConfig, c.cacheDir, c.force, c.diffPath)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
 
-		// todo - create an action plan from the validated cluster diff
-		//actionPlan, err := plan.FromDiff(clusterDiff)
+	// plans loaded from files slice the stack to the manifests they're for
+	err = c.verifyCache(stackLock, stackConfig)
+	if err != nil {
+		return errors.WithStack(err)
+	}
 
-	} else {
-		// force mode, so no need to perform validation. Just create a plan
-		actionPlan, err = plan.Create(stackConfig, c.cacheDir)
+	if !c.dryRun {
+		err = c.setJournal(actionPlan, journal, stackConfig)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		// records what kapps were installed with so they can be rolled back
+		history, err := plan.LoadHistory(c.cacheDir)
 		if err != nil {
 			return errors.WithStack(err)
 		}
+		actionPlan.SetHistory(history)
+
+		// both passes of one-shot runs write to the same logs
+		logDir, err := installer.NewRunLogDir(c.cacheDir)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		log.Infof("Writing the output of kapps to '%s'", logDir)
+		actionPlan.SetLogDir(logDir)
 	}
 
+	actionPlan.SetRollback(c.rollback)
+
+	err = actionPlan.SetPhaseOrder(c.phaseOrder)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	err = actionPlan.SetErrorPolicy(c.onError)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	err = actionPlan.SetParallelism(c.parallelism)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	actionPlan.SetGracePeriod(c.gracePeriod)
+
+	// stops running kapps on SIGINT/SIGTERM instead of orphaning them
+	ctx, stop := cmd.InterruptibleContext()
+	defer stop()
+
 	if !c.oneShot {
 		// run the plan either preparing or applying changes
-		err := actionPlan.Run(c.approved, c.dryRun)
+		err = c.runPlan(ctx, actionPlan, c.approved)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		if !c.approved && !c.dryRun {
+			_, err = c.reportChanges(actionPlan)
+			if err != nil {
+				return errors.WithStack(err)
+			}
+		}
+	} else {
+		// one-shot mode, so prepare the plan, then apply it once any
+		// destructive changes have been approved
+		err = c.runPlan(ctx, actionPlan, false)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		if !c.dryRun {
+			report, err := c.reportChanges(actionPlan)
+			if err != nil {
+				return errors.WithStack(err)
+			}
+
+			err = c.confirm(report)
+			if err != nil {
+				return errors.WithStack(err)
+			}
+		}
+
+		err = c.runPlan(ctx, actionPlan, true)
 		if err != nil {
 			return errors.WithStack(err)
 		}
+	}
+
+	return nil
+}
+
+// Prints the changes kapps planned when they were run with APPROVED=false
+func (c *installCmd) reportChanges(actionPlan *plan.Plan) (*plan.ChangeReport, error) {
+	report, err := actionPlan.ChangeReport()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	_, err = fmt.Fprintln(c.out, "\nPlanned changes:")
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	err = report.Write(c.out)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return report, nil
+}
+
+// Returns an error unless destructive changes in the report were approved,
+// either with --auto-approve or interactively
+func (c *installCmd) confirm(report *plan.ChangeReport) error {
+	destructive := report.Destructive()
+	if len(destructive) == 0 {
+		return nil
+	}
+
+	if c.autoApprove {
+		log.Warnf("Applying destructive changes in %d kapp(s) because "+
+			"--auto-approve was given", len(destructive))
+		return nil
+	}
+
+	if !terminal.IsTerminal(int(os.Stdin.Fd())) {
+		return errors.New(fmt.Sprintf("%d kapp(s) will destroy or replace "+
+			"resources. Rerun with --auto-approve to apply them without an "+
+			"interactive terminal", len(destructive)))
+	}
+
+	_, err := fmt.Fprint(c.out, "\nApply the destructive changes above? Only "+
+		"'yes' will be accepted: ")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return errors.WithStack(err)
+	}
+
+	if strings.TrimSpace(answer) != "yes" {
+		return errors.New("Destructive changes weren't approved. Nothing " +
+			"has been applied")
+	}
+
+	return nil
+}
+
+// Records the status of each action in a journal so the run can be resumed.
+// If resuming, the existing journal is used as long as the plan, stack and
+// cache haven't changed.
+func (c *installCmd) setJournal(actionPlan *plan.Plan, journal *plan.Journal,
+	stackConfig *kapp.StackConfig) error {
+	planFile, err := actionPlan.ToFile()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if journal != nil {
+		err = journal.VerifyResumable(planFile, stackConfig)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		log.Infof("Resuming the run started at %s", journal.Plan.Created)
 	} else {
-		// one-shot mode, so prepare and apply the plan straight away
-		err = actionPlan.Run(false, c.dryRun)
+		journal, err = plan.NewJournal(planFile, stackConfig, c.cacheDir)
 		if err != nil {
 			return errors.WithStack(err)
 		}
-		err = actionPlan.Run(true, c.dryRun)
+	}
+
+	actionPlan.SetJournal(journal)
+	return nil
+}
+
+// Runs the plan and prints a summary of what happened to each kapp, even if
+// some of them failed
+func (c *installCmd) runPlan(ctx context.Context, actionPlan *plan.Plan,
+	approved bool) error {
+	summary, runErr := actionPlan.Run(ctx, approved, c.dryRun)
+
+	if summary != nil && len(summary.Results) > 0 {
+		_, err := fmt.Fprintf(c.out, "\nSummary (approved=%v):\n", approved)
 		if err != nil {
 			return errors.WithStack(err)
 		}
+
+		err = summary.Write(c.out)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	if runErr != nil {
+		return errors.WithStack(runErr)
+	}
+
+	return nil
+}
+
+// If the stack has a lockfile, checks that the cache was built from the
+// locked revisions
+func (c *installCmd) verifyCache(stackLock *locker.StackLock, stackConfig *kapp.StackConfig) error {
+	if stackLock == nil {
+		return nil
+	}
+
+	drifts, err := locker.VerifyCache(stackLock, stackConfig, c.cacheDir)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if len(drifts) == 0 {
+		log.Infof("Cache matches the lockfile for stack '%s'", stackConfig.Name)
+		return nil
+	}
+
+	for _, drift := range drifts {
+		log.Warnf("Cache doesn't match lockfile: %s", drift)
+	}
+
+	if c.frozen {
+		return errors.New(fmt.Sprintf("%d source(s) in the cache don't match "+
+			"the lockfile. Rebuild the cache with 'cache create'", len(drifts)))
 	}
 
 	return nil
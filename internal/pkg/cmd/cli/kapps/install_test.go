@@ -0,0 +1,51 @@
+package kapps
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"github.com/sugarkube/sugarkube/internal/pkg/plan"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestInstallPlanWithoutJournal(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "sugarkube-install-")
+	assert.Nil(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	planFile := plan.PlanFile{
+		FormatVersion: plan.PLAN_FORMAT_VERSION,
+		Stack: plan.StackIdentity{
+			Name:        "large",
+			Provider:    "local",
+			Provisioner: "minikube",
+			Profile:     "local",
+			Cluster:     "large",
+		},
+		Tranches: []plan.PlannedTranche{
+			{
+				Manifest: "manifest1",
+				Kapps: []plan.PlannedKapp{
+					{Id: "manifest1:kappA", Action: plan.ACTION_SKIP, Reason: "planned skip"},
+				},
+			},
+		},
+	}
+
+	planPath := filepath.Join(tmpDir, "plan.yaml")
+	assert.Nil(t, planFile.Save(planPath))
+
+	cacheDir := filepath.Join(tmpDir, "cache")
+	assert.Nil(t, os.MkdirAll(cacheDir, 0755))
+
+	var out bytes.Buffer
+	cmd := newInstallCmd(&out)
+	cmd.SetArgs([]string{"--plan", planPath, "--dry-run", "-s",
+		"../../../../testdata/stacks.yaml", "-n", "large", cacheDir})
+
+	err = cmd.Execute()
+	assert.Nil(t, err, "plans should be loaded from files without a journal")
+	assert.Contains(t, out.String(), "planned skip")
+}
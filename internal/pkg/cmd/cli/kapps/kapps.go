@@ -11,12 +11,15 @@ func NewKappsCmds(out io.Writer) *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "kapps [command]",
 		Short: fmt.Sprintf("Work with kapps"),
-		Long:  `Install and uninstall kapps`,
+		Long:  `List, plan, install and uninstall kapps`,
 	}
 
 	cmd.AddCommand(
 		newInitCmd(out),
 		newInstallCmd(out),
+		newListCmd(out),
+		newLogsCmd(out),
+		newPlanCmd(out),
 	)
 
 	return cmd
@@ -0,0 +1,68 @@
+package kapps
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/sugarkube/sugarkube/internal/pkg/cmd/cli/cluster"
+	"io"
+)
+
+type listCmd struct {
+	out       io.Writer
+	stackName string
+	stackFile string
+}
+
+func newListCmd(out io.Writer) *cobra.Command {
+	c := &listCmd{
+		out: out,
+	}
+
+	cmd := &cobra.Command{
+		Use:   "list [flags]",
+		Short: fmt.Sprintf("List the kapps in a stack"),
+		Long: `Lists the fully qualified IDs of the kapps in a stack and whether they should 
+be present or absent, and whether they're ignored. Fully qualified IDs have the form '<manifest>:<kapp>' and 
+can be used to refer to kapps in other commands.`,
+		RunE: c.run,
+	}
+
+	f := cmd.Flags()
+	f.StringVarP(&c.stackName, "stack-name", "n", "", "name of the stack to list kapps in")
+	f.StringVarP(&c.stackFile, "stack-config", "s", "", "path to file defining stacks by name")
+
+	return cmd
+}
+
+func (c *listCmd) run(cmd *cobra.Command, args []string) error {
+
+	if c.stackName == "" || c.stackFile == "" {
+		return errors.New("A stack name and the path to a stack config file are required.")
+	}
+
+	stackConfig, err := cluster.ParseStackCliArgs(c.stackName, c.stackFile)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	for _, manifest := range stackConfig.Manifests {
+		for _, kappObj := range manifest.Kapps {
+			state := "present"
+			if !kappObj.ShouldBePresent {
+				state = "absent"
+			}
+
+			if stackConfig.IsIgnored(kappObj) {
+				state += " (ignored)"
+			}
+
+			_, err = fmt.Fprintf(c.out, "%s\t%s\n", kappObj.FullyQualifiedId(), state)
+			if err != nil {
+				return errors.WithStack(err)
+			}
+		}
+	}
+
+	return nil
+}
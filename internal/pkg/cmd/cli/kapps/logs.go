@@ -0,0 +1,136 @@
+package kapps
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/sugarkube/sugarkube/internal/pkg/installer"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+type logsCmd struct {
+	out      io.Writer
+	cacheDir string
+	runId    string
+	stdout   bool
+	stderr   bool
+	list     bool
+}
+
+func newLogsCmd(out io.Writer) *cobra.Command {
+	c := &logsCmd{
+		out: out,
+	}
+
+	cmd := &cobra.Command{
+		Use:   "logs [cache-dir] [kapp]",
+		Short: fmt.Sprintf("Show the output of kapps"),
+		Long: `Shows the stdout and stderr kapps wrote the last time they were run, or during a
+specific run with '--run'. Kapps can be referred to by their fully qualified IDs, or just their
+IDs if they're unambiguous. Use '--list' to list runs with logs, or the kapps with logs in a run.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 {
+				return errors.New("the path to the kapp cache dir is required")
+			}
+			c.cacheDir = args[0]
+
+			if c.list {
+				if len(args) > 1 {
+					return errors.New("--list can't be used with a kapp ID")
+				}
+				return c.listLogs()
+			}
+
+			if len(args) != 2 {
+				return errors.New("the ID of a kapp is required")
+			}
+
+			return c.run(args[1])
+		},
+	}
+
+	f := cmd.Flags()
+	f.StringVar(&c.runId, "run", "", "ID of the run to show logs from. Defaults to the latest run with logs for the kapp")
+	f.BoolVar(&c.stdout, "stdout", false, "only show stdout")
+	f.BoolVar(&c.stderr, "stderr", false, "only show stderr")
+	f.BoolVar(&c.list, "list", false, "list runs with logs, or the kapps with logs in the run given by --run")
+
+	return cmd
+}
+
+func (c *logsCmd) listLogs() error {
+	var ids []string
+	var err error
+
+	if c.runId == "" {
+		ids, err = installer.ListLogRuns(c.cacheDir)
+	} else {
+		ids, err = installer.ListLoggedKapps(c.cacheDir, c.runId)
+	}
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	for _, id := range ids {
+		_, err = fmt.Fprintln(c.out, id)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	return nil
+}
+
+func (c *logsCmd) run(ref string) error {
+	logDir, err := installer.FindKappLogs(c.cacheDir, c.runId, ref)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	logNames := []string{installer.STDOUT_LOG, installer.STDERR_LOG}
+	if c.stdout != c.stderr {
+		logNames = []string{installer.STDOUT_LOG}
+		if c.stderr {
+			logNames = []string{installer.STDERR_LOG}
+		}
+	}
+
+	for _, logName := range logNames {
+		path := filepath.Join(logDir, logName)
+
+		// headers are only needed to tell the logs apart
+		if len(logNames) > 1 {
+			_, err = fmt.Fprintf(c.out, "==> %s <==\n", path)
+			if err != nil {
+				return errors.WithStack(err)
+			}
+		}
+
+		err = c.printFile(path)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	return nil
+}
+
+func (c *logsCmd) printFile(path string) error {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer file.Close()
+
+	_, err = io.Copy(c.out, file)
+	if err != nil {
+		return errors.Wrapf(err, "Error reading log %s", path)
+	}
+
+	return nil
+}
@@ -0,0 +1,217 @@
+package kapps
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/sugarkube/sugarkube/internal/pkg/cmd/cli/cluster"
+	"github.com/sugarkube/sugarkube/internal/pkg/kapp"
+	"github.com/sugarkube/sugarkube/internal/pkg/log"
+	"github.com/sugarkube/sugarkube/internal/pkg/plan"
+	"gopkg.in/yaml.v2"
+	"io"
+	"strings"
+)
+
+type planCmd struct {
+	out           io.Writer
+	cacheDir      string
+	diffPath      string
+	outPath       string
+	graph         string
+	force         bool
+	stackName     string
+	stackFile     string
+	ignored       []string
+	selector      kapp.Selector
+	manifestRange kapp.ManifestRange
+}
+
+func newPlanCmd(out io.Writer) *cobra.Command {
+	c := &planCmd{
+		out: out,
+	}
+
+	cmd := &cobra.Command{
+		Use:   "plan [cache-dir]",
+		Short: fmt.Sprintf("Plan which kapps to install and destroy"),
+		Long: `Creates a plan of the kapps that will be installed and destroyed in each
+tranche, and prints it as YAML. Plans saved with '--out' can be reviewed and
+then applied with 'kapps install --plan'.
+
+Plans record the stack and cluster they're for and the revision of each source
+in the cache. Installing a plan fails if any of them have changed since.
+
+With '--graph' the plan is printed as a graph in Graphviz DOT (the default) or 
+Mermaid format instead, showing the order tranches will be processed in, what 
+will happen to each kapp and the revisions of their sources, e.g.:
+
+  sugarkube kapps plan --graph -s stacks.yaml -n dev cache | dot -Tsvg > plan.svg
+  sugarkube kapps plan --graph=mermaid -s stacks.yaml -n dev cache`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 {
+				return errors.New("the path to the kapp cache dir is required")
+			}
+			c.cacheDir = args[0]
+			return c.run()
+		},
+	}
+
+	f := cmd.Flags()
+	f.BoolVar(&c.force, "force", false, "don't diff the cluster, just plan to install/destroy all the kapps "+
+		"defined in the stack's manifests")
+	f.StringVarP(&c.diffPath, "diff-path", "d", "", "Path to the cluster diff to plan from. If not given, a "+
+		"diff will be generated")
+	f.StringVarP(&c.outPath, "out", "o", "", "path to save the plan to instead of printing it")
+	f.StringVar(&c.graph, "graph", "", fmt.Sprintf("print the plan as a graph in the given format (%s) "+
+		"instead of as YAML. Can be combined with --out", strings.Join(plan.GRAPH_FORMATS, ", ")))
+	f.Lookup("graph").NoOptDefVal = plan.GRAPH_FORMAT_DOT
+	f.StringVarP(&c.stackName, "stack-name", "n", "", "name of the stack to plan")
+	f.StringVarP(&c.stackFile, "stack-config", "s", "", "path to file defining stacks by name")
+	f.StringArrayVar(&c.ignored, "ignore", []string{}, "kapp to leave alone, e.g. 'manifest:kapp-id', in addition to "+
+		"any ignored by the stack or manifests (can specify multiple)")
+	f.StringVar(&c.manifestRange.From, "from-manifest", "", "ID of the first manifest to plan. Earlier "+
+		"manifests are left out")
+	f.StringVar(&c.manifestRange.To, "to-manifest", "", "ID of the last manifest to plan. Later "+
+		"manifests are left out")
+	f.StringArrayVar(&c.manifestRange.Only, "only-manifest", []string{}, "ID of a manifest to plan, "+
+		"leaving out the others. Can't be used with --from-manifest or --to-manifest (can specify multiple)")
+	f.StringArrayVar(&c.selector.Include, "include", []string{}, "only plan kapps matching a selector, e.g. "+
+		"'manifest:kapp-id', 'web:word*' or 'label=db'. Other kapps are skipped (can specify multiple)")
+	f.StringArrayVar(&c.selector.Exclude, "exclude", []string{}, "skip kapps matching a selector "+
+		"(can specify multiple)")
+	f.BoolVar(&c.selector.WithDependencies, "with-dependencies", false, "also select the kapps "+
+		"selected kapps depend on")
+
+	return cmd
+}
+
+func (c *planCmd) run() error {
+
+	if c.stackName == "" || c.stackFile == "" {
+		return errors.New("A stack name and the path to a stack config file are required.")
+	}
+
+	if c.graph != "" {
+		// check the format before spending time diffing the cluster
+		err := plan.ValidateGraphFormat(c.graph)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	stackConfig, err := cluster.ParseStackCliArgs(c.stackName, c.stackFile)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if len(c.ignored) > 0 {
+		stackConfig.Ignored = append(stackConfig.Ignored, c.ignored...)
+
+		err = kapp.ValidateStackConfig(stackConfig)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	err = stackConfig.SetManifestRange(c.manifestRange)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	err = stackConfig.SetSelector(c.selector)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	actionPlan, err := createPlan(stackConfig, c.cacheDir, c.force, c.diffPath)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	planFile, err := actionPlan.ToFile()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if c.outPath != "" {
+		err = planFile.Save(c.outPath)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		log.Infof("Saved plan to %s", c.outPath)
+	}
+
+	if c.graph != "" {
+		err = planFile.WriteGraph(c.out, c.graph)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		return nil
+	}
+
+	if c.outPath != "" {
+		return nil
+	}
+
+	data, err := yaml.Marshal(planFile)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	_, err = c.out.Write(data)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+// Creates a plan for a stack. Unless forced, the plan only contains the kapps
+// that a cluster diff says need installing or destroying. The diff is loaded
+// from diffPath if given, otherwise it's generated.
+func createPlan(stackConfig *kapp.StackConfig, cacheDir string, force bool,
+	diffPath string) (*plan.Plan, error) {
+
+	actionPlan, err := plan.Create(stackConfig, cacheDir)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if force {
+		// no need to perform validation
+		return actionPlan, nil
+	}
+
+	var diff *plan.ClusterDiff
+
+	if diffPath != "" {
+		diff, err = plan.LoadDiff(diffPath)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+	} else {
+		diff, err = actionPlan.Diff(false)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+
+	// todo - diff the cache against the kapps in the cluster diff and abort if
+	// it's out-of-sync (unless flags are set to ignore cache changes)
+
+	// validates the diff was generated for this stack and that it matches
+	// the manifests
+	err = actionPlan.ApplyDiff(diff)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	log.Infof("Planning from cluster diff: %d kapp(s) to install, %d to "+
+		"upgrade and %d to destroy", len(diff.Install), len(diff.Upgrade),
+		len(diff.Destroy))
+
+	return actionPlan, nil
+}
@@ -0,0 +1,122 @@
+package lock
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/sugarkube/sugarkube/internal/pkg/cmd/cli/cluster"
+	"github.com/sugarkube/sugarkube/internal/pkg/locker"
+	"github.com/sugarkube/sugarkube/internal/pkg/log"
+	"io"
+)
+
+type lockCmd struct {
+	out       io.Writer
+	check     bool
+	stackName string
+	stackFile string
+}
+
+func NewLockCmd(out io.Writer) *cobra.Command {
+	c := &lockCmd{
+		out: out,
+	}
+
+	cmd := &cobra.Command{
+		Use:   "lock [flags]",
+		Short: fmt.Sprintf("Lock the sources of a stack to exact revisions"),
+		Long: `Resolves every source in every manifest of a stack to an immutable revision 
+(e.g. a git commit SHA) and writes them to a lockfile next to the stack config 
+file (e.g. 'stacks.yaml' is locked by 'stacks.lock').
+
+When a lockfile exists, 'cache create' checks sources out at their locked 
+revisions and 'kapps install' verifies the cache matches the lockfile. Pass 
+'--frozen' to those commands to fail if the manifests and lockfile disagree.
+
+Run with '--check' (e.g. in CI) to report any drift between the manifests and 
+the lockfile without modifying it. The command fails if there is any drift.
+`,
+		RunE: c.run,
+	}
+
+	f := cmd.Flags()
+	f.BoolVar(&c.check, "check", false, "report drift between the manifests and lockfile instead of writing it")
+	f.StringVarP(&c.stackName, "stack-name", "n", "", "name of the stack to lock")
+	f.StringVarP(&c.stackFile, "stack-config", "s", "", "path to file defining stacks by name")
+
+	return cmd
+}
+
+func (c *lockCmd) run(cmd *cobra.Command, args []string) error {
+
+	if c.stackName == "" || c.stackFile == "" {
+		return errors.New("Both a stack name and stack config file are required")
+	}
+
+	stackConfig, err := cluster.ParseStackCliArgs(c.stackName, c.stackFile)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	lockfilePath := locker.PathForStackFile(stackConfig.FilePath)
+
+	if c.check {
+		stackLock, err := locker.LoadStackLock(stackConfig)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		if stackLock == nil {
+			return errors.New(fmt.Sprintf("Stack '%s' isn't locked in %s",
+				stackConfig.Name, lockfilePath))
+		}
+
+		drifts, err := stackLock.Diff(stackConfig)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		if len(drifts) == 0 {
+			_, err = fmt.Fprintf(c.out, "Lockfile %s is up-to-date for stack '%s'\n",
+				lockfilePath, stackConfig.Name)
+			return errors.WithStack(err)
+		}
+
+		for _, drift := range drifts {
+			_, err = fmt.Fprintf(c.out, "%s\n", drift)
+			if err != nil {
+				return errors.WithStack(err)
+			}
+		}
+
+		return errors.New(fmt.Sprintf("%d source(s) in stack '%s' have drifted "+
+			"from lockfile %s", len(drifts), stackConfig.Name, lockfilePath))
+	}
+
+	lockfile, err := locker.Load(lockfilePath)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	log.Infof("Locking sources for stack '%s'...", stackConfig.Name)
+
+	stackLock, err := locker.Generate(stackConfig)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	lockfile.Stacks[stackConfig.Name] = stackLock
+
+	err = lockfile.Save(lockfilePath)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	_, err = fmt.Fprintf(c.out, "Locked %d source(s) for stack '%s' in %s\n",
+		len(stackLock.Sources), stackConfig.Name, lockfilePath)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
@@ -0,0 +1,132 @@
+package manifest
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/sugarkube/sugarkube/internal/pkg/cmd"
+	"github.com/sugarkube/sugarkube/internal/pkg/kapp"
+	"github.com/sugarkube/sugarkube/internal/pkg/schema"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+)
+
+type lintCmd struct {
+	out       io.Writer
+	stackName string
+	stackFile string
+	manifests cmd.Files
+}
+
+func newLintCmd(out io.Writer) *cobra.Command {
+	c := &lintCmd{
+		out: out,
+	}
+
+	cmd := &cobra.Command{
+		Use:   "lint [flags]",
+		Short: fmt.Sprintf("Check manifests and stack configs for errors"),
+		Long: `Validates manifests and stack config files against their JSON schemas (see 
+the 'schemas' directory) and prints any problems with their file, line and 
+column.
+
+If a stack config file is given it will be linted. If a stack name is also 
+given, all manifests used by that stack will be linted too.
+`,
+		RunE: c.run,
+	}
+
+	f := cmd.Flags()
+	f.StringVarP(&c.stackName, "stack-name", "n", "", "name of a stack to lint the manifests of")
+	f.StringVarP(&c.stackFile, "stack-config", "s", "", "path to file defining stacks by name")
+	f.VarP(&c.manifests, "manifest", "m", "YAML manifest file to lint (can specify multiple)")
+
+	return cmd
+}
+
+func (c *lintCmd) run(cmd *cobra.Command, args []string) error {
+
+	problems := make([]schema.Problem, 0)
+	manifestPaths := make([]string, 0)
+	numFiles := 0
+
+	if c.stackName != "" && c.stackFile == "" {
+		return errors.New("The path to a stack config file is required when " +
+			"supplying a stack name.")
+	}
+
+	if c.stackFile != "" {
+		stackProblems, err := lint(c.stackFile, schema.ValidateStacks)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		problems = append(problems, stackProblems...)
+		numFiles++
+
+		// only load the stack if the stack file is valid
+		if c.stackName != "" && len(stackProblems) == 0 {
+			stackData, err := kapp.LoadStackData(c.stackName, c.stackFile)
+			if err != nil {
+				return errors.WithStack(err)
+			}
+
+			manifests, _ := stackData[kapp.MANIFESTS_KEY].([]interface{})
+			for _, entry := range manifests {
+				entryMap, _ := entry.(map[interface{}]interface{})
+				uri, _ := entryMap[kapp.MANIFEST_URI_KEY].(string)
+				if uri == "" {
+					continue
+				}
+
+				if !filepath.IsAbs(uri) {
+					uri = filepath.Join(filepath.Dir(c.stackFile), uri)
+				}
+				manifestPaths = append(manifestPaths, uri)
+			}
+		}
+	}
+
+	manifestPaths = append(manifestPaths, c.manifests...)
+
+	for _, manifestPath := range manifestPaths {
+		manifestProblems, err := lint(manifestPath, schema.ValidateManifest)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		problems = append(problems, manifestProblems...)
+		numFiles++
+	}
+
+	if numFiles == 0 {
+		return errors.New("Nothing to lint. Pass a stack config or manifest files.")
+	}
+
+	for _, problem := range problems {
+		_, err := fmt.Fprintln(c.out, problem)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	if len(problems) > 0 {
+		return errors.New(fmt.Sprintf("Found %d problem(s) in %d file(s)",
+			len(problems), numFiles))
+	}
+
+	_, err := fmt.Fprintf(c.out, "No problems found in %d file(s)\n", numFiles)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+func lint(path string, validate func(string, []byte) ([]schema.Problem, error)) ([]schema.Problem, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Error reading %s", path)
+	}
+
+	return validate(path, data)
+}
@@ -0,0 +1,24 @@
+package manifest
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"io"
+)
+
+func NewManifestCmds(out io.Writer) *cobra.Command {
+
+	cmd := &cobra.Command{
+		Use:   "manifest [command]",
+		Short: fmt.Sprintf("Work with manifests"),
+		Long:  `Lint, render and update manifests`,
+	}
+
+	cmd.AddCommand(
+		newLintCmd(out),
+		newRenderCmd(out),
+		newUpdateCmd(out),
+	)
+
+	return cmd
+}
@@ -0,0 +1,124 @@
+package manifest
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/sugarkube/sugarkube/internal/pkg/kapp"
+	"github.com/sugarkube/sugarkube/internal/pkg/provider"
+	"gopkg.in/yaml.v2"
+	"io"
+)
+
+type renderCmd struct {
+	out        io.Writer
+	stackName  string
+	stackFile  string
+	profile    string
+	cluster    string
+	manifestId string
+}
+
+func newRenderCmd(out io.Writer) *cobra.Command {
+	c := &renderCmd{
+		out: out,
+	}
+
+	cmd := &cobra.Command{
+		Use:   "render [flags]",
+		Short: fmt.Sprintf("Print manifests with overlays applied"),
+		Long: `Prints the manifests of a stack after applying any overlays for the stack's 
+profile and cluster. Overlays are loaded from 'manifests/<manifest-id>.yaml' in 
+each directory searched for values files, from the least to the most specific.
+
+The profile and cluster can be overridden to see what the manifests would be 
+for other stacks.
+`,
+		RunE: c.run,
+	}
+
+	f := cmd.Flags()
+	f.StringVarP(&c.stackName, "stack-name", "n", "", "name of the stack to render manifests for")
+	f.StringVarP(&c.stackFile, "stack-config", "s", "", "path to file defining stacks by name")
+	f.StringVarP(&c.profile, "profile", "l", "", "profile to select overlays for, e.g. dev, test, prod, etc.")
+	f.StringVarP(&c.cluster, "cluster", "c", "", "cluster to select overlays for, e.g. dev1, dev2, etc.")
+	f.StringVarP(&c.manifestId, "manifest-id", "i", "", "only render the manifest with this ID")
+
+	return cmd
+}
+
+func (c *renderCmd) run(cmd *cobra.Command, args []string) error {
+
+	if c.stackName == "" || c.stackFile == "" {
+		return errors.New("A stack name and the path to a stack config file are required.")
+	}
+
+	stackConfig, err := kapp.LoadStackConfig(c.stackName, c.stackFile)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if c.profile != "" {
+		stackConfig.Profile = c.profile
+	}
+
+	if c.cluster != "" {
+		stackConfig.Cluster = c.cluster
+	}
+
+	// make sure the results are valid
+	err = provider.ApplyManifestOverlays(stackConfig)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	rendered := 0
+
+	for _, manifest := range stackConfig.Manifests {
+		if c.manifestId != "" && manifest.Id != c.manifestId {
+			continue
+		}
+
+		overlayPaths, err := provider.ManifestOverlayPaths(stackConfig, manifest)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		data, err := kapp.LoadManifestData(manifest.Uri, overlayPaths)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		yamlData, err := yaml.Marshal(data)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		_, err = fmt.Fprintf(c.out, "---\n# manifest: %s\n# source: %s\n",
+			manifest.Id, manifest.Uri)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		for _, overlayPath := range overlayPaths {
+			_, err = fmt.Fprintf(c.out, "# overlay: %s\n", overlayPath)
+			if err != nil {
+				return errors.WithStack(err)
+			}
+		}
+
+		_, err = fmt.Fprintf(c.out, "%s", yamlData)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		rendered++
+	}
+
+	if rendered == 0 {
+		return errors.New(fmt.Sprintf("No manifest with ID '%s' in stack '%s'",
+			c.manifestId, c.stackName))
+	}
+
+	return nil
+}
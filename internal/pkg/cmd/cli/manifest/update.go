@@ -0,0 +1,116 @@
+package manifest
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/sugarkube/sugarkube/internal/pkg/cmd"
+	"github.com/sugarkube/sugarkube/internal/pkg/cmd/cli/cluster"
+	"github.com/sugarkube/sugarkube/internal/pkg/kapp"
+	"github.com/sugarkube/sugarkube/internal/pkg/log"
+	"io"
+)
+
+type updateCmd struct {
+	out       io.Writer
+	dryRun    bool
+	stackName string
+	stackFile string
+	manifests cmd.Files
+}
+
+func newUpdateCmd(out io.Writer) *cobra.Command {
+	c := &updateCmd{
+		out: out,
+	}
+
+	cmd := &cobra.Command{
+		Use:   "update [flags]",
+		Short: fmt.Sprintf("Update pinned kapp versions in manifests"),
+		Long: `Updates manifests so each source with a 'version' constraint has its 'branch' 
+set to the newest tag in the source's repo matching that constraint. E.g. this 
+source:
+
+    - uri: git@github.com:sugarkube/kapps.git
+      version: wordpress-~0.1
+      branch: wordpress-0.1.0
+      path: incubator/wordpress
+
+will have its branch updated to 'wordpress-0.1.3' if that's the newest tag 
+matching '~0.1'. Manifest files are edited in place so comments are preserved.
+
+Manifests can either be given on the command line or loaded from a stack config.
+`,
+		RunE: c.run,
+	}
+
+	f := cmd.Flags()
+	f.BoolVar(&c.dryRun, "dry-run", false, "show which versions would be updated but don't modify manifests")
+	f.StringVarP(&c.stackName, "stack-name", "n", "", "name of a stack to update the manifests of (required when passing --stack-config)")
+	f.StringVarP(&c.stackFile, "stack-config", "s", "", "path to file defining stacks by name")
+	f.VarP(&c.manifests, "manifest", "m", "YAML manifest file to update (can specify multiple)")
+
+	return cmd
+}
+
+func (c *updateCmd) run(cmd *cobra.Command, args []string) error {
+
+	manifestPaths := make([]string, 0)
+
+	stackConfig, err := cluster.ParseStackCliArgs(c.stackName, c.stackFile)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	for _, manifest := range stackConfig.Manifests {
+		manifestPaths = append(manifestPaths, manifest.Uri)
+	}
+
+	manifestPaths = append(manifestPaths, c.manifests...)
+
+	if len(manifestPaths) == 0 {
+		return errors.New("No manifests to update. Pass a stack or manifest files.")
+	}
+
+	totalBumps := 0
+
+	for _, manifestPath := range manifestPaths {
+		log.Debugf("Updating manifest %s", manifestPath)
+
+		bumps, err := kapp.UpdateManifestFile(manifestPath, c.dryRun)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		if len(bumps) == 0 {
+			continue
+		}
+
+		_, err = fmt.Fprintf(c.out, "%s:\n", manifestPath)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		for _, bump := range bumps {
+			_, err = fmt.Fprintf(c.out, "  %s\n", bump)
+			if err != nil {
+				return errors.WithStack(err)
+			}
+		}
+
+		totalBumps += len(bumps)
+	}
+
+	verb := "Updated"
+	if c.dryRun {
+		verb = "Would update"
+	}
+
+	_, err = fmt.Fprintf(c.out, "%s %d source(s) in %d manifest(s)\n", verb,
+		totalBumps, len(manifestPaths))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
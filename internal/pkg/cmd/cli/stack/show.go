@@ -0,0 +1,62 @@
+package stack
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/sugarkube/sugarkube/internal/pkg/kapp"
+	"gopkg.in/yaml.v2"
+	"io"
+)
+
+type showCmd struct {
+	out       io.Writer
+	stackName string
+	stackFile string
+}
+
+func newShowCmd(out io.Writer) *cobra.Command {
+	c := &showCmd{
+		out: out,
+	}
+
+	cmd := &cobra.Command{
+		Use:   "show [flags]",
+		Short: fmt.Sprintf("Print a fully resolved stack"),
+		Long: `Prints the settings of a stack after merging in the settings of any stacks 
+it extends.`,
+		RunE: c.run,
+	}
+
+	f := cmd.Flags()
+	f.StringVarP(&c.stackName, "stack-name", "n", "", "name of the stack to show")
+	f.StringVarP(&c.stackFile, "stack-config", "s", "", "path to file defining stacks by name")
+
+	return cmd
+}
+
+func (c *showCmd) run(cmd *cobra.Command, args []string) error {
+
+	if c.stackName == "" || c.stackFile == "" {
+		return errors.New("A stack name and the path to a stack config file are required.")
+	}
+
+	stackData, err := kapp.LoadStackData(c.stackName, c.stackFile)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	data, err := yaml.Marshal(map[string]interface{}{
+		c.stackName: stackData,
+	})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	_, err = fmt.Fprintf(c.out, "%s", data)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
@@ -0,0 +1,22 @@
+package stack
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"io"
+)
+
+func NewStackCmds(out io.Writer) *cobra.Command {
+
+	cmd := &cobra.Command{
+		Use:   "stack [command]",
+		Short: fmt.Sprintf("Work with stacks"),
+		Long:  `Inspect stacks defined in stack config files`,
+	}
+
+	cmd.AddCommand(
+		newShowCmd(out),
+	)
+
+	return cmd
+}
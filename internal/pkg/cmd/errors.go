@@ -19,16 +19,26 @@ package cmd
 import (
 	"context"
 	"fmt"
+	"github.com/pkg/errors"
 	"os"
 )
 
+// Errors that should make the process exit with a specific code
+type exitCoder interface {
+	ExitCode() int
+}
+
 // CheckError prints err to stderr and exits with code 1 if err is not nil. Otherwise, it is a
-// no-op.
+// no-op. Errors that implement ExitCode() exit with that code instead.
 func CheckError(err error) {
 	if err != nil {
 		if err != context.Canceled {
 			fmt.Fprintf(os.Stderr, fmt.Sprintf("An error occurred: %v\n", err))
 		}
+
+		if coder, ok := errors.Cause(err).(exitCoder); ok {
+			os.Exit(coder.ExitCode())
+		}
 		os.Exit(1)
 	}
 }
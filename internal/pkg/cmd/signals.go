@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"context"
+	"github.com/sugarkube/sugarkube/internal/pkg/log"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// Returns a context that's cancelled when sugarkube receives SIGINT or SIGTERM
+// so running kapps can be stopped cleanly. A second signal exits immediately.
+// Call the returned func to stop handling signals.
+func InterruptibleContext() (context.Context, func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		select {
+		case sig := <-signals:
+			log.Warnf("Received %s. Stopping running kapps. Send it again to "+
+				"exit immediately", sig)
+			cancel()
+		case <-stopped:
+			return
+		}
+
+		select {
+		case sig := <-signals:
+			log.Errorf("Received %s again. Exiting without waiting for kapps "+
+				"to stop", sig)
+			// the conventional exit code for processes stopped by SIGINT
+			os.Exit(130)
+		case <-stopped:
+		}
+	}()
+
+	stop := func() {
+		signal.Stop(signals)
+		close(stopped)
+		cancel()
+	}
+
+	return ctx, stop
+}
@@ -5,6 +5,9 @@ import (
 	"github.com/sugarkube/sugarkube/internal/pkg/cmd/cli/cache"
 	"github.com/sugarkube/sugarkube/internal/pkg/cmd/cli/cluster"
 	"github.com/sugarkube/sugarkube/internal/pkg/cmd/cli/kapps"
+	"github.com/sugarkube/sugarkube/internal/pkg/cmd/cli/lock"
+	"github.com/sugarkube/sugarkube/internal/pkg/cmd/cli/manifest"
+	"github.com/sugarkube/sugarkube/internal/pkg/cmd/cli/stack"
 	"github.com/sugarkube/sugarkube/internal/pkg/cmd/version"
 )
 
@@ -77,6 +80,9 @@ See https://sugarkube.io for more info and documentation.
 		cluster.NewClusterCmds(out),
 		kapps.NewKappsCmds(out),
 		cache.NewCacheCmds(out),
+		manifest.NewManifestCmds(out),
+		lock.NewLockCmd(out),
+		stack.NewStackCmds(out),
 	)
 
 	return cmd
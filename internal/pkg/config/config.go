@@ -50,6 +50,13 @@ func readViperConfig(appName string) *viper.Viper {
 
 	v.SetDefault("json_logs", false)
 	v.SetDefault("loglevel", "debug")
+	// how long interrupted installers have to exit before they're killed
+	v.SetDefault("kill_grace_period", "30s")
+	// defaults for kapps that don't set them in their installer block. A
+	// timeout of 0 means there's no timeout.
+	v.SetDefault("installer_timeout", "0s")
+	v.SetDefault("installer_retries", 0)
+	v.SetDefault("installer_backoff", "10s")
 
 	return v
 }
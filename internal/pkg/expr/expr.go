@@ -0,0 +1,395 @@
+package expr
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// A tiny expression language for conditions in manifests and stack configs,
+// e.g.:
+//
+//   provider == "aws" && profile in ["dev", "prod"]
+//   !(vars.monitoring.enabled == false) || cluster != "standard"
+//
+// Supported operators are `==`, `!=`, `in`, `&&`, `||` and `!`, plus
+// parentheses. Operands can be string literals (single or double quoted),
+// numbers, `true`/`false`, lists of literals and identifiers. Identifiers can
+// use dots to look up nested keys in maps. Identifiers that can't be resolved
+// evaluate to nil, which is falsy.
+
+const (
+	tokenEOF = iota
+	tokenIdent
+	tokenString
+	tokenNumber
+	tokenOp
+	tokenLParen
+	tokenRParen
+	tokenLBracket
+	tokenRBracket
+	tokenComma
+)
+
+type token struct {
+	kind  int
+	value string
+	pos   int
+}
+
+type parser struct {
+	input  string
+	tokens []token
+	pos    int
+	ctx    map[string]interface{}
+}
+
+// Evaluates an expression against a context and returns whether it is truthy
+func Evaluate(expression string, ctx map[string]interface{}) (bool, error) {
+	tokens, err := tokenise(expression)
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+
+	p := parser{
+		input:  expression,
+		tokens: tokens,
+		ctx:    ctx,
+	}
+
+	result, err := p.parseOr()
+	if err != nil {
+		return false, errors.Wrapf(err, "Error evaluating expression '%s'", expression)
+	}
+
+	if p.peek().kind != tokenEOF {
+		return false, errors.New(fmt.Sprintf("Unexpected '%s' at position %d "+
+			"in expression '%s'", p.peek().value, p.peek().pos, expression))
+	}
+
+	return truthy(result), nil
+}
+
+// Splits an expression into tokens
+func tokenise(input string) ([]token, error) {
+	tokens := make([]token, 0)
+
+	i := 0
+	for i < len(input) {
+		c := input[i]
+
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(':
+			tokens = append(tokens, token{kind: tokenLParen, value: "(", pos: i})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{kind: tokenRParen, value: ")", pos: i})
+			i++
+		case c == '[':
+			tokens = append(tokens, token{kind: tokenLBracket, value: "[", pos: i})
+			i++
+		case c == ']':
+			tokens = append(tokens, token{kind: tokenRBracket, value: "]", pos: i})
+			i++
+		case c == ',':
+			tokens = append(tokens, token{kind: tokenComma, value: ",", pos: i})
+			i++
+		case strings.HasPrefix(input[i:], "&&"), strings.HasPrefix(input[i:], "||"),
+			strings.HasPrefix(input[i:], "=="), strings.HasPrefix(input[i:], "!="):
+			tokens = append(tokens, token{kind: tokenOp, value: input[i : i+2], pos: i})
+			i += 2
+		case c == '!':
+			tokens = append(tokens, token{kind: tokenOp, value: "!", pos: i})
+			i++
+		case c == '"' || c == '\'':
+			end := strings.IndexByte(input[i+1:], c)
+			if end < 0 {
+				return nil, errors.New(fmt.Sprintf("Unterminated string at "+
+					"position %d in expression '%s'", i, input))
+			}
+			tokens = append(tokens, token{kind: tokenString,
+				value: input[i+1 : i+1+end], pos: i})
+			i += end + 2
+		case isDigit(c) || c == '-':
+			start := i
+			i++
+			for i < len(input) && (isDigit(input[i]) || input[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenNumber, value: input[start:i], pos: start})
+		case isIdentChar(c):
+			start := i
+			for i < len(input) && (isIdentChar(input[i]) || isDigit(input[i]) ||
+				input[i] == '.' || input[i] == '-') {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenIdent, value: input[start:i], pos: start})
+		default:
+			return nil, errors.New(fmt.Sprintf("Unexpected character '%c' at "+
+				"position %d in expression '%s'", c, i, input))
+		}
+	}
+
+	tokens = append(tokens, token{kind: tokenEOF, pos: len(input)})
+
+	return tokens, nil
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdentChar(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) unexpected(t token) error {
+	if t.kind == tokenEOF {
+		return errors.New("Unexpected end of expression")
+	}
+	return errors.New(fmt.Sprintf("Unexpected '%s' at position %d", t.value, t.pos))
+}
+
+func (p *parser) parseOr() (interface{}, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peek().kind == tokenOp && p.peek().value == "||" {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = truthy(left) || truthy(right)
+	}
+
+	return left, nil
+}
+
+func (p *parser) parseAnd() (interface{}, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peek().kind == tokenOp && p.peek().value == "&&" {
+		p.next()
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = truthy(left) && truthy(right)
+	}
+
+	return left, nil
+}
+
+func (p *parser) parseNot() (interface{}, error) {
+	if p.peek().kind == tokenOp && p.peek().value == "!" {
+		p.next()
+		operand, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return !truthy(operand), nil
+	}
+
+	return p.parseComparison()
+}
+
+func (p *parser) parseComparison() (interface{}, error) {
+	left, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+
+	t := p.peek()
+	if t.kind == tokenOp && (t.value == "==" || t.value == "!=") {
+		p.next()
+		right, err := p.parsePrimary()
+		if err != nil {
+			return nil, err
+		}
+
+		if t.value == "==" {
+			return equal(left, right), nil
+		}
+		return !equal(left, right), nil
+	}
+
+	if t.kind == tokenIdent && t.value == "in" {
+		p.next()
+		right, err := p.parsePrimary()
+		if err != nil {
+			return nil, err
+		}
+
+		list, ok := right.([]interface{})
+		if !ok {
+			return nil, errors.New(fmt.Sprintf("The right-hand side of 'in' at "+
+				"position %d must be a list", t.pos))
+		}
+
+		for _, item := range list {
+			if equal(left, item) {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+
+	return left, nil
+}
+
+func (p *parser) parsePrimary() (interface{}, error) {
+	t := p.next()
+
+	switch t.kind {
+	case tokenLParen:
+		value, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); closing.kind != tokenRParen {
+			return nil, p.unexpected(closing)
+		}
+		return value, nil
+	case tokenLBracket:
+		list := make([]interface{}, 0)
+		if p.peek().kind == tokenRBracket {
+			p.next()
+			return list, nil
+		}
+		for {
+			item, err := p.parsePrimary()
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, item)
+
+			separator := p.next()
+			if separator.kind == tokenRBracket {
+				return list, nil
+			}
+			if separator.kind != tokenComma {
+				return nil, p.unexpected(separator)
+			}
+		}
+	case tokenString:
+		return t.value, nil
+	case tokenNumber:
+		number, err := strconv.ParseFloat(t.value, 64)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Invalid number at position %d", t.pos)
+		}
+		return number, nil
+	case tokenIdent:
+		switch t.value {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "nil", "null":
+			return nil, nil
+		}
+		return lookup(p.ctx, t.value), nil
+	}
+
+	return nil, p.unexpected(t)
+}
+
+// Resolves a dotted path against nested maps, returning nil if any part of
+// the path is missing
+func lookup(ctx map[string]interface{}, path string) interface{} {
+	var current interface{} = ctx
+
+	for _, key := range strings.Split(path, ".") {
+		switch m := current.(type) {
+		case map[string]interface{}:
+			current = m[key]
+		case map[interface{}]interface{}:
+			current = m[key]
+		case map[string]string:
+			value, ok := m[key]
+			if !ok {
+				return nil
+			}
+			current = value
+		default:
+			return nil
+		}
+	}
+
+	return current
+}
+
+// Compares two values. Values of different types are never equal, except
+// numbers, which are equal if they have the same value, so `1 == "1"` is
+// false but `replicas == 3.0` is true.
+func equal(left interface{}, right interface{}) bool {
+	leftNum, leftIsNum := toFloat(left)
+	rightNum, rightIsNum := toFloat(right)
+	if leftIsNum && rightIsNum {
+		return leftNum == rightNum
+	}
+
+	if left == nil || right == nil {
+		return left == nil && right == nil
+	}
+
+	return reflect.DeepEqual(left, right)
+}
+
+func toFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case float32:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+
+	return 0, false
+}
+
+func truthy(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case string:
+		return v != ""
+	case []interface{}:
+		return len(v) > 0
+	}
+
+	if number, ok := toFloat(value); ok {
+		return number != 0
+	}
+
+	return true
+}
@@ -0,0 +1,142 @@
+package expr
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestEvaluate(t *testing.T) {
+	ctx := map[string]interface{}{
+		"provider": "aws",
+		"profile":  "dev",
+		"cluster":  "dev1",
+		"region":   "",
+		"vars": map[string]interface{}{
+			"replicas": 3,
+			"monitoring": map[interface{}]interface{}{
+				"enabled": true,
+			},
+		},
+	}
+
+	tests := []struct {
+		name          string
+		desc          string
+		input         string
+		expectValue   bool
+		expectedError bool
+	}{
+		{
+			name:        "good_equality",
+			desc:        "check string equality works",
+			input:       `provider == "aws"`,
+			expectValue: true,
+		},
+		{
+			name:        "good_inequality",
+			desc:        "check string inequality works with single quotes",
+			input:       `provider != 'aws'`,
+			expectValue: false,
+		},
+		{
+			name:        "good_in",
+			desc:        "check list membership works",
+			input:       `profile in ["test", "dev"] && cluster == "dev1"`,
+			expectValue: true,
+		},
+		{
+			name:        "good_precedence",
+			desc:        "check && binds tighter than ||",
+			input:       `provider == "local" && profile == "dev" || cluster == "dev1"`,
+			expectValue: true,
+		},
+		{
+			name:        "good_parens_not",
+			desc:        "check parentheses and negation work",
+			input:       `!(provider == "aws" || profile == "dev")`,
+			expectValue: false,
+		},
+		{
+			name:        "good_nested_vars",
+			desc:        "check nested vars can be looked up",
+			input:       `vars.monitoring.enabled && vars.replicas == 3`,
+			expectValue: true,
+		},
+		{
+			name:        "good_missing_var",
+			desc:        "check missing vars are falsy",
+			input:       `vars.missing.key`,
+			expectValue: false,
+		},
+		{
+			name:        "good_empty_string",
+			desc:        "check empty strings are falsy",
+			input:       `region`,
+			expectValue: false,
+		},
+		{
+			name:        "good_numeric_coercion",
+			desc:        "check ints and floats with the same value are equal",
+			input:       `vars.replicas == 3.0`,
+			expectValue: true,
+		},
+		{
+			name:        "good_typed_number_string",
+			desc:        "check numbers aren't equal to strings",
+			input:       `vars.replicas == "3" || 1 == "1"`,
+			expectValue: false,
+		},
+		{
+			name:        "good_typed_bool_string",
+			desc:        "check booleans aren't equal to strings",
+			input:       `vars.monitoring.enabled == "true" || true == "true"`,
+			expectValue: false,
+		},
+		{
+			name:        "good_typed_list_string",
+			desc:        "check lists aren't equal to strings",
+			input:       `["a"] == "[a]"`,
+			expectValue: false,
+		},
+		{
+			name:        "good_typed_in",
+			desc:        "check list membership compares typed values",
+			input:       `vars.replicas in ["3"]`,
+			expectValue: false,
+		},
+		{
+			name:          "error_unterminated_string",
+			desc:          "check unterminated strings cause errors",
+			input:         `provider == "aws`,
+			expectedError: true,
+		},
+		{
+			name:          "error_trailing_tokens",
+			desc:          "check trailing tokens cause errors",
+			input:         `provider == "aws" "local"`,
+			expectedError: true,
+		},
+		{
+			name:          "error_in_requires_list",
+			desc:          "check the right-hand side of 'in' must be a list",
+			input:         `provider in "aws"`,
+			expectedError: true,
+		},
+		{
+			name:          "error_incomplete",
+			desc:          "check incomplete expressions cause errors",
+			input:         `provider ==`,
+			expectedError: true,
+		},
+	}
+
+	for _, test := range tests {
+		result, err := Evaluate(test.input, ctx)
+		if test.expectedError {
+			assert.NotNil(t, err, "expected an error for %s", test.name)
+		} else {
+			assert.Nil(t, err, "unexpected error for %s", test.name)
+			assert.Equal(t, test.expectValue, result, "unexpected result for %s", test.name)
+		}
+	}
+}
@@ -0,0 +1,246 @@
+package installer
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/sugarkube/sugarkube/internal/pkg/cacher"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// When kapps are run with APPROVED=false they should plan their changes
+// without making them. Sugarkube inspects what they plan to change so
+// destructive changes can be approved before they're made. Kapps can describe
+// their changes in a YAML or JSON file at the path in the CHANGES_FILE env var:
+//
+//   changes:
+//   - resource: aws_db_instance.main
+//     action: replace
+//
+// Otherwise the output of the unapproved run is searched for terraform plans.
+
+// Actions kapps can plan to take on resources
+const CHANGE_CREATE = "create"
+const CHANGE_UPDATE = "update"
+const CHANGE_DESTROY = "destroy"
+const CHANGE_REPLACE = "replace"
+
+// Names of files in a kapp's cache dir
+const CHANGES_FILE = "changes.yaml"
+const PLAN_OUTPUT_FILE = "plan-output.log"
+
+// A change a kapp plans to make to a resource
+type Change struct {
+	Resource string `yaml:"resource"`
+	Action   string `yaml:"action"`
+}
+
+// Returns whether the change will destroy something
+func (c Change) IsDestructive() bool {
+	return c.Action == CHANGE_DESTROY || c.Action == CHANGE_REPLACE
+}
+
+type changesFile struct {
+	Changes []Change `yaml:"changes"`
+}
+
+// Returns the path kapps can write their planned changes to
+func ChangesFilePath(kappRootDir string) string {
+	return filepath.Join(kappRootDir, cacher.CACHE_DIR, CHANGES_FILE)
+}
+
+// Returns the path the output of a kapp's last unapproved run is saved to
+func PlanOutputPath(kappRootDir string) string {
+	return filepath.Join(kappRootDir, cacher.CACHE_DIR, PLAN_OUTPUT_FILE)
+}
+
+// Returns the changes a kapp planned the last time it was run with
+// APPROVED=false, and whether it was found to have planned anything.
+func PlannedChanges(kappRootDir string) ([]Change, bool, error) {
+	path := ChangesFilePath(kappRootDir)
+	data, err := ioutil.ReadFile(path)
+	if err == nil {
+		changes, err := parseChangesFile(data)
+		if err != nil {
+			return nil, false, errors.Wrapf(err, "Error parsing changes file %s", path)
+		}
+		return changes, true, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, false, errors.Wrapf(err, "Error reading changes file %s", path)
+	}
+
+	path = PlanOutputPath(kappRootDir)
+	data, err = ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, errors.Wrapf(err, "Error reading plan output %s", path)
+	}
+
+	changes, found := parseTerraformPlan(string(data))
+	return changes, found, nil
+}
+
+// Removes the files describing a kapp's planned changes, and creates the
+// directory they're written to
+func clearPlannedChanges(kappRootDir string) error {
+	for _, path := range []string{ChangesFilePath(kappRootDir), PlanOutputPath(kappRootDir)} {
+		err := os.Remove(path)
+		if err != nil && !os.IsNotExist(err) {
+			return errors.Wrapf(err, "Error removing %s", path)
+		}
+	}
+
+	return errors.WithStack(os.MkdirAll(filepath.Join(kappRootDir, cacher.CACHE_DIR), 0755))
+}
+
+// Parses a structured changes file
+func parseChangesFile(data []byte) ([]Change, error) {
+	parsed := changesFile{}
+	err := yaml.UnmarshalStrict(data, &parsed)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	for _, change := range parsed.Changes {
+		switch change.Action {
+		case CHANGE_CREATE, CHANGE_UPDATE, CHANGE_DESTROY, CHANGE_REPLACE:
+		default:
+			return nil, errors.New(fmt.Sprintf("Unknown action '%s' for "+
+				"resource '%s'", change.Action, change.Resource))
+		}
+	}
+
+	return parsed.Changes, nil
+}
+
+var ansiPattern = regexp.MustCompile(`\x1b\[[0-9;]*m`)
+
+// e.g. `  # aws_instance.web will be destroyed` (terraform 0.12+)
+var terraformResourcePattern = regexp.MustCompile(
+	`^\s*# (\S+) (will be created|will be updated in-place|will be destroyed|must be replaced)`)
+
+// e.g. `-/+ aws_instance.web (new resource required)` (terraform 0.11)
+var legacyTerraformResourcePattern = regexp.MustCompile(`^\s*(-/\+|\+/-|\+|~|-) (\S+)`)
+
+// e.g. `Plan: 1 to add, 0 to change, 2 to destroy.`
+var terraformSummaryPattern = regexp.MustCompile(
+	`Plan: (\d+) to add, (\d+) to change, (\d+) to destroy`)
+
+const TERRAFORM_ACTIONS_HEADER = "Terraform will perform the following actions:"
+
+// printed by terraform when there's nothing to change
+var terraformNoChanges = []string{
+	"No changes. Infrastructure is up-to-date",
+	"No changes. Your infrastructure matches the configuration",
+}
+
+// Searches output for terraform plans. Returns whether any were found.
+func parseTerraformPlan(output string) ([]Change, bool) {
+	changes := make([]Change, 0)
+	found := false
+	inActions := false
+	// resources found since the last summary line
+	resources := 0
+	// newer versions of terraform also prefix resource blocks with symbols,
+	// so only look for the legacy format if the newer one isn't used
+	legacy := true
+
+	output = ansiPattern.ReplaceAllString(output, "")
+
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimRight(line, "\r")
+
+		if match := terraformResourcePattern.FindStringSubmatch(line); match != nil {
+			changes = append(changes, Change{
+				Resource: match[1],
+				Action:   terraformAction(match[2]),
+			})
+			resources++
+			legacy = false
+			continue
+		}
+
+		if strings.Contains(line, TERRAFORM_ACTIONS_HEADER) {
+			inActions = true
+			continue
+		}
+
+		if match := terraformSummaryPattern.FindStringSubmatch(line); match != nil {
+			found = true
+			inActions = false
+
+			// fall back to the summary if individual resources weren't found
+			destroyed, _ := strconv.Atoi(match[3])
+			if resources == 0 && destroyed > 0 {
+				changes = append(changes, Change{
+					Resource: fmt.Sprintf("%d resource(s)", destroyed),
+					Action:   CHANGE_DESTROY,
+				})
+			}
+			resources = 0
+			continue
+		}
+
+		if containsAny(line, terraformNoChanges) {
+			found = true
+			continue
+		}
+
+		if !inActions || !legacy {
+			continue
+		}
+
+		if match := legacyTerraformResourcePattern.FindStringSubmatch(line); match != nil {
+			changes = append(changes, Change{
+				Resource: match[2],
+				Action:   legacyTerraformAction(match[1]),
+			})
+			resources++
+		}
+	}
+
+	return changes, found || len(changes) > 0
+}
+
+func terraformAction(description string) string {
+	switch description {
+	case "will be created":
+		return CHANGE_CREATE
+	case "will be updated in-place":
+		return CHANGE_UPDATE
+	case "will be destroyed":
+		return CHANGE_DESTROY
+	default:
+		return CHANGE_REPLACE
+	}
+}
+
+func legacyTerraformAction(symbol string) string {
+	switch symbol {
+	case "+":
+		return CHANGE_CREATE
+	case "~":
+		return CHANGE_UPDATE
+	case "-":
+		return CHANGE_DESTROY
+	default:
+		return CHANGE_REPLACE
+	}
+}
+
+func containsAny(line string, substrings []string) bool {
+	for _, substring := range substrings {
+		if strings.Contains(line, substring) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,132 @@
+package installer
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+const TERRAFORM_PLAN = `
+Terraform will perform the following actions:
+
+  # aws_db_instance.main must be replaced
+-/+ resource "aws_db_instance" "main" {
+    }
+
+  # aws_security_group.db will be updated in-place
+  ~ resource "aws_security_group" "db" {
+    }
+
+  # aws_s3_bucket.logs will be destroyed
+  - resource "aws_s3_bucket" "logs" {
+    }
+
+Plan: 1 to add, 1 to change, 2 to destroy.
+`
+
+const LEGACY_TERRAFORM_PLAN = "\x1b[0mTerraform will perform the following actions:\n" +
+	"\n" +
+	"\x1b[33m-/+\x1b[0m aws_db_instance.main (new resource required)\n" +
+	"      id: \"db-1\" => <computed> (forces new resource)\n" +
+	"  \x1b[32m+\x1b[0m aws_route53_record.db\n" +
+	"  \x1b[31m-\x1b[0m aws_s3_bucket.logs\n" +
+	"\n" +
+	"Plan: 2 to add, 0 to change, 2 to destroy.\n"
+
+func TestParseTerraformPlan(t *testing.T) {
+	tests := []struct {
+		name          string
+		desc          string
+		input         string
+		expected      []Change
+		expectedFound bool
+	}{
+		{
+			name:  "terraform",
+			desc:  "resources in plans should be found",
+			input: "make[1]: Entering directory\n" + TERRAFORM_PLAN,
+			expected: []Change{
+				{Resource: "aws_db_instance.main", Action: CHANGE_REPLACE},
+				{Resource: "aws_security_group.db", Action: CHANGE_UPDATE},
+				{Resource: "aws_s3_bucket.logs", Action: CHANGE_DESTROY},
+			},
+			expectedFound: true,
+		},
+		{
+			name:  "legacy_terraform",
+			desc:  "resources in coloured plans from old versions of terraform should be found",
+			input: LEGACY_TERRAFORM_PLAN,
+			expected: []Change{
+				{Resource: "aws_db_instance.main", Action: CHANGE_REPLACE},
+				{Resource: "aws_route53_record.db", Action: CHANGE_CREATE},
+				{Resource: "aws_s3_bucket.logs", Action: CHANGE_DESTROY},
+			},
+			expectedFound: true,
+		},
+		{
+			name:          "summary_only",
+			desc:          "the summary should be used if resources aren't listed",
+			input:         "Plan: 0 to add, 0 to change, 3 to destroy.\n",
+			expected:      []Change{{Resource: "3 resource(s)", Action: CHANGE_DESTROY}},
+			expectedFound: true,
+		},
+		{
+			name:          "no_changes",
+			desc:          "plans without changes should be found",
+			input:         "No changes. Infrastructure is up-to-date.\n",
+			expected:      []Change{},
+			expectedFound: true,
+		},
+		{
+			name:     "not_terraform",
+			desc:     "output without a plan shouldn't be mistaken for one",
+			input:    "- deleting temp files\n+ done\n",
+			expected: []Change{},
+		},
+	}
+
+	for _, test := range tests {
+		actual, found := parseTerraformPlan(test.input)
+		assert.Equal(t, test.expected, actual, test.desc)
+		assert.Equal(t, test.expectedFound, found, test.desc)
+	}
+}
+
+func TestPlannedChanges(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "sugarkube-changes-")
+	assert.Nil(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	_, found, err := PlannedChanges(tmpDir)
+	assert.Nil(t, err)
+	assert.False(t, found, "kapps that haven't been planned shouldn't have changes")
+
+	assert.Nil(t, clearPlannedChanges(tmpDir))
+	assert.Nil(t, ioutil.WriteFile(PlanOutputPath(tmpDir), []byte(TERRAFORM_PLAN), 0644))
+
+	changes, found, err := PlannedChanges(tmpDir)
+	assert.Nil(t, err)
+	assert.True(t, found)
+	assert.Equal(t, 3, len(changes))
+
+	// changes files written by kapps take precedence over their output
+	assert.Nil(t, ioutil.WriteFile(ChangesFilePath(tmpDir), []byte(`{"changes": `+
+		`[{"resource": "helm_release.web", "action": "create"}]}`), 0644))
+
+	changes, found, err = PlannedChanges(tmpDir)
+	assert.Nil(t, err)
+	assert.True(t, found)
+	assert.Equal(t, []Change{{Resource: "helm_release.web", Action: CHANGE_CREATE}}, changes)
+
+	assert.Nil(t, ioutil.WriteFile(ChangesFilePath(tmpDir),
+		[]byte("changes:\n- resource: x\n  action: explode\n"), 0644))
+	_, _, err = PlannedChanges(tmpDir)
+	assert.Error(t, err, "unknown actions should be an error")
+
+	// clearing should remove the last run's files
+	assert.Nil(t, clearPlannedChanges(tmpDir))
+	_, found, err = PlannedChanges(tmpDir)
+	assert.Nil(t, err)
+	assert.False(t, found)
+}
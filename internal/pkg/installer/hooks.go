@@ -0,0 +1,108 @@
+package installer
+
+import (
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/sugarkube/sugarkube/internal/pkg/kapp"
+	"github.com/sugarkube/sugarkube/internal/pkg/log"
+	"github.com/sugarkube/sugarkube/internal/pkg/provider"
+	"os/exec"
+	"time"
+)
+
+// Returns the env vars to run stack and manifest hooks with. These are the
+// env vars kapps are run with that don't depend on a kapp.
+func StackEnvVars(stackConfig *kapp.StackConfig, providerImpl provider.Provider,
+	approved bool) map[string]string {
+	envVars := baseEnvVars(stackConfig, approved)
+	addProviderEnvVars(envVars, providerImpl)
+	return envVars
+}
+
+// Returns the directory and env vars to run a kapp's hooks with. These are the
+// same as the installer runs the kapp with.
+func KappHookEnv(i Installer, kappObj *kapp.Kapp, stackConfig *kapp.StackConfig,
+	approved bool, dryRun bool) (string, map[string]string, error) {
+	return i.hookEnv(kappObj, stackConfig, approved, dryRun)
+}
+
+// Runs hooks in order. Commands are run with `sh -c` and targets with `make`,
+// in the given directory. Their output is streamed to the log like kapps' and
+// appended to log files in logDir unless it's empty. If a hook fails and it's
+// set to fail on errors the remaining hooks aren't run and its error is
+// returned. Hooks are stopped if the context is cancelled.
+func RunHooks(ctx context.Context, description string, hooks []kapp.Hook,
+	dir string, envVars map[string]string, gracePeriod time.Duration,
+	logDir string, dryRun bool) error {
+
+	for _, hook := range hooks {
+		if dryRun {
+			log.Infof("Dry run. Would run %s hook '%s' in directory '%s'",
+				description, hook, dir)
+			continue
+		}
+
+		err := runHook(ctx, description, hook, dir, envVars, gracePeriod, logDir)
+		if err == nil {
+			continue
+		}
+
+		// interrupted hooks always stop the rest
+		if hook.FailsOnError() || ctx.Err() != nil {
+			return errors.WithStack(err)
+		}
+
+		log.Warnf("Ignoring failure of %s hook '%s': %s", description, hook, err)
+	}
+
+	return nil
+}
+
+// Runs a single hook
+func runHook(ctx context.Context, description string, hook kapp.Hook,
+	dir string, envVars map[string]string, gracePeriod time.Duration,
+	logDir string) error {
+	var cmd *exec.Cmd
+	if hook.Target != "" {
+		cmd = exec.Command("make", hook.Target)
+	} else {
+		cmd = exec.Command("sh", "-c", hook.Command)
+	}
+
+	output, err := newOutput(logDir, fmt.Sprintf("%s hook", description),
+		fmt.Sprintf("%s hook '%s' (APPROVED=%s)", description, hook,
+			envVars["APPROVED"]), "")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer output.Close()
+
+	cmd.Dir = dir
+	cmd.Env = envVarsToSlice(envVars)
+	cmd.Stdout = output.Stdout
+	cmd.Stderr = output.Stderr
+
+	log.Infof("Running %s hook '%s'...", description, hook)
+
+	err = runCmd(ctx, cmd, gracePeriod)
+
+	// flushes partial last lines so they're in the logs and stderr tail
+	closeErr := output.Close()
+	if closeErr != nil {
+		log.Warnf("Error closing the logs of %s hook '%s': %s", description,
+			hook, closeErr)
+	}
+
+	if err != nil {
+		logs := ""
+		if output.logDir != "" {
+			logs = fmt.Sprintf(" Full output is in '%s'.", output.logDir)
+		}
+
+		return errors.Wrapf(err, "Error running %s hook '%s' in '%s'.%s -- "+
+			"Stderr -- %s", description, hook, dir, logs, output.stderrTail())
+	}
+
+	return nil
+}
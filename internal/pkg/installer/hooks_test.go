@@ -0,0 +1,95 @@
+// +build !windows
+
+package installer
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/sugarkube/sugarkube/internal/pkg/kapp"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRunHooks(t *testing.T) {
+	tests := []struct {
+		name        string
+		desc        string
+		hooks       []kapp.Hook
+		dryRun      bool
+		expectedErr bool
+		// lines the hooks should have written
+		expected string
+	}{
+		{
+			name: "commands",
+			desc: "commands should be run in order with the env vars",
+			hooks: []kapp.Hook{
+				{Command: "echo first-$CLUSTER >> hooks.log"},
+				{Command: "echo second >> hooks.log"},
+			},
+			expected: "first-dev\nsecond\n",
+		},
+		{
+			name: "target",
+			desc: "targets should be run with make",
+			hooks: []kapp.Hook{
+				{Target: "hook"},
+			},
+			expected: "target-dev\n",
+		},
+		{
+			name: "fail",
+			desc: "failing hooks should stop the rest by default",
+			hooks: []kapp.Hook{
+				{Command: "exit 1"},
+				{Command: "echo not-run >> hooks.log"},
+			},
+			expectedErr: true,
+		},
+		{
+			name: "continue",
+			desc: "failures of hooks set to continue should be ignored",
+			hooks: []kapp.Hook{
+				{Command: "exit 1", OnError: kapp.HOOK_ON_ERROR_CONTINUE},
+				{Command: "echo run >> hooks.log"},
+			},
+			expected: "run\n",
+		},
+		{
+			name:   "dry_run",
+			desc:   "hooks shouldn't be run in dry runs",
+			hooks:  []kapp.Hook{{Command: "echo run >> hooks.log"}},
+			dryRun: true,
+		},
+	}
+
+	for _, test := range tests {
+		dir, err := ioutil.TempDir("", "hooks-")
+		assert.Nil(t, err)
+
+		err = ioutil.WriteFile(filepath.Join(dir, "Makefile"),
+			[]byte("hook:\n\techo target-$(CLUSTER) >> hooks.log\n"), 0644)
+		assert.Nil(t, err)
+
+		envVars := map[string]string{
+			"PATH":    os.Getenv("PATH"),
+			"CLUSTER": "dev",
+		}
+
+		err = RunHooks(context.Background(), "test", test.hooks, dir, envVars,
+			time.Second, "", test.dryRun)
+		if test.expectedErr {
+			assert.Error(t, err, test.desc)
+		} else {
+			assert.Nil(t, err, test.desc)
+		}
+
+		output, _ := ioutil.ReadFile(filepath.Join(dir, "hooks.log"))
+		assert.Equal(t, test.expected, string(output), test.desc)
+
+		os.RemoveAll(dir)
+	}
+}
@@ -1,26 +1,39 @@
 package installer
 
 import (
+	"context"
 	"fmt"
 	"github.com/pkg/errors"
 	"github.com/sugarkube/sugarkube/internal/pkg/kapp"
 	"github.com/sugarkube/sugarkube/internal/pkg/log"
 	"github.com/sugarkube/sugarkube/internal/pkg/provider"
+	"time"
 )
 
+// Installers must stop as soon as possible if their context is cancelled
 type Installer interface {
-	install(kappObj *kapp.Kapp, stackConfig *kapp.StackConfig, approved bool, dryRun bool) error
-	destroy(kappObj *kapp.Kapp, stackConfig *kapp.StackConfig, approved bool, dryRun bool) error
+	install(ctx context.Context, kappObj *kapp.Kapp, stackConfig *kapp.StackConfig,
+		approved bool, dryRun bool) error
+	destroy(ctx context.Context, kappObj *kapp.Kapp, stackConfig *kapp.StackConfig,
+		approved bool, dryRun bool) error
+	// the directory and env vars to run the kapp's hooks with
+	hookEnv(kappObj *kapp.Kapp, stackConfig *kapp.StackConfig, approved bool,
+		dryRun bool) (string, map[string]string, error)
 }
 
 // implemented installers
 const MAKE = "make"
 
-// Factory that creates installers
-func NewInstaller(name string, providerImpl provider.Provider) (Installer, error) {
+// Factory that creates installers. Interrupted installers are given
+// gracePeriod to stop before they're killed. The output of kapps is logged to
+// logDir unless it's empty.
+func NewInstaller(name string, providerImpl provider.Provider,
+	gracePeriod time.Duration, logDir string) (Installer, error) {
 	if name == MAKE {
 		return MakeInstaller{
-			provider: providerImpl,
+			provider:    providerImpl,
+			gracePeriod: gracePeriod,
+			logDir:      logDir,
 		}, nil
 	}
 
@@ -28,15 +41,15 @@ func NewInstaller(name string, providerImpl provider.Provider) (Installer, error
 }
 
 // Installs a kapp by delegating to an Installer implementation
-func Install(i Installer, kappObj *kapp.Kapp, stackConfig *kapp.StackConfig,
-	approved bool, dryRun bool) error {
-	log.Infof("Installing kapp '%s'...", kappObj.Id)
-	return i.install(kappObj, stackConfig, approved, dryRun)
+func Install(ctx context.Context, i Installer, kappObj *kapp.Kapp,
+	stackConfig *kapp.StackConfig, approved bool, dryRun bool) error {
+	log.Infof("Installing kapp '%s'...", kappObj.FullyQualifiedId())
+	return i.install(ctx, kappObj, stackConfig, approved, dryRun)
 }
 
 // Destroys a kapp by delegating to an Installer implementation
-func Destroy(i Installer, kappObj *kapp.Kapp, stackConfig *kapp.StackConfig,
-	approved bool, dryRun bool) error {
-	log.Infof("Destroying kapp '%s'...", kappObj.Id)
-	return i.destroy(kappObj, stackConfig, approved, dryRun)
+func Destroy(ctx context.Context, i Installer, kappObj *kapp.Kapp,
+	stackConfig *kapp.StackConfig, approved bool, dryRun bool) error {
+	log.Infof("Destroying kapp '%s'...", kappObj.FullyQualifiedId())
+	return i.destroy(ctx, kappObj, stackConfig, approved, dryRun)
 }
@@ -0,0 +1,366 @@
+package installer
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/sugarkube/sugarkube/internal/pkg/cacher"
+	"github.com/sugarkube/sugarkube/internal/pkg/kapp"
+	"github.com/sugarkube/sugarkube/internal/pkg/log"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The output of kapps is streamed to the log line by line, prefixed with
+// their IDs, and written to separate stdout and stderr log files in the cache
+// dir so it can be read after the run with `kapps logs`. Each run gets its own
+// directory of logs named after when it started, containing a directory per
+// kapp, e.g. `.sugarkube/logs/20181001T120000Z/web/wordpress/stdout.log`.
+// Every time a kapp or one of its hooks is run a header is appended to both
+// its logs. The output of manifest hooks is logged in the manifest's directory
+// and the output of stack hooks in the run's directory.
+
+// Name of the dir in the cache dir's sugarkube dir logs are written to
+const LOGS_DIR = "logs"
+
+const STDOUT_LOG = "stdout.log"
+const STDERR_LOG = "stderr.log"
+
+// Format of the names of run directories. They sort chronologically.
+const RUN_ID_FORMAT = "20060102T150405Z"
+
+// How many lines of stderr to include in errors. The rest are in the logs.
+const MAX_ERROR_LINES = 20
+
+// Longer lines are streamed in pieces so output without newlines isn't
+// buffered indefinitely
+const MAX_LINE_LENGTH = 64 * 1024
+
+// Returns the directory runs' logs are written to in a cache dir
+func LogsDir(cacheDir string) string {
+	return filepath.Join(cacheDir, cacher.CACHE_DIR, LOGS_DIR)
+}
+
+// Creates a directory for the logs of a new run and returns its path
+func NewRunLogDir(cacheDir string) (string, error) {
+	runId := time.Now().UTC().Format(RUN_ID_FORMAT)
+	path := filepath.Join(LogsDir(cacheDir), runId)
+
+	// runs started in the same second get a suffix
+	for i := 2; ; i++ {
+		_, err := os.Stat(path)
+		if os.IsNotExist(err) {
+			break
+		}
+		path = filepath.Join(LogsDir(cacheDir), fmt.Sprintf("%s-%d", runId, i))
+	}
+
+	err := os.MkdirAll(path, 0755)
+	if err != nil {
+		return "", errors.Wrapf(err, "Error creating log dir %s", path)
+	}
+
+	return path, nil
+}
+
+// Returns the directory a kapp's logs are written to for a run. Empty if the
+// run isn't logged.
+func KappLogDir(runLogDir string, fullyQualifiedId string) string {
+	if runLogDir == "" {
+		return ""
+	}
+
+	manifestId, kappId := kapp.SplitKappRef(fullyQualifiedId)
+	return filepath.Join(runLogDir, manifestId, kappId)
+}
+
+// Returns the directory the logs of a manifest's hooks are written to for a
+// run. Empty if the run isn't logged.
+func ManifestLogDir(runLogDir string, manifestId string) string {
+	if runLogDir == "" {
+		return ""
+	}
+
+	return filepath.Join(runLogDir, manifestId)
+}
+
+// Returns the IDs of the runs with logs in a cache dir, oldest first
+func ListLogRuns(cacheDir string) ([]string, error) {
+	entries, err := ioutil.ReadDir(LogsDir(cacheDir))
+	if os.IsNotExist(err) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	runIds := make([]string, 0)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			runIds = append(runIds, entry.Name())
+		}
+	}
+
+	sort.Strings(runIds)
+
+	return runIds, nil
+}
+
+// Returns the fully qualified IDs of the kapps with logs for a run
+func ListLoggedKapps(cacheDir string, runId string) ([]string, error) {
+	paths, err := filepath.Glob(filepath.Join(LogsDir(cacheDir), runId, "*", "*", STDOUT_LOG))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	ids := make([]string, 0)
+	for _, path := range paths {
+		kappDir := filepath.Dir(path)
+		ids = append(ids, filepath.Base(filepath.Dir(kappDir))+kapp.FQ_ID_SEPARATOR+
+			filepath.Base(kappDir))
+	}
+
+	return ids, nil
+}
+
+// Returns the directory of a kapp's logs for a run. If no run ID is given the
+// latest run with logs for the kapp is used. Kapp refs needn't be fully
+// qualified if they're unambiguous.
+func FindKappLogs(cacheDir string, runId string, ref string) (string, error) {
+	runIds := []string{runId}
+	if runId == "" {
+		var err error
+		runIds, err = ListLogRuns(cacheDir)
+		if err != nil {
+			return "", errors.WithStack(err)
+		}
+	}
+
+	manifestId, kappId := kapp.SplitKappRef(ref)
+	if manifestId == "" {
+		manifestId = "*"
+	}
+
+	for i := len(runIds) - 1; i >= 0; i-- {
+		paths, err := filepath.Glob(filepath.Join(LogsDir(cacheDir), runIds[i],
+			manifestId, kappId, STDOUT_LOG))
+		if err != nil {
+			return "", errors.WithStack(err)
+		}
+
+		if len(paths) > 1 {
+			return "", errors.New(fmt.Sprintf("Kapp ID '%s' is ambiguous in "+
+				"run '%s'. Use a fully qualified ID", ref, runIds[i]))
+		}
+
+		if len(paths) == 1 {
+			return filepath.Dir(paths[0]), nil
+		}
+	}
+
+	if runId != "" {
+		return "", errors.New(fmt.Sprintf("No logs found for kapp '%s' in run "+
+			"'%s'", ref, runId))
+	}
+
+	return "", errors.New(fmt.Sprintf("No logs found for kapp '%s' in cache "+
+		"dir '%s'", ref, cacheDir))
+}
+
+// Where the output of a kapp or hook is written while it's run. Output isn't
+// kept in memory apart from the last lines of stderr for errors.
+type kappOutput struct {
+	Stdout io.Writer
+	Stderr io.Writer
+	// the directory the logs are written to. Empty if they aren't.
+	logDir  string
+	files   []*os.File
+	streams []*lineWriter
+	// the last MAX_ERROR_LINES lines of stderr, oldest first
+	stderrLines []string
+	// how many lines of stderr were written in total
+	stderrCount int
+}
+
+// Returns the output for a run of a kapp. It's only written to log files if a
+// log dir for the run is given, and the header is appended to each log file.
+// Stdout is also written to planOutputPath unless it's empty.
+func newKappOutput(runLogDir string, id string, header string,
+	planOutputPath string) (*kappOutput, error) {
+	return newOutput(KappLogDir(runLogDir, id), id, header, planOutputPath)
+}
+
+// Returns output that's streamed to the log with lines prefixed by the prefix,
+// and appended to log files in logDir unless it's empty
+func newOutput(logDir string, prefix string, header string,
+	planOutputPath string) (*kappOutput, error) {
+	output := &kappOutput{}
+
+	stdoutStream := newLineWriter(func(line string) {
+		log.Infof("[%s] %s", prefix, line)
+	})
+	stderrStream := newLineWriter(func(line string) {
+		log.Infof("[%s stderr] %s", prefix, line)
+		output.addStderrLine(line)
+	})
+	output.streams = []*lineWriter{stdoutStream, stderrStream}
+
+	stdoutWriters := []io.Writer{stdoutStream}
+	stderrWriters := []io.Writer{stderrStream}
+
+	// opens a file and adds it to the writers of a stream
+	openFile := func(path string, flag int, writers *[]io.Writer) (*os.File, error) {
+		file, err := os.OpenFile(path, flag|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			output.Close()
+			return nil, errors.Wrapf(err, "Error opening log %s", path)
+		}
+		output.files = append(output.files, file)
+		*writers = append(*writers, file)
+		return file, nil
+	}
+
+	if planOutputPath != "" {
+		_, err := openFile(planOutputPath, os.O_TRUNC, &stdoutWriters)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+
+	if logDir != "" {
+		output.logDir = logDir
+		err := os.MkdirAll(output.logDir, 0755)
+		if err != nil {
+			output.Close()
+			return nil, errors.Wrapf(err, "Error creating log dir %s", output.logDir)
+		}
+
+		for _, logFile := range []struct {
+			name    string
+			writers *[]io.Writer
+		}{
+			{STDOUT_LOG, &stdoutWriters},
+			{STDERR_LOG, &stderrWriters},
+		} {
+			path := filepath.Join(output.logDir, logFile.name)
+			file, err := openFile(path, os.O_APPEND, logFile.writers)
+			if err != nil {
+				return nil, errors.WithStack(err)
+			}
+
+			_, err = fmt.Fprintf(file, "=== %s at %s ===\n", header,
+				time.Now().UTC().Format(time.RFC3339))
+			if err != nil {
+				output.Close()
+				return nil, errors.Wrapf(err, "Error writing to log %s", path)
+			}
+		}
+	}
+
+	output.Stdout = io.MultiWriter(stdoutWriters...)
+	output.Stderr = io.MultiWriter(stderrWriters...)
+
+	return output, nil
+}
+
+// Keeps the last MAX_ERROR_LINES lines of stderr
+func (o *kappOutput) addStderrLine(line string) {
+	o.stderrCount++
+
+	if len(o.stderrLines) < MAX_ERROR_LINES {
+		o.stderrLines = append(o.stderrLines, line)
+		return
+	}
+
+	copy(o.stderrLines, o.stderrLines[1:])
+	o.stderrLines[len(o.stderrLines)-1] = line
+}
+
+// Returns the last lines of stderr. Partial last lines are only included once
+// the output's been closed.
+func (o *kappOutput) stderrTail() string {
+	lines := o.stderrLines
+	if o.stderrCount > len(lines) {
+		lines = append([]string{fmt.Sprintf("(%d earlier lines omitted)",
+			o.stderrCount-len(lines))}, lines...)
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// Streams any partial last lines and closes the files. It can be called more
+// than once.
+func (o *kappOutput) Close() error {
+	for _, stream := range o.streams {
+		stream.Flush()
+	}
+
+	var closeErr error
+	for _, file := range o.files {
+		err := file.Close()
+		if err != nil && closeErr == nil {
+			closeErr = errors.WithStack(err)
+		}
+	}
+	o.files = nil
+
+	return closeErr
+}
+
+// Calls a function with each complete line written to it. Commands may write
+// partial lines, so they're buffered until they're complete or flushed.
+type lineWriter struct {
+	onLine  func(line string)
+	partial []byte
+	mutex   sync.Mutex
+}
+
+func newLineWriter(onLine func(line string)) *lineWriter {
+	return &lineWriter{onLine: onLine}
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	w.partial = append(w.partial, p...)
+
+	for {
+		i := bytes.IndexByte(w.partial, '\n')
+		if i < 0 {
+			break
+		}
+
+		w.onLine(strings.TrimRight(string(w.partial[:i]), "\r"))
+		w.partial = w.partial[i+1:]
+	}
+
+	for len(w.partial) >= MAX_LINE_LENGTH {
+		w.onLine(string(w.partial[:MAX_LINE_LENGTH]))
+		w.partial = w.partial[MAX_LINE_LENGTH:]
+	}
+
+	// don't hold on to the memory of lines that have been streamed
+	if len(w.partial) == 0 {
+		w.partial = nil
+	}
+
+	return len(p), nil
+}
+
+// Calls the function with any partial line
+func (w *lineWriter) Flush() {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if len(w.partial) > 0 {
+		w.onLine(string(w.partial))
+		w.partial = nil
+	}
+}
@@ -0,0 +1,209 @@
+package installer
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLineWriter(t *testing.T) {
+	lines := make([]string, 0)
+	writer := newLineWriter(func(line string) {
+		lines = append(lines, line)
+	})
+
+	for _, chunk := range []string{"first\nsec", "ond\r\n", "\nlast"} {
+		_, err := writer.Write([]byte(chunk))
+		assert.Nil(t, err)
+	}
+
+	assert.Equal(t, []string{"first", "second", ""}, lines,
+		"only complete lines should be written")
+
+	writer.Flush()
+	assert.Equal(t, []string{"first", "second", "", "last"}, lines,
+		"partial lines should be written when flushed")
+}
+
+func TestKappOutput(t *testing.T) {
+	cacheDir, err := ioutil.TempDir("", "sugarkube-logs-")
+	assert.Nil(t, err)
+	defer os.RemoveAll(cacheDir)
+
+	runLogDir, err := NewRunLogDir(cacheDir)
+	assert.Nil(t, err)
+
+	for _, header := range []string{"make install (APPROVED=false)", "make install (APPROVED=true)"} {
+		output, err := newKappOutput(runLogDir, "web:wordpress", header, "")
+		assert.Nil(t, err)
+
+		_, err = fmt.Fprintln(output.Stdout, "out")
+		assert.Nil(t, err)
+		_, err = fmt.Fprintln(output.Stderr, "err")
+		assert.Nil(t, err)
+		assert.Nil(t, output.Close())
+	}
+
+	logDir := filepath.Join(runLogDir, "web", "wordpress")
+
+	stdout, err := ioutil.ReadFile(filepath.Join(logDir, STDOUT_LOG))
+	assert.Nil(t, err)
+	stdoutLines := strings.Split(strings.TrimSpace(string(stdout)), "\n")
+	assert.Len(t, stdoutLines, 4, "each run should be appended")
+	assert.True(t, strings.HasPrefix(stdoutLines[0], "=== make install (APPROVED=false) at "))
+	assert.Equal(t, "out", stdoutLines[1])
+	assert.True(t, strings.HasPrefix(stdoutLines[2], "=== make install (APPROVED=true) at "))
+
+	stderr, err := ioutil.ReadFile(filepath.Join(logDir, STDERR_LOG))
+	assert.Nil(t, err)
+	assert.NotContains(t, string(stderr), "out", "stdout should be logged separately")
+	assert.Contains(t, string(stderr), "err\n")
+}
+
+func TestStderrTail(t *testing.T) {
+	output, err := newKappOutput("", "web:wordpress", "make install", "")
+	assert.Nil(t, err)
+
+	for i := 1; i < MAX_ERROR_LINES+5; i++ {
+		_, err = fmt.Fprintf(output.Stderr, "line %d\n", i)
+		assert.Nil(t, err)
+	}
+	// the last line is partial
+	_, err = fmt.Fprintf(output.Stderr, "line %d", MAX_ERROR_LINES+5)
+	assert.Nil(t, err)
+	assert.Nil(t, output.Close())
+	assert.Nil(t, output.Close(), "closing twice should be harmless")
+
+	assert.Len(t, output.stderrLines, MAX_ERROR_LINES, "only the tail should be kept")
+
+	tail := strings.Split(output.stderrTail(), "\n")
+	assert.Len(t, tail, MAX_ERROR_LINES+1)
+	assert.Equal(t, "(5 earlier lines omitted)", tail[0])
+	assert.Equal(t, "line 6", tail[1])
+	assert.Equal(t, fmt.Sprintf("line %d", MAX_ERROR_LINES+5), tail[MAX_ERROR_LINES])
+}
+
+func TestKappOutputPlanOutput(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "sugarkube-logs-")
+	assert.Nil(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	path := filepath.Join(tmpDir, PLAN_OUTPUT_FILE)
+	assert.Nil(t, ioutil.WriteFile(path, []byte("stale plan\n"), 0644))
+
+	output, err := newKappOutput("", "web:wordpress", "make install", path)
+	assert.Nil(t, err)
+
+	_, err = fmt.Fprintln(output.Stdout, "Plan: 1 to add")
+	assert.Nil(t, err)
+	_, err = fmt.Fprintln(output.Stderr, "warning")
+	assert.Nil(t, err)
+	assert.Nil(t, output.Close())
+
+	data, err := ioutil.ReadFile(path)
+	assert.Nil(t, err)
+	assert.Equal(t, "Plan: 1 to add\n", string(data),
+		"only this run's stdout should be saved")
+}
+
+func TestLineWriterLongLines(t *testing.T) {
+	lengths := make([]int, 0)
+	writer := newLineWriter(func(line string) {
+		lengths = append(lengths, len(line))
+	})
+
+	_, err := writer.Write(make([]byte, MAX_LINE_LENGTH*2+1))
+	assert.Nil(t, err)
+	assert.Equal(t, []int{MAX_LINE_LENGTH, MAX_LINE_LENGTH}, lengths,
+		"long lines should be streamed in pieces")
+	assert.Len(t, writer.partial, 1)
+}
+
+func TestFindKappLogs(t *testing.T) {
+	cacheDir, err := ioutil.TempDir("", "sugarkube-logs-")
+	assert.Nil(t, err)
+	defer os.RemoveAll(cacheDir)
+
+	// creates logs for kapps in a run
+	writeLogs := func(runId string, ids ...string) {
+		for _, id := range ids {
+			output, err := newKappOutput(filepath.Join(LogsDir(cacheDir), runId), id,
+				"make install", "")
+			assert.Nil(t, err)
+			assert.Nil(t, output.Close())
+		}
+	}
+
+	writeLogs("20181001T120000Z", "data:postgres", "data:redis", "web:redis", "web:wordpress")
+	writeLogs("20181002T120000Z", "web:wordpress", "web:postgres")
+
+	runIds, err := ListLogRuns(cacheDir)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"20181001T120000Z", "20181002T120000Z"}, runIds)
+
+	kappIds, err := ListLoggedKapps(cacheDir, "20181001T120000Z")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"data:postgres", "data:redis", "web:redis", "web:wordpress"}, kappIds)
+
+	tests := []struct {
+		name          string
+		desc          string
+		runId         string
+		ref           string
+		expected      string
+		expectedError bool
+	}{
+		{
+			name:     "latest",
+			desc:     "the latest run should be used by default",
+			ref:      "wordpress",
+			expected: filepath.Join("20181002T120000Z", "web", "wordpress"),
+		},
+		{
+			name:     "run",
+			desc:     "logs should be found in given runs",
+			runId:    "20181001T120000Z",
+			ref:      "web:wordpress",
+			expected: filepath.Join("20181001T120000Z", "web", "wordpress"),
+		},
+		{
+			name:     "unqualified",
+			desc:     "unqualified IDs should be found in the latest run if unambiguous there",
+			ref:      "postgres",
+			expected: filepath.Join("20181002T120000Z", "web", "postgres"),
+		},
+		{
+			name:     "earlier_run",
+			desc:     "the latest run with logs for the kapp should be used",
+			ref:      "data:postgres",
+			expected: filepath.Join("20181001T120000Z", "data", "postgres"),
+		},
+		{
+			name:          "ambiguous",
+			desc:          "ambiguous IDs are errors",
+			ref:           "redis",
+			expectedError: true,
+		},
+		{
+			name:          "missing",
+			desc:          "kapps without logs are errors",
+			runId:         "20181002T120000Z",
+			ref:           "data:postgres",
+			expectedError: true,
+		},
+	}
+
+	for _, test := range tests {
+		logDir, err := FindKappLogs(cacheDir, test.runId, test.ref)
+		if test.expectedError {
+			assert.Error(t, err, test.desc)
+			continue
+		}
+		assert.Nil(t, err, test.desc)
+		assert.Equal(t, filepath.Join(LogsDir(cacheDir), test.expected), logDir, test.desc)
+	}
+}
@@ -1,7 +1,7 @@
 package installer
 
 import (
-	"bytes"
+	"context"
 	"fmt"
 	"github.com/pkg/errors"
 	"github.com/sugarkube/sugarkube/internal/pkg/kapp"
@@ -11,32 +11,34 @@ import (
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"time"
 )
 
 // Installs kapps with make
 type MakeInstaller struct {
 	provider        provider.Provider
 	stackConfigVars provider.Values
+	// how long make is given to exit after being interrupted
+	gracePeriod time.Duration
+	// the directory of the run's logs. Output isn't logged to files if empty.
+	logDir string
 }
 
 const TARGET_INSTALL = "install"
 const TARGET_DESTROY = "destroy"
 
-// Run the given make target
-func (i MakeInstaller) run(makeTarget string, kappObj *kapp.Kapp,
-	stackConfig *kapp.StackConfig, approved bool, dryRun bool) error {
-
-	// search for the Makefile
+// Returns the absolute path to a kapp's Makefile
+func findMakefile(kappObj *kapp.Kapp) (string, error) {
 	makefilePaths, err := findFilesByPattern(kappObj.RootDir, "Makefile",
 		true, false)
 	if err != nil {
-		return errors.Wrapf(err, "Error finding Makefile in '%s'",
+		return "", errors.Wrapf(err, "Error finding Makefile in '%s'",
 			kappObj.RootDir)
 	}
 
 	if len(makefilePaths) == 0 {
-		return errors.New(fmt.Sprintf("No makefile found for kapp '%s' "+
-			"in '%s'", kappObj.Id, kappObj.RootDir))
+		return "", errors.New(fmt.Sprintf("No makefile found for kapp '%s' "+
+			"in '%s'", kappObj.FullyQualifiedId(), kappObj.RootDir))
 	}
 	if len(makefilePaths) > 1 {
 		// todo - select the right makefile from the installerConfig if it exists,
@@ -47,39 +49,57 @@ func (i MakeInstaller) run(makeTarget string, kappObj *kapp.Kapp,
 
 	makefilePath, err := filepath.Abs(makefilePaths[0])
 	if err != nil {
-		return errors.WithStack(err)
+		return "", errors.WithStack(err)
+	}
+
+	return makefilePath, nil
+}
+
+// Returns the env vars describing the target stack that are passed to kapps
+// and hooks
+func baseEnvVars(stackConfig *kapp.StackConfig, approved bool) map[string]string {
+	return map[string]string{
+		"PATH":     os.Getenv("PATH"),
+		"APPROVED": fmt.Sprintf("%v", approved),
+		"CLUSTER":  stackConfig.Cluster,
+		"PROFILE":  stackConfig.Profile,
+		"PROVIDER": stackConfig.Provider,
+	}
+}
+
+// Provider-specific env vars, e.g. the AwsProvider adds REGION
+func addProviderEnvVars(envVars map[string]string, providerImpl provider.Provider) {
+	for k, v := range provider.GetInstallerVars(providerImpl) {
+		upperKey := strings.ToUpper(k)
+		envVars[upperKey] = fmt.Sprintf("%#v", v)
 	}
+}
+
+// Returns the env vars to run a kapp's Makefile with
+func (i MakeInstaller) kappEnvVars(kappObj *kapp.Kapp, stackConfig *kapp.StackConfig,
+	parameterisers []Parameteriser, approved bool, dryRun bool) (map[string]string, error) {
 
 	absKappRoot, err := filepath.Abs(kappObj.RootDir)
 	if err != nil {
-		return errors.WithStack(err)
+		return nil, errors.WithStack(err)
 	}
 
 	// create the env vars
-	envVars := map[string]string{
-		"PATH":      os.Getenv("PATH"),
-		"KAPP_ROOT": absKappRoot,
-		"APPROVED":  fmt.Sprintf("%v", approved),
-		"CLUSTER":   stackConfig.Cluster,
-		"PROFILE":   stackConfig.Profile,
-		"PROVIDER":  stackConfig.Provider,
-	}
+	envVars := baseEnvVars(stackConfig, approved)
+	envVars["KAPP_ROOT"] = absKappRoot
+	// where kapps can describe the changes they plan to make
+	envVars["CHANGES_FILE"] = ChangesFilePath(absKappRoot)
 
 	providerImpl, err := provider.NewProvider(stackConfig)
 	if err != nil {
-		return errors.WithStack(err)
-	}
-
-	parameterisers, err := identifyKappInterfaces(kappObj)
-	if err != nil {
-		return errors.WithStack(err)
+		return nil, errors.WithStack(err)
 	}
 
 	// Adds things like `KUBE_CONTEXT`, `NAMESPACE`, `RELEASE`, etc.
 	for _, parameteriser := range parameterisers {
 		pEnvVars, err := parameteriser.GetEnvVars(provider.GetVars(providerImpl))
 		if err != nil {
-			return errors.WithStack(err)
+			return nil, errors.WithStack(err)
 		}
 
 		for k, v := range pEnvVars {
@@ -87,17 +107,83 @@ func (i MakeInstaller) run(makeTarget string, kappObj *kapp.Kapp,
 		}
 	}
 
-	// Provider-specific env vars, e.g. the AwsProvider adds REGION
-	for k, v := range provider.GetInstallerVars(i.provider) {
-		upperKey := strings.ToUpper(k)
-		envVars[upperKey] = fmt.Sprintf("%#v", v)
+	addProviderEnvVars(envVars, i.provider)
+
+	// Params declared for the kapp in the manifest
+	for k, v := range kappObj.Params {
+		envVars[strings.ToUpper(k)] = v
 	}
 
-	// convert the env vars to a string array
+	// Secrets and env vars declared in the kapp's metadata
+	metadataEnvVars, err := getMetadataEnvVars(kappObj, dryRun)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	for k, v := range metadataEnvVars {
+		envVars[k] = v
+	}
+
+	return envVars, nil
+}
+
+// Converts env vars to the format used by exec.Cmd
+func envVarsToSlice(envVars map[string]string) []string {
 	strEnvVars := make([]string, 0)
 	for k, v := range envVars {
 		strEnvVars = append(strEnvVars, strings.Join([]string{k, v}, "="))
 	}
+	return strEnvVars
+}
+
+// Returns the directory and env vars to run a kapp's hooks with. These are the
+// same as its Makefile is run with.
+func (i MakeInstaller) hookEnv(kappObj *kapp.Kapp, stackConfig *kapp.StackConfig,
+	approved bool, dryRun bool) (string, map[string]string, error) {
+
+	makefilePath, err := findMakefile(kappObj)
+	if err != nil {
+		return "", nil, errors.WithStack(err)
+	}
+
+	parameterisers, err := identifyKappInterfaces(kappObj)
+	if err != nil {
+		return "", nil, errors.WithStack(err)
+	}
+
+	envVars, err := i.kappEnvVars(kappObj, stackConfig, parameterisers, approved, dryRun)
+	if err != nil {
+		return "", nil, errors.WithStack(err)
+	}
+
+	return filepath.Dir(makefilePath), envVars, nil
+}
+
+// Run the given make target
+func (i MakeInstaller) run(ctx context.Context, makeTarget string, kappObj *kapp.Kapp,
+	stackConfig *kapp.StackConfig, approved bool, dryRun bool) error {
+
+	makefilePath, err := findMakefile(kappObj)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	absKappRoot, err := filepath.Abs(kappObj.RootDir)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	parameterisers, err := identifyKappInterfaces(kappObj)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	envVars, err := i.kappEnvVars(kappObj, stackConfig, parameterisers, approved, dryRun)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	strEnvVars := envVarsToSlice(envVars)
 
 	// get additional CLI args
 	validPatternMatches := []string{
@@ -118,30 +204,62 @@ func (i MakeInstaller) run(makeTarget string, kappObj *kapp.Kapp,
 		}
 	}
 
-	// build the command
-	var stdoutBuf, stderrBuf bytes.Buffer
-
 	// make command
 	makeCmd := exec.Command("make", cliArgs...)
 	makeCmd.Dir = filepath.Dir(makefilePath)
 	makeCmd.Env = strEnvVars
-	makeCmd.Stdout = &stdoutBuf
-	makeCmd.Stderr = &stderrBuf
 
 	if dryRun {
 		log.Infof("Dry run. Would install kapp '%s' in directory '%s' "+
-			"with command: %s", kappObj.Id, makeCmd.Dir, makeCmd)
+			"with command: %s", kappObj.FullyQualifiedId(), makeCmd.Dir, makeCmd)
 	} else {
+		planOutputPath := ""
+		if !approved {
+			// stale plans mustn't be mistaken for this run's
+			err = clearPlannedChanges(absKappRoot)
+			if err != nil {
+				return errors.WithStack(err)
+			}
+
+			// stdout is saved so the changes it plans can be found
+			planOutputPath = PlanOutputPath(absKappRoot)
+		}
+
+		// output is streamed to the log and written to the kapp's log files
+		output, err := newKappOutput(i.logDir, kappObj.FullyQualifiedId(),
+			fmt.Sprintf("make %s (APPROVED=%v)", makeTarget, approved), planOutputPath)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		defer output.Close()
+
+		makeCmd.Stdout = output.Stdout
+		makeCmd.Stderr = output.Stderr
+
 		// run it
-		log.Infof("Installing kapp '%s'...", kappObj.Id)
+		log.Infof("Installing kapp '%s'...", kappObj.FullyQualifiedId())
+
+		// make and everything it starts are stopped if the context is cancelled
+		err = runCmd(ctx, makeCmd, i.gracePeriod)
+
+		// flushes partial last lines so they're in the logs and stderr tail
+		closeErr := output.Close()
+		if closeErr != nil {
+			log.Warnf("Error closing the logs of kapp '%s': %s",
+				kappObj.FullyQualifiedId(), closeErr)
+		}
 
-		err := makeCmd.Run()
 		if err != nil {
+			logs := ""
+			if output.logDir != "" {
+				logs = fmt.Sprintf(" Full output is in '%s'.", output.logDir)
+			}
+
 			return errors.Wrapf(err, "Error installing kapp '%s' with "+
-				"command: %s. -- Stdout -- %s -- Stderr -- %s, Err: %s", kappObj.Id,
-				makeCmd, stdoutBuf.String(), stderrBuf.String(), err)
+				"command: %s.%s -- Stderr -- %s",
+				kappObj.FullyQualifiedId(), makeCmd, logs, output.stderrTail())
 		} else {
-			log.Infof("Kapp '%s' successfully %sed", kappObj.Id, makeTarget)
+			log.Infof("Kapp '%s' successfully %sed", kappObj.FullyQualifiedId(), makeTarget)
 		}
 	}
 
@@ -149,13 +267,13 @@ func (i MakeInstaller) run(makeTarget string, kappObj *kapp.Kapp,
 }
 
 // Install a kapp
-func (i MakeInstaller) install(kappObj *kapp.Kapp, stackConfig *kapp.StackConfig,
-	approved bool, dryRun bool) error {
-	return i.run(TARGET_INSTALL, kappObj, stackConfig, approved, dryRun)
+func (i MakeInstaller) install(ctx context.Context, kappObj *kapp.Kapp,
+	stackConfig *kapp.StackConfig, approved bool, dryRun bool) error {
+	return i.run(ctx, TARGET_INSTALL, kappObj, stackConfig, approved, dryRun)
 }
 
 // Destroy a kapp
-func (i MakeInstaller) destroy(kappObj *kapp.Kapp, stackConfig *kapp.StackConfig,
-	approved bool, dryRun bool) error {
-	return i.run(TARGET_DESTROY, kappObj, stackConfig, approved, dryRun)
+func (i MakeInstaller) destroy(ctx context.Context, kappObj *kapp.Kapp,
+	stackConfig *kapp.StackConfig, approved bool, dryRun bool) error {
+	return i.run(ctx, TARGET_DESTROY, kappObj, stackConfig, approved, dryRun)
 }
@@ -1,8 +1,10 @@
 package installer
 
 import (
+	"fmt"
 	"github.com/pkg/errors"
 	"github.com/sugarkube/sugarkube/internal/pkg/kapp"
+	"github.com/sugarkube/sugarkube/internal/pkg/log"
 	"github.com/sugarkube/sugarkube/internal/pkg/provider"
 	"os"
 	"os/user"
@@ -69,9 +71,9 @@ import (
 //            pattern: vars/(\w+).tfvars
 //`
 
-const IMPLEMENTS_HELM = "helm"
-const IMPLEMENTS_TERRAFORM = "terraform"
-const IMPLEMENTS_K8S = "k8s"
+const IMPLEMENTS_HELM = kapp.TYPE_HELM
+const IMPLEMENTS_TERRAFORM = kapp.TYPE_TERRAFORM
+const IMPLEMENTS_K8S = kapp.TYPE_K8S
 
 type Parameteriser struct {
 	Name    string
@@ -85,7 +87,7 @@ func (i *Parameteriser) GetEnvVars(vars provider.Values) (map[string]string, err
 	envVars := make(map[string]string)
 
 	if i.Name == IMPLEMENTS_HELM {
-		envVars["NAMESPACE"] = i.kappObj.Id
+		envVars["NAMESPACE"] = i.kappObj.Namespace()
 		envVars["RELEASE"] = i.kappObj.Id
 
 		// todo - this is a hack. Need to find a place for things like this and
@@ -178,13 +180,28 @@ func (i *Parameteriser) GetCliArgs(validPatternMatches []string) (string, error)
 }
 
 // Examines a kapp to find out what it contains, and therefore what env vars/
-// CLI args need passing to it by an Installer.
+// CLI args need passing to it by an Installer. The types declared in the
+// kapp's metadata are used if there are any, otherwise heuristics are used.
 func identifyKappInterfaces(kappObj *kapp.Kapp) ([]Parameteriser, error) {
 	// todo - parse the above config and test the kapp using it.
-	// todo - also look in the kapp's sugarkube.yaml file if it exists
 
 	parameterisers := make([]Parameteriser, 0)
 
+	if kappObj.Metadata != nil && len(kappObj.Metadata.Implements) > 0 {
+		log.Debugf("Using types declared in metadata for kapp '%s': %s",
+			kappObj.Id, strings.Join(kappObj.Metadata.Implements, ", "))
+
+		for _, kappType := range kappObj.Metadata.Implements {
+			parameterisers = append(parameterisers, Parameteriser{
+				Name: kappType, kappObj: kappObj})
+		}
+
+		return parameterisers, nil
+	}
+
+	log.Debugf("No types declared in metadata for kapp '%s'. Using "+
+		"heuristics to identify it.", kappObj.Id)
+
 	// todo - remove IMPLEMENTS_K8S from this. It's a temporary kludge until we
 	// can get it from the kapp's sugarkube.yaml file
 	parameterisers = append(parameterisers, Parameteriser{
@@ -214,3 +231,40 @@ func identifyKappInterfaces(kappObj *kapp.Kapp) ([]Parameteriser, error) {
 
 	return parameterisers, nil
 }
+
+// Returns the secrets and env vars declared in a kapp's metadata, taking
+// values from the environment. Missing required values are an error unless
+// this is a dry run.
+func getMetadataEnvVars(kappObj *kapp.Kapp, dryRun bool) (map[string]string, error) {
+	envVars := make(map[string]string)
+
+	if kappObj.Metadata == nil {
+		return envVars, nil
+	}
+
+	missing := make([]string, 0)
+
+	for _, spec := range append(append([]kapp.EnvVarSpec{},
+		kappObj.Metadata.Secrets...), kappObj.Metadata.EnvVars...) {
+		if value, ok := os.LookupEnv(spec.Name); ok {
+			envVars[spec.Name] = value
+		} else if spec.Default != "" {
+			envVars[spec.Name] = spec.Default
+		} else if !spec.Optional {
+			missing = append(missing, spec.Name)
+		}
+	}
+
+	if len(missing) > 0 {
+		msg := fmt.Sprintf("Kapp '%s' requires env vars that aren't set: %s",
+			kappObj.FullyQualifiedId(), strings.Join(missing, ", "))
+
+		if !dryRun {
+			return nil, errors.New(msg)
+		}
+
+		log.Warn(msg)
+	}
+
+	return envVars, nil
+}
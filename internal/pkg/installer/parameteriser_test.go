@@ -0,0 +1,57 @@
+package installer
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/sugarkube/sugarkube/internal/pkg/kapp"
+	"os"
+	"testing"
+)
+
+func TestIdentifyKappInterfacesFromMetadata(t *testing.T) {
+	kappObj := &kapp.Kapp{
+		Id: "kappA",
+		Metadata: &kapp.Metadata{
+			Implements: []string{kapp.TYPE_TERRAFORM},
+		},
+	}
+
+	parameterisers, err := identifyKappInterfaces(kappObj)
+	assert.Nil(t, err)
+	assert.Equal(t, []Parameteriser{
+		{Name: IMPLEMENTS_TERRAFORM, kappObj: kappObj},
+	}, parameterisers)
+}
+
+func TestGetMetadataEnvVars(t *testing.T) {
+	kappObj := &kapp.Kapp{
+		Id: "kappA",
+		Metadata: &kapp.Metadata{
+			Secrets: []kapp.EnvVarSpec{
+				{Name: "SUGARKUBE_TEST_SECRET"},
+			},
+			EnvVars: []kapp.EnvVarSpec{
+				{Name: "SUGARKUBE_TEST_DEFAULT", Default: "abc"},
+				{Name: "SUGARKUBE_TEST_OPTIONAL", Optional: true},
+			},
+		},
+	}
+
+	os.Unsetenv("SUGARKUBE_TEST_SECRET")
+
+	_, err := getMetadataEnvVars(kappObj, false)
+	assert.Error(t, err, "expected an error for a missing secret")
+
+	envVars, err := getMetadataEnvVars(kappObj, true)
+	assert.Nil(t, err, "missing secrets shouldn't be an error on dry runs")
+	assert.Equal(t, map[string]string{"SUGARKUBE_TEST_DEFAULT": "abc"}, envVars)
+
+	os.Setenv("SUGARKUBE_TEST_SECRET", "secret")
+	defer os.Unsetenv("SUGARKUBE_TEST_SECRET")
+
+	envVars, err = getMetadataEnvVars(kappObj, false)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{
+		"SUGARKUBE_TEST_SECRET":  "secret",
+		"SUGARKUBE_TEST_DEFAULT": "abc",
+	}, envVars)
+}
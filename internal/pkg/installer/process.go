@@ -0,0 +1,79 @@
+package installer
+
+import (
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/sugarkube/sugarkube/internal/pkg/log"
+	"os/exec"
+	"time"
+)
+
+// Returned when a command was stopped because its context was cancelled
+type InterruptedError struct {
+	// the command that was stopped
+	Command string
+	// whether it had to be killed because it didn't exit in the grace period
+	Killed bool
+	// why the context was cancelled
+	Cause error
+}
+
+func (e *InterruptedError) Error() string {
+	if e.Killed {
+		return fmt.Sprintf("Killed '%s' after it didn't exit in the grace "+
+			"period (%s)", e.Command, e.Cause)
+	}
+	return fmt.Sprintf("Terminated '%s' (%s)", e.Command, e.Cause)
+}
+
+// Runs a command in its own process group so the processes it starts (e.g.
+// terraform, helm) can be stopped along with it. If the context is cancelled
+// the group is sent SIGTERM, then SIGKILL if it's still running after the
+// grace period.
+func runCmd(ctx context.Context, cmd *exec.Cmd, gracePeriod time.Duration) error {
+	setProcessGroup(cmd)
+
+	err := cmd.Start()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	select {
+	case err = <-done:
+		return err
+	case <-ctx.Done():
+	}
+
+	interruptedErr := &InterruptedError{
+		Command: cmd.Path,
+		Cause:   ctx.Err(),
+	}
+
+	pid := cmd.Process.Pid
+	log.Warnf("Sending SIGTERM to process group %d of '%s'", pid, cmd.Path)
+	err = terminateProcessGroup(pid)
+	if err != nil {
+		log.Warnf("Error sending SIGTERM to process group %d: %s", pid, err)
+	}
+
+	select {
+	case <-done:
+	case <-time.After(gracePeriod):
+		log.Warnf("Process group %d didn't exit within %s. Sending SIGKILL",
+			pid, gracePeriod)
+		err = killProcessGroup(pid)
+		if err != nil {
+			log.Warnf("Error sending SIGKILL to process group %d: %s", pid, err)
+		}
+		interruptedErr.Killed = true
+		<-done
+	}
+
+	return errors.WithStack(interruptedErr)
+}
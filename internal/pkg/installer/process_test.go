@@ -0,0 +1,77 @@
+// +build !windows
+
+package installer
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+func TestRunCmd(t *testing.T) {
+	tests := []struct {
+		name           string
+		desc           string
+		script         string
+		cancel         bool
+		expectedErr    bool
+		expectedKilled bool
+	}{
+		{
+			name:   "finished",
+			desc:   "commands that finish should be left alone",
+			script: "exit 0",
+		},
+		{
+			name:        "failed",
+			desc:        "errors from commands should be returned",
+			script:      "exit 2",
+			expectedErr: true,
+		},
+		{
+			name:        "terminated",
+			desc:        "commands that exit on SIGTERM shouldn't be killed",
+			script:      "sleep 30 & wait",
+			cancel:      true,
+			expectedErr: true,
+		},
+		{
+			name:           "killed",
+			desc:           "commands that ignore SIGTERM should be killed after the grace period",
+			script:         "trap '' TERM; sleep 30 & wait; sleep 30",
+			cancel:         true,
+			expectedErr:    true,
+			expectedKilled: true,
+		},
+	}
+
+	for _, test := range tests {
+		ctx, cancel := context.WithCancel(context.Background())
+		if test.cancel {
+			time.AfterFunc(200*time.Millisecond, cancel)
+		}
+
+		start := time.Now()
+		err := runCmd(ctx, exec.Command("sh", "-c", test.script), 500*time.Millisecond)
+		cancel()
+
+		assert.True(t, time.Since(start) < 10*time.Second,
+			"unexpected delay for test '%s'", test.name)
+
+		if !test.expectedErr {
+			assert.Nil(t, err, "unexpected error for test '%s'", test.name)
+			continue
+		}
+
+		assert.Error(t, err, test.desc)
+
+		interruptedErr, ok := errors.Cause(err).(*InterruptedError)
+		assert.Equal(t, test.cancel, ok, test.desc)
+		if ok {
+			assert.Equal(t, test.expectedKilled, interruptedErr.Killed, test.desc)
+		}
+	}
+}
@@ -0,0 +1,23 @@
+// +build !windows
+
+package installer
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// Starts the command as the leader of a new process group. This also stops
+// signals sent to sugarkube's group by the terminal (e.g. Ctrl-C) reaching the
+// command directly, so sugarkube decides how to stop it.
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+func terminateProcessGroup(pid int) error {
+	return syscall.Kill(-pid, syscall.SIGTERM)
+}
+
+func killProcessGroup(pid int) error {
+	return syscall.Kill(-pid, syscall.SIGKILL)
+}
@@ -0,0 +1,24 @@
+// +build windows
+
+package installer
+
+import (
+	"os"
+	"os/exec"
+)
+
+// Process groups can't be signalled on windows so only the command itself
+// can be stopped
+func setProcessGroup(cmd *exec.Cmd) {}
+
+func terminateProcessGroup(pid int) error {
+	return killProcessGroup(pid)
+}
+
+func killProcessGroup(pid int) error {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+	return process.Kill()
+}
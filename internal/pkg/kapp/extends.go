@@ -0,0 +1,226 @@
+package kapp
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/sugarkube/sugarkube/internal/pkg/log"
+	"strings"
+)
+
+// Stacks can inherit settings from another stack in the same file with
+// `extends: <stack name>`. Settings are merged as follows:
+//   - scalar settings (provider, cluster, etc.) in the child replace the parent's
+//   - vars dirs and ignored kapps in the child are appended to the parent's
+//   - manifests with the same ID as one in the parent replace it in place,
+//     manifests with `remove: true` remove the parent's manifest with that ID
+//     and all others are appended
+const EXTENDS_KEY = "extends"
+const VARS_KEY = "vars"
+const MANIFESTS_KEY = "manifests"
+const MANIFEST_ID_KEY = "id"
+const MANIFEST_URI_KEY = "uri"
+const MANIFEST_REMOVE_KEY = "remove"
+
+// Returns the data for a stack after merging in the data of any stacks it
+// extends. `chain` contains the names of stacks that extend this one so
+// cycles can be detected.
+func resolveStackData(name string, data map[string]interface{},
+	chain []string) (map[interface{}]interface{}, error) {
+
+	for _, seen := range chain {
+		if seen == name {
+			return nil, errors.New(fmt.Sprintf("Stack inheritance cycle: %s",
+				strings.Join(append(chain, name), " -> ")))
+		}
+	}
+
+	rawStack, ok := data[name]
+	if !ok {
+		if len(chain) == 0 {
+			return nil, errors.New(fmt.Sprintf("No stack called '%s' found", name))
+		}
+
+		return nil, errors.New(fmt.Sprintf("Stack '%s' extends '%s' which "+
+			"doesn't exist", chain[len(chain)-1], name))
+	}
+
+	stack, ok := rawStack.(map[interface{}]interface{})
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("Stack '%s' should be a map", name))
+	}
+
+	parentName, ok := stack[EXTENDS_KEY]
+	if !ok {
+		return stack, nil
+	}
+
+	parentNameStr, ok := parentName.(string)
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("The value of '%s' in stack '%s' "+
+			"should be a stack name", EXTENDS_KEY, name))
+	}
+
+	log.Debugf("Stack '%s' extends '%s'", name, parentNameStr)
+
+	parent, err := resolveStackData(parentNameStr, data, append(chain, name))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	merged, err := mergeStackData(parent, stack)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Error merging stack '%s' into '%s'",
+			parentNameStr, name)
+	}
+
+	return merged, nil
+}
+
+// Merges the data of a child stack into a copy of its parent's
+func mergeStackData(parent map[interface{}]interface{},
+	child map[interface{}]interface{}) (map[interface{}]interface{}, error) {
+
+	merged := map[interface{}]interface{}{}
+
+	for k, v := range parent {
+		merged[k] = v
+	}
+
+	for k, v := range child {
+		switch k {
+		case EXTENDS_KEY:
+			continue
+		case VARS_KEY, IGNORED_KEY:
+			values, err := mergeLists(k.(string), parent[k], v)
+			if err != nil {
+				return nil, errors.WithStack(err)
+			}
+			merged[k] = values
+		case MANIFESTS_KEY:
+			manifests, err := mergeManifestEntries(parent[k], v)
+			if err != nil {
+				return nil, errors.WithStack(err)
+			}
+			merged[k] = manifests
+		default:
+			merged[k] = v
+		}
+	}
+
+	return merged, nil
+}
+
+// Appends the values of a child's list setting to the parent's, skipping
+// duplicates
+func mergeLists(key string, parent interface{}, child interface{}) ([]interface{}, error) {
+	merged := make([]interface{}, 0)
+	seen := map[interface{}]bool{}
+
+	for _, values := range []interface{}{parent, child} {
+		if values == nil {
+			continue
+		}
+
+		valueList, ok := values.([]interface{})
+		if !ok {
+			return nil, errors.New(fmt.Sprintf("'%s' should be a list", key))
+		}
+
+		for _, value := range valueList {
+			if seen[value] {
+				continue
+			}
+			seen[value] = true
+			merged = append(merged, value)
+		}
+	}
+
+	return merged, nil
+}
+
+// Merges the child's manifest entries into the parent's by manifest ID
+func mergeManifestEntries(parent interface{}, child interface{}) ([]interface{}, error) {
+	merged := make([]interface{}, 0)
+
+	if parent != nil {
+		parentList, ok := parent.([]interface{})
+		if !ok {
+			return nil, errors.New(fmt.Sprintf("'%s' should be a list", MANIFESTS_KEY))
+		}
+		merged = append(merged, parentList...)
+	}
+
+	if child == nil {
+		return merged, nil
+	}
+
+	childList, ok := child.([]interface{})
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("'%s' should be a list", MANIFESTS_KEY))
+	}
+
+	for _, entry := range childList {
+		id, err := manifestEntryId(entry)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		index := -1
+		for i, parentEntry := range merged {
+			parentId, err := manifestEntryId(parentEntry)
+			if err != nil {
+				return nil, errors.WithStack(err)
+			}
+
+			if parentId == id {
+				index = i
+				break
+			}
+		}
+
+		if entry.(map[interface{}]interface{})[MANIFEST_REMOVE_KEY] == true {
+			if index < 0 {
+				return nil, errors.New(fmt.Sprintf("Can't remove manifest '%s' "+
+					"because the parent stack doesn't contain it", id))
+			}
+
+			log.Debugf("Removing inherited manifest '%s'", id)
+			merged = append(merged[:index], merged[index+1:]...)
+			continue
+		}
+
+		if index < 0 {
+			merged = append(merged, entry)
+		} else {
+			log.Debugf("Replacing inherited manifest '%s'", id)
+			merged[index] = entry
+		}
+	}
+
+	return merged, nil
+}
+
+// Returns the ID a manifest entry in a stack will have once loaded
+func manifestEntryId(entry interface{}) (string, error) {
+	entryMap, ok := entry.(map[interface{}]interface{})
+	if !ok {
+		return "", errors.New(fmt.Sprintf("Manifest entries should be maps. "+
+			"Got: %#v", entry))
+	}
+
+	id, _ := entryMap[MANIFEST_ID_KEY].(string)
+	uri, _ := entryMap[MANIFEST_URI_KEY].(string)
+
+	if id == "" && uri == "" {
+		return "", errors.New(fmt.Sprintf("Manifest entries need a '%s' or "+
+			"an '%s'. Got: %#v", MANIFEST_URI_KEY, MANIFEST_ID_KEY, entry))
+	}
+
+	manifest := Manifest{
+		Id:  id,
+		Uri: uri,
+	}
+	SetManifestDefaults(&manifest)
+
+	return manifest.Id, nil
+}
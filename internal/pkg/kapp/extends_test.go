@@ -0,0 +1,129 @@
+package kapp
+
+import (
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v2"
+	"testing"
+)
+
+func TestMergeStackData(t *testing.T) {
+	tests := []struct {
+		name          string
+		desc          string
+		parent        string
+		child         string
+		expectValues  string
+		expectedError bool
+	}{
+		{
+			name: "good_scalars_and_vars",
+			desc: "check scalars are replaced and vars dirs are appended",
+			parent: `
+provider: local
+cluster: standard
+vars:
+- providers/
+`,
+			child: `
+extends: parent
+cluster: large
+vars:
+- providers/
+- vars/
+`,
+			expectValues: `
+provider: local
+cluster: large
+vars:
+- providers/
+- vars/
+`,
+		},
+		{
+			name: "good_manifests",
+			desc: "check manifests are replaced, removed and appended by ID",
+			parent: `
+manifests:
+- uri: manifests/05-k8s-bootstrap.yaml
+- uri: manifests/10-core-services.yaml
+- uri: manifests/40-wordpress-sites.yaml
+`,
+			child: `
+manifests:
+- uri: manifests/05-k8s-bootstrap.yaml
+  when: provider == "aws"
+- id: 40-wordpress-sites
+  remove: true
+- uri: manifests/30-ci-cd.yaml
+- uri: manifests/40-wordpress-sites.yaml
+  id: web
+`,
+			expectValues: `
+manifests:
+- uri: manifests/05-k8s-bootstrap.yaml
+  when: provider == "aws"
+- uri: manifests/10-core-services.yaml
+- uri: manifests/30-ci-cd.yaml
+- uri: manifests/40-wordpress-sites.yaml
+  id: web
+`,
+		},
+		{
+			name: "error_remove_missing",
+			desc: "check removing a manifest the parent doesn't have is an error",
+			parent: `
+manifests:
+- uri: manifests/05-k8s-bootstrap.yaml
+`,
+			child: `
+manifests:
+- id: 10-core-services
+  remove: true
+`,
+			expectedError: true,
+		},
+	}
+
+	for _, test := range tests {
+		parent := map[interface{}]interface{}{}
+		assert.Nil(t, yaml.Unmarshal([]byte(test.parent), parent))
+
+		child := map[interface{}]interface{}{}
+		assert.Nil(t, yaml.Unmarshal([]byte(test.child), child))
+
+		result, err := mergeStackData(parent, child)
+		if test.expectedError {
+			assert.NotNil(t, err, "expected an error for %s", test.name)
+		} else {
+			assert.Nil(t, err, "unexpected error for %s", test.name)
+
+			expected := map[interface{}]interface{}{}
+			assert.Nil(t, yaml.Unmarshal([]byte(test.expectValues), expected))
+
+			assert.Equal(t, expected, result, "unexpected result for %s", test.name)
+		}
+	}
+}
+
+func TestLoadStackConfigExtends(t *testing.T) {
+	actual, err := LoadStackConfig("large-extended", "../../testdata/stacks.yaml")
+	assert.Nil(t, err)
+
+	assert.Equal(t, "large-extended", actual.Name)
+	assert.Equal(t, "minikube", actual.Provisioner)
+	assert.Equal(t, "large2", actual.Cluster)
+	assert.Equal(t, []string{"./stacks/", "./extra/"}, actual.VarsFilesDirs)
+
+	manifestIds := make([]string, 0)
+	for _, manifest := range actual.Manifests {
+		manifestIds = append(manifestIds, manifest.Id)
+	}
+
+	assert.Equal(t, []string{"exampleManifest2", "renamedManifest1"}, manifestIds)
+}
+
+func TestLoadStackConfigExtendsCycle(t *testing.T) {
+	_, err := LoadStackConfig("cycle-a", "../../testdata/stacks.yaml")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "cycle-a -> cycle-b -> cycle-a")
+}
@@ -0,0 +1,175 @@
+package kapp
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// Hooks run commands or make targets before and after kapps are installed or
+// destroyed. They can be declared for a stack, a manifest or a kapp, e.g.:
+//
+//   hooks:
+//     pre_install:
+//     - command: ./snapshot-db.sh
+//     post_install:
+//     - target: notify
+//       on_error: continue
+//     on_failure:
+//     - command: ./page-someone.sh
+//
+// Hooks only run when changes are applied (APPROVED=true) unless they set
+// `on_plan: true`, in which case they also run when changes are planned.
+
+const HOOKS_KEY = "hooks"
+
+// Events hooks can run on
+const HOOK_PRE_INSTALL = "pre_install"
+const HOOK_POST_INSTALL = "post_install"
+const HOOK_PRE_DESTROY = "pre_destroy"
+const HOOK_POST_DESTROY = "post_destroy"
+const HOOK_ON_FAILURE = "on_failure"
+
+// What to do when a hook fails
+//   - fail: fails whatever the hook was run for. Hooks run before an action
+//     stop it from running.
+//   - continue: logs the error and carries on
+const HOOK_ON_ERROR_FAIL = "fail"
+const HOOK_ON_ERROR_CONTINUE = "continue"
+
+type Hook struct {
+	// a shell command to run
+	Command string `yaml:"command,omitempty"`
+	// a make target to run
+	Target string `yaml:"target,omitempty"`
+	// defaults to HOOK_ON_ERROR_FAIL
+	OnError string `yaml:"on_error,omitempty"`
+	// also run the hook when changes are only planned
+	OnPlan bool `yaml:"on_plan,omitempty"`
+}
+
+// Returns a description of the hook for logs
+func (h Hook) String() string {
+	if h.Target != "" {
+		return fmt.Sprintf("make %s", h.Target)
+	}
+	return h.Command
+}
+
+// Returns whether a failure of the hook should fail whatever it's run for
+func (h Hook) FailsOnError() bool {
+	return h.OnError != HOOK_ON_ERROR_CONTINUE
+}
+
+type Hooks struct {
+	PreInstall  []Hook `yaml:"pre_install,omitempty"`
+	PostInstall []Hook `yaml:"post_install,omitempty"`
+	PreDestroy  []Hook `yaml:"pre_destroy,omitempty"`
+	PostDestroy []Hook `yaml:"post_destroy,omitempty"`
+	OnFailure   []Hook `yaml:"on_failure,omitempty"`
+}
+
+// Returns the hooks for an event
+func (h Hooks) For(event string) []Hook {
+	switch event {
+	case HOOK_PRE_INSTALL:
+		return h.PreInstall
+	case HOOK_POST_INSTALL:
+		return h.PostInstall
+	case HOOK_PRE_DESTROY:
+		return h.PreDestroy
+	case HOOK_POST_DESTROY:
+		return h.PostDestroy
+	case HOOK_ON_FAILURE:
+		return h.OnFailure
+	}
+	return nil
+}
+
+// Returns the hooks to run for an event when changes are applied, or only
+// those that opted in with on_plan when they're planned
+func (h Hooks) ForPass(event string, approved bool) []Hook {
+	hooks := h.For(event)
+	if approved {
+		return hooks
+	}
+
+	planHooks := make([]Hook, 0)
+	for _, hook := range hooks {
+		if hook.OnPlan {
+			planHooks = append(planHooks, hook)
+		}
+	}
+
+	return planHooks
+}
+
+// Returns whether no hooks are declared
+func (h Hooks) IsEmpty() bool {
+	for _, event := range []string{HOOK_PRE_INSTALL, HOOK_POST_INSTALL,
+		HOOK_PRE_DESTROY, HOOK_POST_DESTROY, HOOK_ON_FAILURE} {
+		if len(h.For(event)) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns the events to run hooks on before and after installing or
+// destroying something
+func HookEvents(install bool) (string, string) {
+	if install {
+		return HOOK_PRE_INSTALL, HOOK_POST_INSTALL
+	}
+	return HOOK_PRE_DESTROY, HOOK_POST_DESTROY
+}
+
+// Parses a hooks block
+func parseHooks(v interface{}) (Hooks, error) {
+	hooks := Hooks{}
+	if v == nil {
+		return hooks, nil
+	}
+
+	// marshal and unmarshal it to get the structure checked
+	hooksBytes, err := yaml.Marshal(v)
+	if err != nil {
+		return hooks, errors.WithStack(err)
+	}
+
+	err = yaml.UnmarshalStrict(hooksBytes, &hooks)
+	if err != nil {
+		return hooks, errors.Wrapf(err, "Error parsing %s", HOOKS_KEY)
+	}
+
+	problems := validateHooks(hooks)
+	if len(problems) > 0 {
+		return hooks, errors.New(problems[0])
+	}
+
+	return hooks, nil
+}
+
+// Returns problems with hooks
+func validateHooks(hooks Hooks) []string {
+	problems := make([]string, 0)
+
+	for _, event := range []string{HOOK_PRE_INSTALL, HOOK_POST_INSTALL,
+		HOOK_PRE_DESTROY, HOOK_POST_DESTROY, HOOK_ON_FAILURE} {
+		for _, hook := range hooks.For(event) {
+			if (hook.Command == "") == (hook.Target == "") {
+				problems = append(problems, fmt.Sprintf("%s hooks need "+
+					"either a command or a target. Got: %#v", event, hook))
+			}
+
+			if hook.OnError != "" && hook.OnError != HOOK_ON_ERROR_FAIL &&
+				hook.OnError != HOOK_ON_ERROR_CONTINUE {
+				problems = append(problems, fmt.Sprintf("Invalid on_error "+
+					"'%s' for %s hook '%s'. Use '%s' or '%s'", hook.OnError,
+					event, hook, HOOK_ON_ERROR_FAIL, HOOK_ON_ERROR_CONTINUE))
+			}
+		}
+	}
+
+	return problems
+}
@@ -0,0 +1,111 @@
+package kapp
+
+import (
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v2"
+	"testing"
+)
+
+func TestParseHooks(t *testing.T) {
+	tests := []struct {
+		name          string
+		desc          string
+		input         string
+		expected      Hooks
+		expectedError bool
+	}{
+		{
+			name: "good",
+			desc: "commands and targets should be parsed for each event",
+			input: `
+pre_install:
+- command: ./snapshot.sh
+- command: ./login.sh
+  on_plan: true
+post_install:
+- target: notify
+  on_error: continue
+pre_destroy:
+- command: echo bye
+post_destroy:
+- target: cleanup
+on_failure:
+- command: ./page.sh
+`,
+			expected: Hooks{
+				PreInstall: []Hook{{Command: "./snapshot.sh"},
+					{Command: "./login.sh", OnPlan: true}},
+				PostInstall: []Hook{{Target: "notify", OnError: HOOK_ON_ERROR_CONTINUE}},
+				PreDestroy:  []Hook{{Command: "echo bye"}},
+				PostDestroy: []Hook{{Target: "cleanup"}},
+				OnFailure:   []Hook{{Command: "./page.sh"}},
+			},
+		},
+		{
+			name:          "error_command_and_target",
+			desc:          "hooks can't have both a command and a target",
+			input:         "pre_install:\n- command: ls\n  target: install\n",
+			expectedError: true,
+		},
+		{
+			name:          "error_empty",
+			desc:          "hooks need a command or a target",
+			input:         "pre_install:\n- on_error: continue\n",
+			expectedError: true,
+		},
+		{
+			name:          "error_bad_on_error",
+			desc:          "on_error must be a known policy",
+			input:         "pre_install:\n- command: ls\n  on_error: ignore\n",
+			expectedError: true,
+		},
+		{
+			name:          "error_unknown_event",
+			desc:          "unknown events are an error",
+			input:         "pre_upgrade:\n- command: ls\n",
+			expectedError: true,
+		},
+	}
+
+	for _, test := range tests {
+		data := map[interface{}]interface{}{}
+		err := yaml.Unmarshal([]byte(test.input), data)
+		assert.Nil(t, err)
+
+		actual, err := parseHooks(data)
+		if test.expectedError {
+			assert.Error(t, err, test.desc)
+		} else {
+			assert.Nil(t, err, test.desc)
+			assert.Equal(t, test.expected, actual, test.desc)
+		}
+	}
+}
+
+func TestHooksFor(t *testing.T) {
+	hooks := Hooks{
+		PreDestroy: []Hook{{Command: "ls"}},
+	}
+
+	assert.False(t, hooks.IsEmpty())
+	assert.Equal(t, []Hook{{Command: "ls"}}, hooks.For(HOOK_PRE_DESTROY))
+	assert.Nil(t, hooks.For(HOOK_PRE_INSTALL))
+	assert.True(t, Hooks{}.IsEmpty())
+
+	pre, post := HookEvents(false)
+	assert.Equal(t, HOOK_PRE_DESTROY, pre)
+	assert.Equal(t, HOOK_POST_DESTROY, post)
+}
+
+func TestHooksForPass(t *testing.T) {
+	hooks := Hooks{
+		PreInstall: []Hook{{Command: "./snapshot.sh"}, {Command: "./login.sh", OnPlan: true}},
+	}
+
+	assert.Equal(t, hooks.PreInstall, hooks.ForPass(HOOK_PRE_INSTALL, true),
+		"all hooks should run when changes are applied")
+	assert.Equal(t, []Hook{{Command: "./login.sh", OnPlan: true}},
+		hooks.ForPass(HOOK_PRE_INSTALL, false),
+		"only hooks that opted in should run when changes are planned")
+	assert.Empty(t, hooks.ForPass(HOOK_POST_INSTALL, false))
+}
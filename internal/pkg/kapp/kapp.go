@@ -1,12 +1,15 @@
 package kapp
 
 import (
+	"fmt"
 	"github.com/pkg/errors"
 	"github.com/sugarkube/sugarkube/internal/pkg/acquirer"
 	"github.com/sugarkube/sugarkube/internal/pkg/convert"
 	"github.com/sugarkube/sugarkube/internal/pkg/log"
 	"gopkg.in/yaml.v2"
 	"sort"
+	"strings"
+	"time"
 )
 
 type installerConfig struct {
@@ -15,8 +18,24 @@ type installerConfig struct {
 	params       map[string]string
 }
 
+// Settings from a kapp's `installer` block controlling how it's run. Unset
+// settings use the defaults from the config.
+type InstallerSettings struct {
+	// how long each attempt can take. 0 means unset.
+	Timeout time.Duration
+	// how many times to retry after a failed attempt. nil means unset.
+	Retries *int
+	// delay before the first retry, doubled for each retry after it. 0 means
+	// unset.
+	Backoff time.Duration
+	// commands or make targets to run around the kapp's installer
+	Hooks Hooks
+}
+
 type Kapp struct {
 	Id string
+	// ID of the manifest the kapp is declared in
+	manifestId string
 	// if true, this kapp should be present after completing, otherwise it
 	// should be absent. This is here instead of e.g. putting all kapps into
 	// an enclosing struct with 'present' and 'absent' properties so we can
@@ -26,103 +45,556 @@ type Kapp struct {
 	installerConfig installerConfig
 	Sources         []acquirer.Acquirer
 	RootDir         string // root directory in a cache dir
+	// optional expression that must evaluate to true for this kapp to be
+	// included in a plan, e.g. `provider == "aws"`
+	When string
+	// loaded from the kapp's `sugarkube.yaml` file once it's been cached
+	Metadata *Metadata
+	// name of a template in the manifest this kapp is an instance of
+	Template string
+	// names of sources inherited from the template
+	sharedSources []string
+	namespace     string
+	// extra parameters to pass to the installer as env vars
+	Params map[string]string
+	// timeouts and retries for the installer
+	Installer InstallerSettings
+	// arbitrary labels kapps can be selected by, e.g. `database`
+	Labels []string
+	// refs of kapps this kapp needs, e.g. `data:postgres`. They're pulled in
+	// when selecting kapps with dependencies.
+	DependsOn []string
 }
 
 const PRESENT_KEY = "present"
 const ABSENT_KEY = "absent"
 const SOURCES_KEY = "sources"
+const WHEN_KEY = "when"
+const TEMPLATES_KEY = "templates"
+const TEMPLATE_KEY = "template"
+const NAMESPACE_KEY = "namespace"
+const PARAMS_KEY = "params"
+const IGNORED_KEY = "ignored"
+const INSTALLER_KEY = "installer"
+const LABELS_KEY = "labels"
+const DEPENDS_ON_KEY = "depends_on"
+
+// keys in a kapp's installer block
+const TIMEOUT_KEY = "timeout"
+const RETRIES_KEY = "retries"
+const BACKOFF_KEY = "backoff"
 
 // Parses kapps and adds them to an array
-func parseKapps(kapps *[]Kapp, kappDefinitions map[interface{}]interface{}, shouldBePresent bool) error {
+func parseKapps(kapps *[]Kapp, kappDefinitions map[interface{}]interface{},
+	shouldBePresent bool, templates map[string]Kapp) error {
+
+	parsedKapps := make([]Kapp, 0)
 
 	// parse each kapp definition
 	for k, v := range kappDefinitions {
-		kapp := Kapp{
-			Id:              k.(string),
-			ShouldBePresent: shouldBePresent,
+		id, ok := k.(string)
+		if !ok {
+			return errors.New(fmt.Sprintf("Kapp IDs must be strings. Got: %#v", k))
+		}
+
+		kapp, err := parseKapp(id, v)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		kapp.ShouldBePresent = shouldBePresent
+
+		if kapp.Template != "" {
+			template, ok := templates[kapp.Template]
+			if !ok {
+				return errors.New(fmt.Sprintf("Kapp '%s' uses template '%s' "+
+					"which isn't defined", kapp.Id, kapp.Template))
+			}
+
+			kapp = applyTemplate(kapp, template)
 		}
 
-		log.Debugf("kapp=%s, v=%#v", kapp, v)
+		log.Debugf("Parsed kapp=%#v", kapp)
+
+		parsedKapps = append(parsedKapps, kapp)
+	}
+
+	// kapps are defined in a map so sort them for determinism
+	sort.Slice(parsedKapps, func(i, j int) bool {
+		return parsedKapps[i].Id < parsedKapps[j].Id
+	})
+
+	*kapps = append(*kapps, parsedKapps...)
+
+	return nil
+}
+
+// Parses kapp templates into a map keyed by template name
+func parseTemplates(templateDefinitions map[interface{}]interface{}) (map[string]Kapp, error) {
+	templates := map[string]Kapp{}
+
+	for k, v := range templateDefinitions {
+		id, ok := k.(string)
+		if !ok {
+			return nil, errors.New(fmt.Sprintf("Template names must be strings. "+
+				"Got: %#v", k))
+		}
 
-		// parse the list of sources
-		valuesMap, err := convert.MapInterfaceInterfaceToMapStringInterface(v.(map[interface{}]interface{}))
+		template, err := parseKapp(id, v)
 		if err != nil {
-			return errors.Wrapf(err, "Error converting manifest value to map")
+			return nil, errors.Wrapf(err, "Error parsing template '%s'", k)
+		}
+
+		if template.Template != "" {
+			return nil, errors.New(fmt.Sprintf("Template '%s' can't use "+
+				"another template", template.Id))
+		}
+
+		templates[template.Id] = template
+	}
+
+	return templates, nil
+}
+
+// Parses a single kapp definition
+func parseKapp(id string, v interface{}) (Kapp, error) {
+	kapp := Kapp{
+		Id: id,
+	}
+
+	log.Debugf("kapp=%s, v=%#v", kapp, v)
+
+	definition, ok := v.(map[interface{}]interface{})
+	if !ok {
+		return kapp, errors.New(fmt.Sprintf("The definition of kapp '%s' "+
+			"must be a map", id))
+	}
+
+	// parse the list of sources
+	valuesMap, err := convert.MapInterfaceInterfaceToMapStringInterface(definition)
+	if err != nil {
+		return kapp, errors.Wrapf(err, "Error converting manifest value to map")
+	}
+
+	for _, key := range []string{WHEN_KEY, TEMPLATE_KEY, NAMESPACE_KEY} {
+		value, ok := valuesMap[key]
+		if !ok {
+			continue
+		}
+
+		strValue, ok := value.(string)
+		if !ok {
+			return kapp, errors.New(fmt.Sprintf("The '%s' setting for kapp '%s' "+
+				"must be a string", key, kapp.Id))
+		}
+
+		switch key {
+		case WHEN_KEY:
+			kapp.When = strValue
+		case TEMPLATE_KEY:
+			kapp.Template = strValue
+		case NAMESPACE_KEY:
+			kapp.namespace = strValue
+		}
+	}
+
+	if params, ok := valuesMap[PARAMS_KEY]; ok {
+		paramsMap, ok := params.(map[interface{}]interface{})
+		if !ok {
+			return kapp, errors.New(fmt.Sprintf("The '%s' setting for kapp '%s' "+
+				"must be a map", PARAMS_KEY, kapp.Id))
 		}
 
-		// marshal and unmarshal the list of sources
-		sourcesBytes, err := yaml.Marshal(valuesMap[SOURCES_KEY])
+		kapp.Params, err = convert.MapInterfaceInterfaceToMapStringString(paramsMap)
 		if err != nil {
-			return errors.Wrapf(err, "Error marshalling sources yaml: %#v", v)
+			return kapp, errors.WithStack(err)
 		}
+	}
+
+	if installer, ok := valuesMap[INSTALLER_KEY]; ok {
+		kapp.Installer, err = parseInstallerSettings(kapp.Id, installer)
+		if err != nil {
+			return kapp, errors.WithStack(err)
+		}
+	}
 
-		log.Debugf("Marshalled sources YAML: %s", sourcesBytes)
+	for _, key := range []string{LABELS_KEY, DEPENDS_ON_KEY} {
+		value, ok := valuesMap[key]
+		if !ok || value == nil {
+			continue
+		}
 
-		sourcesMaps := []map[interface{}]interface{}{}
-		err = yaml.UnmarshalStrict(sourcesBytes, &sourcesMaps)
+		list, err := parseStringList(value)
 		if err != nil {
-			return errors.Wrapf(err, "Error unmarshalling yaml: %s", sourcesBytes)
+			return kapp, errors.Wrapf(err, "The '%s' setting for kapp '%s' "+
+				"must be a list of strings", key, kapp.Id)
 		}
 
-		log.Debugf("sourcesMaps=%#v", sourcesMaps)
+		if key == LABELS_KEY {
+			kapp.Labels = list
+		} else {
+			kapp.DependsOn = list
+		}
+	}
 
-		acquirers := make([]acquirer.Acquirer, 0)
-		// now we have a list of sources, get the acquirer for each one
-		for _, sourceMap := range sourcesMaps {
-			sourceStringMap, err := convert.MapInterfaceInterfaceToMapStringString(sourceMap)
-			if err != nil {
-				return errors.WithStack(err)
+	// marshal and unmarshal the list of sources
+	sourcesBytes, err := yaml.Marshal(valuesMap[SOURCES_KEY])
+	if err != nil {
+		return kapp, errors.Wrapf(err, "Error marshalling sources yaml: %#v", v)
+	}
+
+	log.Debugf("Marshalled sources YAML: %s", sourcesBytes)
+
+	sourcesMaps := []map[interface{}]interface{}{}
+	err = yaml.UnmarshalStrict(sourcesBytes, &sourcesMaps)
+	if err != nil {
+		return kapp, errors.Wrapf(err, "Error unmarshalling yaml: %s", sourcesBytes)
+	}
+
+	log.Debugf("sourcesMaps=%#v", sourcesMaps)
+
+	acquirers := make([]acquirer.Acquirer, 0)
+	// now we have a list of sources, get the acquirer for each one
+	for _, sourceMap := range sourcesMaps {
+		sourceStringMap, err := convert.MapInterfaceInterfaceToMapStringString(sourceMap)
+		if err != nil {
+			return kapp, errors.WithStack(err)
+		}
+
+		acquirerImpl, err := acquirer.NewAcquirer(sourceStringMap)
+		if err != nil {
+			return kapp, errors.WithStack(err)
+		}
+
+		log.Debugf("Got acquirer %#v", acquirerImpl)
+
+		acquirers = append(acquirers, acquirerImpl)
+	}
+
+	sortAcquirers(acquirers)
+
+	kapp.Sources = acquirers
+
+	return kapp, nil
+}
+
+// Parses a kapp's installer block
+func parseInstallerSettings(id string, v interface{}) (InstallerSettings, error) {
+	settings := InstallerSettings{}
+
+	installerMap, ok := v.(map[interface{}]interface{})
+	if !ok {
+		return settings, errors.New(fmt.Sprintf("The '%s' setting for kapp '%s' "+
+			"must be a map", INSTALLER_KEY, id))
+	}
+
+	for k, value := range installerMap {
+		switch k {
+		case TIMEOUT_KEY, BACKOFF_KEY:
+			strValue, ok := value.(string)
+			if !ok {
+				return settings, errors.New(fmt.Sprintf("The installer '%s' "+
+					"for kapp '%s' must be a duration, e.g. '10m'", k, id))
+			}
+
+			duration, err := time.ParseDuration(strValue)
+			if err != nil || duration <= 0 {
+				return settings, errors.New(fmt.Sprintf("Invalid installer "+
+					"'%s' for kapp '%s': %s", k, id, strValue))
 			}
 
-			acquirerImpl, err := acquirer.NewAcquirer(sourceStringMap)
+			if k == TIMEOUT_KEY {
+				settings.Timeout = duration
+			} else {
+				settings.Backoff = duration
+			}
+		case HOOKS_KEY:
+			hooks, err := parseHooks(value)
 			if err != nil {
-				return errors.WithStack(err)
+				return settings, errors.Wrapf(err, "Invalid installer hooks "+
+					"for kapp '%s'", id)
 			}
 
-			log.Debugf("Got acquirer %#v", acquirerImpl)
+			settings.Hooks = hooks
+		case RETRIES_KEY:
+			retries, ok := value.(int)
+			if !ok || retries < 0 {
+				return settings, errors.New(fmt.Sprintf("The installer '%s' "+
+					"for kapp '%s' must be 0 or more", k, id))
+			}
 
-			acquirers = append(acquirers, acquirerImpl)
+			settings.Retries = &retries
+		default:
+			return settings, errors.New(fmt.Sprintf("Unknown installer "+
+				"setting '%v' for kapp '%s'", k, id))
 		}
+	}
 
-		// sort the acquirers for determinism. We'll run them in parallel anyway
-		// so the order isn't important
-		sort.Slice(acquirers, func(i, j int) bool {
-			leftId, _ := acquirers[i].Id()
-			rightId, _ := acquirers[j].Id()
-			return leftId < rightId
-		})
+	return settings, nil
+}
 
-		kapp.Sources = acquirers
+// sort the acquirers for determinism. We'll run them in parallel anyway
+// so the order isn't important
+func sortAcquirers(acquirers []acquirer.Acquirer) {
+	sort.Slice(acquirers, func(i, j int) bool {
+		leftId, _ := acquirers[i].Id()
+		rightId, _ := acquirers[j].Id()
+		return leftId < rightId
+	})
+}
 
-		log.Debugf("Parsed kapp=%#v", kapp)
+// Returns an instance of a template. Settings in the instance override those in
+// the template, params are merged and sources in the instance replace any in
+// the template with the same name. The template's other sources are shared
+// between all its instances in the cache.
+func applyTemplate(instance Kapp, template Kapp) Kapp {
+	overridden := map[string]bool{}
+	for _, source := range instance.Sources {
+		overridden[source.Name()] = true
+	}
+
+	sources := make([]acquirer.Acquirer, 0)
+	sharedSources := make([]string, 0)
 
-		*kapps = append(*kapps, kapp)
+	for _, source := range template.Sources {
+		if overridden[source.Name()] {
+			continue
+		}
+
+		sources = append(sources, source)
+		sharedSources = append(sharedSources, source.Name())
 	}
 
-	return nil
+	sources = append(sources, instance.Sources...)
+	sortAcquirers(sources)
+
+	instance.Sources = sources
+	instance.sharedSources = sharedSources
+
+	if instance.When == "" {
+		instance.When = template.When
+	}
+
+	if instance.namespace == "" {
+		instance.namespace = template.namespace
+	}
+
+	if instance.Installer.Timeout == 0 {
+		instance.Installer.Timeout = template.Installer.Timeout
+	}
+
+	if instance.Installer.Retries == nil {
+		instance.Installer.Retries = template.Installer.Retries
+	}
+
+	if instance.Installer.Backoff == 0 {
+		instance.Installer.Backoff = template.Installer.Backoff
+	}
+
+	if instance.Installer.Hooks.IsEmpty() {
+		instance.Installer.Hooks = template.Installer.Hooks
+	}
+
+	if len(instance.Labels) == 0 {
+		instance.Labels = template.Labels
+	}
+
+	if len(instance.DependsOn) == 0 {
+		instance.DependsOn = template.DependsOn
+	}
+
+	if len(template.Params) > 0 {
+		params := map[string]string{}
+		for k, v := range template.Params {
+			params[k] = v
+		}
+		for k, v := range instance.Params {
+			params[k] = v
+		}
+		instance.Params = params
+	}
+
+	return instance
+}
+
+// Separates manifest IDs from kapp IDs in fully qualified kapp IDs
+const FQ_ID_SEPARATOR = ":"
+
+// Returns the kapp ID prefixed by the ID of its manifest, e.g.
+// `web:wordpress`. This is unique across a stack so should be used to refer
+// to kapps.
+func (k Kapp) FullyQualifiedId() string {
+	if k.manifestId == "" {
+		return k.Id
+	}
+
+	return k.manifestId + FQ_ID_SEPARATOR + k.Id
+}
+
+// Splits a kapp reference like `web:wordpress` into its manifest ID and kapp
+// ID. The manifest ID is empty if the reference isn't fully qualified.
+func SplitKappRef(ref string) (string, string) {
+	if i := strings.LastIndex(ref, FQ_ID_SEPARATOR); i >= 0 {
+		return ref[:i], ref[i+1:]
+	}
+
+	return "", ref
+}
+
+// Returns the namespace to install the kapp into. Defaults to the kapp ID.
+func (k Kapp) Namespace() string {
+	if k.namespace != "" {
+		return k.namespace
+	}
+
+	return k.Id
+}
+
+// Returns the index of the kapp's main source, i.e. the one with the same name
+// as the kapp or its template, or its only source. Returns -1 if there's no
+// main source.
+func (k Kapp) MainSourceIndex() int {
+	for i, source := range k.Sources {
+		if source.Name() == k.Id || (k.Template != "" && source.Name() == k.Template) {
+			return i
+		}
+	}
+
+	if len(k.Sources) == 1 {
+		return 0
+	}
+
+	return -1
+}
+
+// Returns the ref (e.g. tag) of the kapp's main source. Kapps are tagged like
+// Helm names chart versions (e.g. `wordpress-0.1.0`) so this can be compared
+// with versions installed in a cluster. Returns an empty string if there's no
+// main source.
+func (k Kapp) Version() string {
+	i := k.MainSourceIndex()
+	if i < 0 {
+		return ""
+	}
+
+	return k.Sources[i].Ref()
+}
+
+// Returns whether a source is inherited from a template and shared with
+// other instances of it
+func (k Kapp) SharesSource(name string) bool {
+	for _, shared := range k.sharedSources {
+		if shared == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Returns a copy of the kapp that doesn't share any sources with other
+// instances of its template, so they're acquired into its own cache dir
+func (k Kapp) WithoutSharedSources() Kapp {
+	k.sharedSources = nil
+	return k
 }
 
 // Parses manifest YAML data and returns a list of kapps
 func parseManifestYaml(data map[string]interface{}) ([]Kapp, error) {
 	kapps := make([]Kapp, 0)
 
-	presentKapps, ok := data[PRESENT_KEY]
-	if ok {
-		err := parseKapps(&kapps, presentKapps.(map[interface{}]interface{}), true)
-		if err != nil {
-			return nil, errors.Wrap(err, "Error parsing present kapps")
-		}
+	templateDefinitions, err := getDefinitions(data, TEMPLATES_KEY)
+	if err != nil {
+		return nil, errors.WithStack(err)
 	}
 
-	absentKapps, ok := data[ABSENT_KEY]
-	if ok {
-		err := parseKapps(&kapps, absentKapps.(map[interface{}]interface{}), false)
-		if err != nil {
-			return nil, errors.Wrap(err, "Error parsing absent kapps")
-		}
+	templates, err := parseTemplates(templateDefinitions)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error parsing kapp templates")
+	}
+
+	presentKapps, err := getDefinitions(data, PRESENT_KEY)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	err = parseKapps(&kapps, presentKapps, true, templates)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error parsing present kapps")
+	}
+
+	absentKapps, err := getDefinitions(data, ABSENT_KEY)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	err = parseKapps(&kapps, absentKapps, false, templates)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error parsing absent kapps")
 	}
 
 	log.Debugf("Parsed kapps to install and remove: %#v", kapps)
 
 	return kapps, nil
 }
+
+// Returns the IDs of kapps listed under `ignored` in a manifest
+func parseIgnored(data map[string]interface{}) ([]string, error) {
+	ids, ok := data[IGNORED_KEY]
+	if !ok || ids == nil {
+		return nil, nil
+	}
+
+	idList, ok := ids.([]interface{})
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("'%s' must be a list", IGNORED_KEY))
+	}
+
+	ignored := make([]string, 0)
+
+	for _, id := range idList {
+		idStr, ok := id.(string)
+		if !ok {
+			return nil, errors.New(fmt.Sprintf("'%s' must be a list of kapp "+
+				"IDs. Got: %#v", IGNORED_KEY, id))
+		}
+		ignored = append(ignored, idStr)
+	}
+
+	return ignored, nil
+}
+
+// Converts a YAML list of strings
+func parseStringList(v interface{}) ([]string, error) {
+	items, ok := v.([]interface{})
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("expected a list. Got: %#v", v))
+	}
+
+	list := make([]string, 0)
+
+	for _, item := range items {
+		str, ok := item.(string)
+		if !ok {
+			return nil, errors.New(fmt.Sprintf("expected a string. Got: %#v", item))
+		}
+		list = append(list, str)
+	}
+
+	return list, nil
+}
+
+// Returns the map of definitions under a top-level key in a manifest
+func getDefinitions(data map[string]interface{}, key string) (map[interface{}]interface{}, error) {
+	definitions, ok := data[key]
+	if !ok || definitions == nil {
+		return map[interface{}]interface{}{}, nil
+	}
+
+	definitionsMap, ok := definitions.(map[interface{}]interface{})
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("'%s' must be a map", key))
+	}
+
+	return definitionsMap, nil
+}
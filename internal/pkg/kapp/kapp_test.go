@@ -5,6 +5,7 @@ import (
 	"github.com/sugarkube/sugarkube/internal/pkg/acquirer"
 	"gopkg.in/yaml.v2"
 	"testing"
+	"time"
 )
 
 func TestParseManifestYaml(t *testing.T) {
@@ -32,6 +33,7 @@ present:
       name: sampleNameB
 
   example2:
+    when: provider == "aws"
     sources:
     - uri: git@github.com:exampleA/repoA.git
       branch: branchA
@@ -64,6 +66,7 @@ absent:
 				{
 					Id:              "example2",
 					ShouldBePresent: true,
+					When:            `provider == "aws"`,
 					Sources: []acquirer.Acquirer{
 						acquirer.NewGitAcquirer(
 							"pathA",
@@ -103,3 +106,182 @@ absent:
 		}
 	}
 }
+
+func TestParseManifestYamlTemplates(t *testing.T) {
+	input := `
+templates:
+  wordpress:
+    namespace: wordpress-sites
+    labels:
+    - web
+    params:
+      hosted_zone: example.com
+      replicas: "1"
+    sources:
+    - uri: git@github.com:sugarkube/kapps.git
+      branch: master
+      path: incubator/wordpress
+    - uri: git@github.com:sugarkube/sugarkube.git
+      branch: master
+      path: examples/values/wordpress/default/
+      name: values
+
+present:
+  site1:
+    template: wordpress
+    params:
+      replicas: "2"
+    sources:
+    - uri: git@github.com:sugarkube/sugarkube.git
+      branch: master
+      path: examples/values/wordpress/site1/
+      name: values
+
+  site2:
+    template: wordpress
+    namespace: site2
+    labels:
+    - wiki
+    depends_on:
+    - site1
+`
+
+	data := map[string]interface{}{}
+	err := yaml.Unmarshal([]byte(input), data)
+	assert.Nil(t, err)
+
+	actual, err := parseManifestYaml(data)
+	assert.Nil(t, err)
+
+	chartSource := acquirer.NewGitAcquirer("", "git@github.com:sugarkube/kapps.git",
+		"master", "incubator/wordpress")
+
+	expected := []Kapp{
+		{
+			Id:              "site1",
+			ShouldBePresent: true,
+			Template:        "wordpress",
+			Sources: []acquirer.Acquirer{
+				chartSource,
+				acquirer.NewGitAcquirer("values", "git@github.com:sugarkube/sugarkube.git",
+					"master", "examples/values/wordpress/site1/"),
+			},
+			sharedSources: []string{"wordpress"},
+			namespace:     "wordpress-sites",
+			Params: map[string]string{
+				"hosted_zone": "example.com",
+				"replicas":    "2",
+			},
+			Labels: []string{"web"},
+		},
+		{
+			Id:              "site2",
+			ShouldBePresent: true,
+			Template:        "wordpress",
+			Sources: []acquirer.Acquirer{
+				chartSource,
+				acquirer.NewGitAcquirer("values", "git@github.com:sugarkube/sugarkube.git",
+					"master", "examples/values/wordpress/default/"),
+			},
+			sharedSources: []string{"wordpress", "values"},
+			namespace:     "site2",
+			Params: map[string]string{
+				"hosted_zone": "example.com",
+				"replicas":    "1",
+			},
+			Labels:    []string{"wiki"},
+			DependsOn: []string{"site1"},
+		},
+	}
+
+	assert.Equal(t, expected, actual)
+
+	assert.Equal(t, "wordpress-sites", actual[0].Namespace())
+	assert.True(t, actual[0].SharesSource("wordpress"))
+	assert.False(t, actual[0].SharesSource("values"))
+
+	// undefined templates are an error
+	data = map[string]interface{}{}
+	err = yaml.Unmarshal([]byte("present:\n  site3:\n    template: missing\n"), data)
+	assert.Nil(t, err)
+
+	_, err = parseManifestYaml(data)
+	assert.Error(t, err)
+}
+
+func TestParseInstallerSettings(t *testing.T) {
+	retries := 2
+
+	tests := []struct {
+		name          string
+		desc          string
+		input         string
+		expected      InstallerSettings
+		expectedError bool
+	}{
+		{
+			name:  "good",
+			desc:  "all settings should be parsed",
+			input: "timeout: 45m\nretries: 2\nbackoff: 30s\n",
+			expected: InstallerSettings{
+				Timeout: 45 * time.Minute,
+				Retries: &retries,
+				Backoff: 30 * time.Second,
+			},
+		},
+		{
+			name:  "hooks",
+			desc:  "hooks should be parsed",
+			input: "hooks:\n  post_install:\n  - target: smoke-test\n",
+			expected: InstallerSettings{
+				Hooks: Hooks{
+					PostInstall: []Hook{{Target: "smoke-test"}},
+				},
+			},
+		},
+		{
+			name:          "error_bad_hooks",
+			desc:          "invalid hooks are an error",
+			input:         "hooks:\n  post_install:\n  - {}\n",
+			expectedError: true,
+		},
+		{
+			name:     "empty",
+			desc:     "unset settings should be left for the defaults",
+			input:    "{}",
+			expected: InstallerSettings{},
+		},
+		{
+			name:          "error_bad_timeout",
+			desc:          "timeouts must be durations",
+			input:         "timeout: 45\n",
+			expectedError: true,
+		},
+		{
+			name:          "error_negative_retries",
+			desc:          "retries can't be negative",
+			input:         "retries: -1\n",
+			expectedError: true,
+		},
+		{
+			name:          "error_unknown_key",
+			desc:          "unknown settings are an error",
+			input:         "retry: 1\n",
+			expectedError: true,
+		},
+	}
+
+	for _, test := range tests {
+		data := map[interface{}]interface{}{}
+		err := yaml.Unmarshal([]byte(test.input), data)
+		assert.Nil(t, err)
+
+		actual, err := parseInstallerSettings("kappA", data)
+		if test.expectedError {
+			assert.Error(t, err, test.desc)
+		} else {
+			assert.Nil(t, err, test.desc)
+			assert.Equal(t, test.expected, actual, test.desc)
+		}
+	}
+}
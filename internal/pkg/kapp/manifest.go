@@ -4,7 +4,8 @@ import (
 	"fmt"
 	"github.com/pkg/errors"
 	"github.com/sugarkube/sugarkube/internal/pkg/log"
-	"github.com/sugarkube/sugarkube/internal/pkg/vars"
+	"github.com/sugarkube/sugarkube/internal/pkg/schema"
+	"io/ioutil"
 	"path/filepath"
 	"strings"
 )
@@ -15,6 +16,28 @@ type Manifest struct {
 	Id    string
 	Uri   string
 	Kapps []Kapp
+	// IDs of kapps in the manifest that sugarkube must never install or
+	// destroy, e.g. because they were installed by hand
+	Ignored []string
+	// optional expression that must evaluate to true for any kapps in this
+	// manifest to be included in a plan
+	When string
+	// the maximum number of kapps in the manifest to process at once. 0 means
+	// there's no limit other than the plan's.
+	MaxParallel int `yaml:"max_parallel"`
+	// process kapps in the manifest one at a time
+	Serial bool
+	// commands or make targets to run around the manifest's kapps
+	Hooks Hooks `yaml:"-"`
+}
+
+// Returns the maximum number of kapps in the manifest to process at once. 0
+// means there's no limit.
+func (m Manifest) Parallelism() int {
+	if m.Serial {
+		return 1
+	}
+	return m.MaxParallel
 }
 
 func newManifest(uri string) Manifest {
@@ -41,9 +64,15 @@ func SetManifestDefaults(manifest *Manifest) {
 // todo - change this to use an acquirer. Use the ID defined in the manifest
 // settings YAML, or default to the manifest file basename.
 func ParseManifestFile(path string) (*Manifest, error) {
+	return ParseManifestFileWithOverlays(path, []string{})
+}
+
+// Loads a manifest file, applies any overlays to it and parses the kapps it
+// defines
+func ParseManifestFileWithOverlays(path string, overlayPaths []string) (*Manifest, error) {
 	log.Debugf("Parsing manifest: %s", path)
 
-	data, err := vars.LoadYamlFile(path)
+	data, err := LoadManifestData(path, overlayPaths)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
@@ -51,13 +80,45 @@ func ParseManifestFile(path string) (*Manifest, error) {
 	log.Debugf("Loaded manifest data: %#v", data)
 
 	kapps, err := parseManifestYaml(data)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Error parsing manifest %s", path)
+	}
+
+	ignored, err := parseIgnored(data)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Error parsing manifest %s", path)
+	}
+
+	hooks, err := parseHooks(data[HOOKS_KEY])
+	if err != nil {
+		return nil, errors.Wrapf(err, "Error parsing manifest %s", path)
+	}
 
 	manifest := newManifest(path)
 	manifest.Kapps = kapps
+	manifest.Ignored = ignored
+	manifest.Hooks = hooks
+	manifest.setKappManifestIds()
 
 	return &manifest, nil
 }
 
+// Reparses a manifest with overlays applied, preserving the settings it was
+// given in the stack config
+func ApplyOverlays(manifest *Manifest, overlayPaths []string) error {
+	parsedManifest, err := ParseManifestFileWithOverlays(manifest.Uri, overlayPaths)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	manifest.Kapps = parsedManifest.Kapps
+	manifest.Ignored = parsedManifest.Ignored
+	manifest.Hooks = parsedManifest.Hooks
+	manifest.setKappManifestIds()
+
+	return nil
+}
+
 // Parses manifest files and returns a list of manifests on success
 func ParseManifests(manifestPaths []string) ([]Manifest, error) {
 	log.Debugf("Parsing %d manifest(s)", len(manifestPaths))
@@ -76,27 +137,100 @@ func ParseManifests(manifestPaths []string) ([]Manifest, error) {
 	return manifests, nil
 }
 
+// Records the manifest's ID on each of its kapps. This must be called
+// whenever the manifest ID changes.
+func (m *Manifest) setKappManifestIds() {
+	for i := range m.Kapps {
+		m.Kapps[i].manifestId = m.Id
+	}
+}
+
 // Validates that there aren't multiple kapps with the same ID in the manifest,
-// or it'll break creating a cache
+// or it'll break creating a cache. All conflicts are reported.
 func ValidateManifest(manifest *Manifest) error {
-	ids := map[string]bool{}
+	problems := validateManifest(manifest)
+	if len(problems) > 0 {
+		return errors.New(fmt.Sprintf("Invalid manifest '%s':\n  %s",
+			manifest.Id, strings.Join(problems, "\n  ")))
+	}
+
+	return nil
+}
+
+func validateManifest(manifest *Manifest) []string {
+	problems := make([]string, 0)
+	ids := map[string]int{}
 
 	for _, kapp := range manifest.Kapps {
-		id := kapp.Id
+		ids[kapp.Id]++
 
-		if _, ok := ids[id]; ok {
-			return errors.New(fmt.Sprintf("Multiple kapps exist with "+
-				"the same id: %s", id))
+		// only report each duplicate once
+		if ids[kapp.Id] == 2 {
+			problems = append(problems, fmt.Sprintf("Multiple kapps exist in "+
+				"manifest '%s' with the same id: %s", manifest.Id, kapp.Id))
 		}
 
 		for _, acquirer := range kapp.Sources {
 			// verify all IDs can be generated successfully
 			_, err := acquirer.Id()
 			if err != nil {
-				return errors.WithStack(err)
+				problems = append(problems, fmt.Sprintf("Invalid source for "+
+					"kapp '%s': %s", kapp.FullyQualifiedId(), err))
 			}
 		}
 	}
 
-	return nil
+	for _, ignoredId := range manifest.Ignored {
+		if ids[ignoredId] == 0 {
+			problems = append(problems, fmt.Sprintf("Manifest '%s' ignores "+
+				"kapp '%s' which it doesn't declare", manifest.Id, ignoredId))
+		}
+	}
+
+	if manifest.MaxParallel < 0 {
+		problems = append(problems, fmt.Sprintf("Manifest '%s' has a negative "+
+			"max_parallel: %d", manifest.Id, manifest.MaxParallel))
+	}
+
+	if manifest.Serial && manifest.MaxParallel > 1 {
+		problems = append(problems, fmt.Sprintf("Manifest '%s' is serial so "+
+			"can't have a max_parallel of %d", manifest.Id, manifest.MaxParallel))
+	}
+
+	return problems
+}
+
+// Returns whether the manifest says a kapp must be left alone
+func (m *Manifest) ignores(kappId string) bool {
+	for _, ignoredId := range m.Ignored {
+		if ignoredId == kappId {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Returns problems found validating a manifest file against the manifest schema
+func LintManifestFile(path string) error {
+	return lintFile(path, schema.ValidateManifest)
+}
+
+// Returns problems found validating a stack config file against the stacks schema
+func LintStackFile(path string) error {
+	return lintFile(path, schema.ValidateStacks)
+}
+
+func lintFile(path string, validate func(string, []byte) ([]schema.Problem, error)) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return errors.Wrapf(err, "Error reading %s", path)
+	}
+
+	problems, err := validate(path, data)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	return schema.ProblemsError(problems)
 }
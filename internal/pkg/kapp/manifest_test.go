@@ -32,6 +32,24 @@ func TestValidateManifest(t *testing.T) {
 					{Id: "example1"},
 				},
 			},
+			expectedError: true,
+		},
+		{
+			name:  "good_parallelism",
+			desc:  "serial manifests can set max_parallel to 1",
+			input: Manifest{Serial: true, MaxParallel: 1},
+		},
+		{
+			name:          "error_negative_max_parallel",
+			desc:          "error when max_parallel is negative",
+			input:         Manifest{MaxParallel: -1},
+			expectedError: true,
+		},
+		{
+			name:          "error_serial_max_parallel",
+			desc:          "error when serial manifests allow more than 1 kapp at a time",
+			input:         Manifest{Serial: true, MaxParallel: 3},
+			expectedError: true,
 		},
 	}
 
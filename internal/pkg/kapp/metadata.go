@@ -0,0 +1,155 @@
+package kapp
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/sugarkube/sugarkube/internal/pkg/log"
+	"github.com/sugarkube/sugarkube/internal/pkg/schema"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// Kapps can contain a `sugarkube.yaml` file at the root of one of their
+// sources declaring what type of kapp they are and which secrets and env vars
+// they need during installation, e.g.:
+//
+//	implements:
+//	- helm
+//	- terraform
+//	secrets:
+//	- name: DB_PASSWORD
+//	  description: password for the RDS instance
+//	env_vars:
+//	- name: REPLICAS
+//	  default: "2"
+const METADATA_FILE = "sugarkube.yaml"
+
+// Types of kapp that can be declared in metadata
+const TYPE_HELM = "helm"
+const TYPE_TERRAFORM = "terraform"
+const TYPE_K8S = "k8s"
+
+// An env var a kapp needs when it's installed
+type EnvVarSpec struct {
+	Name        string `yaml:"name"`
+	Description string `yaml:"description,omitempty"`
+	// optional value to use if the env var isn't set. Secrets can't have
+	// defaults.
+	Default string `yaml:"default,omitempty"`
+	// if true, installation won't fail if the env var isn't set
+	Optional bool `yaml:"optional,omitempty"`
+}
+
+type Metadata struct {
+	Description string       `yaml:"description,omitempty"`
+	Implements  []string     `yaml:"implements,omitempty"`
+	Secrets     []EnvVarSpec `yaml:"secrets,omitempty"`
+	EnvVars     []EnvVarSpec `yaml:"env_vars,omitempty"`
+}
+
+// Parses metadata YAML after validating it against the metadata schema (see
+// `schemas/metadata.schema.json`). The file is only used to report problems.
+func ParseMetadata(file string, data []byte) (*Metadata, error) {
+	problems, err := schema.ValidateMetadata(file, data)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	err = schema.ProblemsError(problems)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	metadata := Metadata{}
+
+	err = yaml.Unmarshal(data, &metadata)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Error parsing kapp metadata %s", file)
+	}
+
+	err = metadata.Validate()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return &metadata, nil
+}
+
+// Returns an error if the metadata is invalid in ways the schema can't check
+func (m *Metadata) Validate() error {
+	names := map[string]bool{}
+
+	for _, spec := range append(append([]EnvVarSpec{}, m.Secrets...), m.EnvVars...) {
+		if names[spec.Name] {
+			return errors.New(fmt.Sprintf("Env var '%s' is declared "+
+				"multiple times", spec.Name))
+		}
+		names[spec.Name] = true
+	}
+
+	return nil
+}
+
+// Returns whether the metadata declares that the kapp is of the given type
+func (m *Metadata) HasType(kappType string) bool {
+	for _, t := range m.Implements {
+		if t == kappType {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Loads metadata from the root of each of the kapp's sources in its cache
+// dir. The kapp's metadata is left nil if none of its sources contain any.
+func (k *Kapp) LoadMetadata() error {
+	if k.RootDir == "" {
+		return errors.New(fmt.Sprintf("Can't load metadata for kapp '%s' "+
+			"without a root dir", k.Id))
+	}
+
+	metadataPath := ""
+
+	for _, acquirerImpl := range k.Sources {
+		path := filepath.Join(k.RootDir, acquirerImpl.Name(), METADATA_FILE)
+
+		if _, err := os.Stat(path); err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return errors.WithStack(err)
+		}
+
+		if metadataPath != "" {
+			return errors.New(fmt.Sprintf("Multiple sources of kapp '%s' "+
+				"contain a '%s' file: %s, %s", k.Id, METADATA_FILE,
+				metadataPath, path))
+		}
+
+		metadataPath = path
+	}
+
+	if metadataPath == "" {
+		log.Debugf("No '%s' file found for kapp '%s'", METADATA_FILE, k.Id)
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(metadataPath)
+	if err != nil {
+		return errors.Wrapf(err, "Error reading %s", metadataPath)
+	}
+
+	metadata, err := ParseMetadata(metadataPath, data)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	log.Debugf("Loaded metadata for kapp '%s': %#v", k.Id, metadata)
+
+	k.Metadata = metadata
+
+	return nil
+}
@@ -0,0 +1,123 @@
+package kapp
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/sugarkube/sugarkube/internal/pkg/acquirer"
+	"testing"
+)
+
+func TestParseMetadata(t *testing.T) {
+	tests := []struct {
+		name          string
+		desc          string
+		input         string
+		expectValues  *Metadata
+		expectedError bool
+		// the error message, if it should be checked
+		expectedErrorString string
+	}{
+		{
+			name: "good",
+			desc: "check metadata is parsed",
+			input: `
+implements:
+- terraform
+secrets:
+- name: API_KEY
+env_vars:
+- name: LOG_LEVEL
+  default: info
+  optional: true
+`,
+			expectValues: &Metadata{
+				Implements: []string{TYPE_TERRAFORM},
+				Secrets:    []EnvVarSpec{{Name: "API_KEY"}},
+				EnvVars:    []EnvVarSpec{{Name: "LOG_LEVEL", Default: "info", Optional: true}},
+			},
+		},
+		{
+			name:          "error_unknown_key",
+			desc:          "check unknown keys are rejected",
+			input:         "implement: [helm]",
+			expectedError: true,
+		},
+		{
+			name:          "error_unknown_type",
+			desc:          "check unknown kapp types are rejected",
+			input:         "implements: [ansible]",
+			expectedError: true,
+		},
+		{
+			name:          "error_bad_name",
+			desc:          "check invalid env var names are rejected",
+			input:         "env_vars: [{name: my-var}]",
+			expectedError: true,
+		},
+		{
+			name:          "error_duplicate_name",
+			desc:          "check env vars can't be declared twice",
+			input:         "secrets: [{name: TOKEN}]\nenv_vars: [{name: TOKEN}]",
+			expectedError: true,
+		},
+		{
+			name:          "error_secret_default",
+			desc:          "check secrets can't have defaults",
+			input:         "secrets: [{name: TOKEN, default: abc}]",
+			expectedError: true,
+		},
+		{
+			name:          "error_schema_position",
+			desc:          "check problems are reported with their position like other files",
+			input:         "implements:\n- helm\nsecret: []",
+			expectedError: true,
+			expectedErrorString: "sugarkube.yaml:3:1: unknown key 'secret' in the document. " +
+				"Did you mean 'secrets'?",
+		},
+	}
+
+	for _, test := range tests {
+		result, err := ParseMetadata("sugarkube.yaml", []byte(test.input))
+		if test.expectedError {
+			assert.NotNil(t, err, "expected an error for %s", test.name)
+			if err != nil && test.expectedErrorString != "" {
+				assert.Equal(t, test.expectedErrorString, err.Error())
+			}
+		} else {
+			assert.Nil(t, err, "unexpected error for %s", test.name)
+			assert.Equal(t, test.expectValues, result, "unexpected metadata for %s", test.name)
+		}
+	}
+}
+
+func TestLoadMetadata(t *testing.T) {
+	kappObj := Kapp{
+		Id:      "kappA",
+		RootDir: "../../testdata/metadata/kappA",
+		Sources: []acquirer.Acquirer{
+			acquirer.NewGitAcquirer("pathA", "git@github.com:sugarkube/kapps-A.git",
+				"kappA-0.1.0", "some/pathA"),
+			acquirer.NewGitAcquirer("makefiles", "git@github.com:sugarkube/kapps-A.git",
+				"master", "some/makefiles"),
+		},
+	}
+
+	err := kappObj.LoadMetadata()
+	assert.Nil(t, err)
+	assert.Equal(t, &Metadata{
+		Description: "an example kapp",
+		Implements:  []string{TYPE_HELM, TYPE_K8S},
+		Secrets: []EnvVarSpec{
+			{Name: "DB_PASSWORD", Description: "password for the database"},
+		},
+		EnvVars: []EnvVarSpec{
+			{Name: "REPLICAS", Default: "2"},
+		},
+	}, kappObj.Metadata)
+
+	// kapps without metadata are fine
+	kappObj.Metadata = nil
+	kappObj.RootDir = "../../testdata/metadata/missing"
+	err = kappObj.LoadMetadata()
+	assert.Nil(t, err)
+	assert.Nil(t, kappObj.Metadata)
+}
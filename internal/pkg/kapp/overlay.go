@@ -0,0 +1,256 @@
+package kapp
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/sugarkube/sugarkube/internal/pkg/acquirer"
+	"github.com/sugarkube/sugarkube/internal/pkg/log"
+	"github.com/sugarkube/sugarkube/internal/pkg/schema"
+	"github.com/sugarkube/sugarkube/internal/pkg/vars"
+	"path/filepath"
+)
+
+// Overlays patch a base manifest, e.g. to pin a source to a tag in prod while
+// dev tracks master. They have the same structure as manifests, e.g.:
+//
+//   present:
+//     wordpress:
+//       params:
+//         replicas: "3"
+//       sources:
+//       - name: wordpress       # patches the base source with this name
+//         branch: wordpress-0.1.0
+//   absent:
+//     jenkins: {}               # moves jenkins to the absent kapps
+//   ignored:
+//   - kiam                      # appended to the base's ignored kapps
+//
+// Kapps are matched by ID. Sources are matched by name (which defaults to the
+// last component of their path) and their settings are replaced, params are
+// merged and other settings are replaced. Kapps and sources that aren't in
+// the base manifest are added.
+
+// Loads manifest data from a file and merges each overlay onto it in order
+func LoadManifestData(path string, overlayPaths []string) (map[string]interface{}, error) {
+	data, err := vars.LoadYamlFile(path)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	err = LintManifestFile(path)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	for _, overlayPath := range overlayPaths {
+		log.Debugf("Applying overlay %s to manifest %s", overlayPath, path)
+
+		err = lintFile(overlayPath, schema.ValidateManifestOverlay)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		overlay, err := vars.LoadYamlFile(overlayPath)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		data, err = MergeManifestOverlay(data, overlay)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Error applying overlay %s", overlayPath)
+		}
+	}
+
+	return data, nil
+}
+
+// Returns the result of patching manifest data with an overlay
+func MergeManifestOverlay(base map[string]interface{},
+	overlay map[string]interface{}) (map[string]interface{}, error) {
+
+	merged := map[string]interface{}{}
+
+	// copy the base so it isn't modified
+	for _, key := range []string{TEMPLATES_KEY, PRESENT_KEY, ABSENT_KEY} {
+		definitions, err := getDefinitions(base, key)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		copied := map[interface{}]interface{}{}
+		for k, v := range definitions {
+			copied[k] = v
+		}
+
+		if len(copied) > 0 {
+			merged[key] = copied
+		}
+	}
+
+	if base[IGNORED_KEY] != nil || overlay[IGNORED_KEY] != nil {
+		ignored, err := mergeLists(IGNORED_KEY, base[IGNORED_KEY], overlay[IGNORED_KEY])
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		merged[IGNORED_KEY] = ignored
+	}
+
+	// hooks in an overlay replace the base's
+	if overlay[HOOKS_KEY] != nil {
+		merged[HOOKS_KEY] = overlay[HOOKS_KEY]
+	} else if base[HOOKS_KEY] != nil {
+		merged[HOOKS_KEY] = base[HOOKS_KEY]
+	}
+
+	for _, key := range []string{TEMPLATES_KEY, PRESENT_KEY, ABSENT_KEY} {
+		overlayDefinitions, err := getDefinitions(overlay, key)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		for id, overlayDefinition := range overlayDefinitions {
+			overlayMap, ok := overlayDefinition.(map[interface{}]interface{})
+			if !ok && overlayDefinition != nil {
+				return nil, errors.New(fmt.Sprintf("The overlay for '%v' "+
+					"must be a map", id))
+			}
+
+			// find the base definition. Kapps may move between present and absent.
+			baseKey := key
+			searchKeys := []string{key}
+			if key != TEMPLATES_KEY {
+				searchKeys = []string{PRESENT_KEY, ABSENT_KEY}
+			}
+
+			var baseDefinition map[interface{}]interface{}
+			for _, searchKey := range searchKeys {
+				definitions, _ := merged[searchKey].(map[interface{}]interface{})
+				if definition, ok := definitions[id]; ok {
+					baseDefinition, _ = definition.(map[interface{}]interface{})
+					baseKey = searchKey
+					delete(definitions, id)
+					break
+				}
+			}
+
+			if baseKey != key {
+				log.Debugf("Overlay moves kapp '%v' from '%s' to '%s'", id, baseKey, key)
+			}
+
+			mergedDefinition, err := mergeKappDefinition(baseDefinition, overlayMap)
+			if err != nil {
+				return nil, errors.Wrapf(err, "Error merging overlay for '%v'", id)
+			}
+
+			definitions, ok := merged[key].(map[interface{}]interface{})
+			if !ok {
+				definitions = map[interface{}]interface{}{}
+				merged[key] = definitions
+			}
+			definitions[id] = mergedDefinition
+		}
+	}
+
+	return merged, nil
+}
+
+// Patches a kapp definition with settings from an overlay
+func mergeKappDefinition(base map[interface{}]interface{},
+	overlay map[interface{}]interface{}) (map[interface{}]interface{}, error) {
+	merged := map[interface{}]interface{}{}
+
+	for k, v := range base {
+		merged[k] = v
+	}
+
+	for k, v := range overlay {
+		switch k {
+		case SOURCES_KEY:
+			sources, err := mergeSources(base[k], v)
+			if err != nil {
+				return nil, errors.WithStack(err)
+			}
+			merged[k] = sources
+		case PARAMS_KEY:
+			params := map[interface{}]interface{}{}
+			for _, source := range []interface{}{base[k], v} {
+				sourceMap, _ := source.(map[interface{}]interface{})
+				for paramKey, paramValue := range sourceMap {
+					params[paramKey] = paramValue
+				}
+			}
+			merged[k] = params
+		default:
+			merged[k] = v
+		}
+	}
+
+	return merged, nil
+}
+
+// Patches sources with the same name and appends any others
+func mergeSources(base interface{}, overlay interface{}) ([]interface{}, error) {
+	merged := make([]interface{}, 0)
+	baseList, _ := base.([]interface{})
+	overlayList, ok := overlay.([]interface{})
+	if !ok && overlay != nil {
+		return nil, errors.New(fmt.Sprintf("'%s' must be a list", SOURCES_KEY))
+	}
+
+	for _, source := range baseList {
+		merged = append(merged, source)
+	}
+
+	for _, overlaySource := range overlayList {
+		overlayMap, ok := overlaySource.(map[interface{}]interface{})
+		if !ok {
+			return nil, errors.New("Sources must be maps")
+		}
+
+		name := sourceName(overlayMap)
+		if name == "" {
+			return nil, errors.New(fmt.Sprintf("Overlay sources need a '%s' "+
+				"or '%s' to match them to base sources", acquirer.NAME, acquirer.PATH))
+		}
+
+		index := -1
+		for i, baseSource := range merged {
+			baseMap, _ := baseSource.(map[interface{}]interface{})
+			if sourceName(baseMap) == name {
+				index = i
+				break
+			}
+		}
+
+		if index < 0 {
+			merged = append(merged, overlayMap)
+			continue
+		}
+
+		patched := map[interface{}]interface{}{}
+		for k, v := range merged[index].(map[interface{}]interface{}) {
+			patched[k] = v
+		}
+		for k, v := range overlayMap {
+			patched[k] = v
+		}
+
+		merged[index] = patched
+	}
+
+	return merged, nil
+}
+
+// Returns the name of a source definition, defaulting to the basename of its
+// path like acquirers do
+func sourceName(source map[interface{}]interface{}) string {
+	if name, ok := source[acquirer.NAME].(string); ok && name != "" {
+		return name
+	}
+
+	if path, ok := source[acquirer.PATH].(string); ok && path != "" {
+		return filepath.Base(path)
+	}
+
+	return ""
+}
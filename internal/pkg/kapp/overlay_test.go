@@ -0,0 +1,106 @@
+package kapp
+
+import (
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v2"
+	"testing"
+)
+
+func TestMergeManifestOverlay(t *testing.T) {
+	base := `
+present:
+  wordpress:
+    params:
+      replicas: "1"
+      hosted_zone: example.com
+    sources:
+    - uri: git@github.com:sugarkube/kapps.git
+      branch: master
+      path: incubator/wordpress
+    - uri: git@github.com:sugarkube/kapps.git
+      branch: master
+      path: incubator/common-makefiles
+  jenkins:
+    sources:
+    - uri: git@github.com:sugarkube/kapps.git
+      branch: master
+      path: incubator/jenkins
+ignored:
+- jenkins
+hooks:
+  pre_install:
+  - command: ./snapshot.sh
+`
+
+	overlay := `
+present:
+  wordpress:
+    params:
+      replicas: "3"
+    sources:
+    - name: wordpress
+      branch: wordpress-0.1.0
+    - uri: git@github.com:sugarkube/sugarkube.git
+      branch: master
+      path: examples/values/wordpress/prod/
+      name: prod-values
+absent:
+  jenkins: {}
+ignored:
+- jenkins
+- wordpress
+hooks:
+  post_install:
+  - target: smoke-test
+`
+
+	expected := `
+present:
+  wordpress:
+    params:
+      replicas: "3"
+      hosted_zone: example.com
+    sources:
+    - uri: git@github.com:sugarkube/kapps.git
+      branch: wordpress-0.1.0
+      name: wordpress
+      path: incubator/wordpress
+    - uri: git@github.com:sugarkube/kapps.git
+      branch: master
+      path: incubator/common-makefiles
+    - uri: git@github.com:sugarkube/sugarkube.git
+      branch: master
+      path: examples/values/wordpress/prod/
+      name: prod-values
+absent:
+  jenkins:
+    sources:
+    - uri: git@github.com:sugarkube/kapps.git
+      branch: master
+      path: incubator/jenkins
+ignored:
+- jenkins
+- wordpress
+hooks:
+  post_install:
+  - target: smoke-test
+`
+
+	baseData := map[string]interface{}{}
+	assert.Nil(t, yaml.Unmarshal([]byte(base), baseData))
+
+	overlayData := map[string]interface{}{}
+	assert.Nil(t, yaml.Unmarshal([]byte(overlay), overlayData))
+
+	expectedData := map[string]interface{}{}
+	assert.Nil(t, yaml.Unmarshal([]byte(expected), expectedData))
+
+	actual, err := MergeManifestOverlay(baseData, overlayData)
+	assert.Nil(t, err)
+	assert.Equal(t, expectedData, actual)
+
+	// the base shouldn't be modified
+	unmodified := map[string]interface{}{}
+	assert.Nil(t, yaml.Unmarshal([]byte(base), unmodified))
+	assert.Equal(t, unmodified, baseData)
+}
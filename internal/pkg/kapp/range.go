@@ -0,0 +1,125 @@
+package kapp
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/sugarkube/sugarkube/internal/pkg/log"
+	"strings"
+)
+
+// Manifest ranges restrict a stack to a slice of its manifests, e.g. to run
+// everything from a manifest onwards when recovering from an incident with
+// `--from-manifest`. Manifests outside the range are dropped from the stack.
+
+type ManifestRange struct {
+	// ID of the first manifest to include. Defaults to the first manifest.
+	From string `yaml:"from,omitempty"`
+	// ID of the last manifest to include. Defaults to the last manifest.
+	To string `yaml:"to,omitempty"`
+	// IDs of the only manifests to include. Can't be used with From or To.
+	Only []string `yaml:"only,omitempty"`
+}
+
+// Returns whether the range includes all manifests
+func (r ManifestRange) IsEmpty() bool {
+	return r.From == "" && r.To == "" && len(r.Only) == 0
+}
+
+// Describes the range, e.g. `from 20-security to 40-apps`
+func (r ManifestRange) String() string {
+	if len(r.Only) > 0 {
+		return fmt.Sprintf("only %s", strings.Join(r.Only, ", "))
+	}
+
+	parts := make([]string, 0)
+	if r.From != "" {
+		parts = append(parts, fmt.Sprintf("from %s", r.From))
+	}
+	if r.To != "" {
+		parts = append(parts, fmt.Sprintf("to %s", r.To))
+	}
+
+	if len(parts) == 0 {
+		return "all"
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// Slices the stack's manifests to the range. All unknown manifest IDs are
+// reported.
+func (s *StackConfig) SetManifestRange(manifestRange ManifestRange) error {
+	if manifestRange.IsEmpty() {
+		return nil
+	}
+
+	if len(manifestRange.Only) > 0 && (manifestRange.From != "" || manifestRange.To != "") {
+		return errors.New("Manifests can't be selected by range and by ID at once")
+	}
+
+	indices := map[string]int{}
+	ids := make([]string, 0)
+	for i, manifest := range s.Manifests {
+		indices[manifest.Id] = i
+		ids = append(ids, manifest.Id)
+	}
+
+	problems := make([]string, 0)
+	for _, id := range append([]string{manifestRange.From, manifestRange.To},
+		manifestRange.Only...) {
+		if _, ok := indices[id]; id != "" && !ok {
+			problems = append(problems, fmt.Sprintf("No manifest '%s' found in "+
+				"stack '%s'", id, s.Name))
+		}
+	}
+
+	if len(problems) > 0 {
+		return errors.New(fmt.Sprintf("Invalid manifest range. Manifests are: "+
+			"%s\n  %s", strings.Join(ids, ", "), strings.Join(problems, "\n  ")))
+	}
+
+	manifests := make([]Manifest, 0)
+
+	if len(manifestRange.Only) > 0 {
+		only := map[string]bool{}
+		for _, id := range manifestRange.Only {
+			only[id] = true
+		}
+
+		// manifests are always kept in the stack's order
+		for _, manifest := range s.Manifests {
+			if only[manifest.Id] {
+				manifests = append(manifests, manifest)
+			}
+		}
+	} else {
+		from := 0
+		if manifestRange.From != "" {
+			from = indices[manifestRange.From]
+		}
+
+		to := len(s.Manifests) - 1
+		if manifestRange.To != "" {
+			to = indices[manifestRange.To]
+		}
+
+		if from > to {
+			return errors.New(fmt.Sprintf("Manifest '%s' comes after manifest "+
+				"'%s' in stack '%s'", manifestRange.From, manifestRange.To, s.Name))
+		}
+
+		manifests = append(manifests, s.Manifests[from:to+1]...)
+	}
+
+	log.Infof("Running %d of %d manifest(s) in stack '%s' (%s)", len(manifests),
+		len(s.Manifests), s.Name, manifestRange)
+
+	s.Manifests = manifests
+	s.manifestRange = manifestRange
+	return nil
+}
+
+// Returns the range the stack's manifests were sliced to
+func (s *StackConfig) ManifestRange() ManifestRange {
+	return s.manifestRange
+}
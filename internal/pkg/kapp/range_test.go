@@ -0,0 +1,91 @@
+package kapp
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestSetManifestRange(t *testing.T) {
+	tests := []struct {
+		name          string
+		desc          string
+		manifestRange ManifestRange
+		expected      []string
+		expectedError bool
+	}{
+		{
+			name:     "empty",
+			desc:     "all manifests should be kept without a range",
+			expected: []string{"10-infra", "20-security", "30-data", "40-apps"},
+		},
+		{
+			name:          "from",
+			desc:          "manifests before the first one should be dropped",
+			manifestRange: ManifestRange{From: "20-security"},
+			expected:      []string{"20-security", "30-data", "40-apps"},
+		},
+		{
+			name:          "from_to",
+			desc:          "manifests outside the range should be dropped",
+			manifestRange: ManifestRange{From: "20-security", To: "30-data"},
+			expected:      []string{"20-security", "30-data"},
+		},
+		{
+			name:          "only",
+			desc:          "only the given manifests should be kept, in the stack's order",
+			manifestRange: ManifestRange{Only: []string{"40-apps", "10-infra"}},
+			expected:      []string{"10-infra", "40-apps"},
+		},
+		{
+			name:          "error_unknown",
+			desc:          "unknown manifest IDs are errors",
+			manifestRange: ManifestRange{To: "50-monitoring"},
+			expectedError: true,
+		},
+		{
+			name:          "error_reversed",
+			desc:          "the first manifest must come before the last",
+			manifestRange: ManifestRange{From: "30-data", To: "20-security"},
+			expectedError: true,
+		},
+		{
+			name:          "error_only_and_range",
+			desc:          "ranges can't be combined with selecting manifests by ID",
+			manifestRange: ManifestRange{From: "20-security", Only: []string{"40-apps"}},
+			expectedError: true,
+		},
+	}
+
+	for _, test := range tests {
+		stackConfig := StackConfig{
+			Name: "test",
+			Manifests: []Manifest{
+				{Id: "10-infra"}, {Id: "20-security"}, {Id: "30-data"}, {Id: "40-apps"},
+			},
+		}
+
+		err := stackConfig.SetManifestRange(test.manifestRange)
+		if test.expectedError {
+			assert.Error(t, err, test.desc)
+			continue
+		}
+		assert.Nil(t, err, test.desc)
+
+		ids := make([]string, 0)
+		for _, manifest := range stackConfig.Manifests {
+			ids = append(ids, manifest.Id)
+		}
+
+		assert.Equal(t, test.expected, ids, test.desc)
+		assert.Equal(t, test.manifestRange, stackConfig.ManifestRange(), test.desc)
+	}
+}
+
+func TestManifestRangeString(t *testing.T) {
+	assert.Equal(t, "all", ManifestRange{}.String())
+	assert.Equal(t, "from 20-security", ManifestRange{From: "20-security"}.String())
+	assert.Equal(t, "from 20-security to 30-data",
+		ManifestRange{From: "20-security", To: "30-data"}.String())
+	assert.Equal(t, "only 10-infra, 40-apps",
+		ManifestRange{Only: []string{"10-infra", "40-apps"}}.String())
+}
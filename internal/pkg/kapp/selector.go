@@ -0,0 +1,215 @@
+package kapp
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/sugarkube/sugarkube/internal/pkg/log"
+	"path"
+	"strings"
+)
+
+// Selectors restrict commands to a subset of a stack's kapps with
+// `--include` and `--exclude`. Each selector is one of:
+//   * `label=<glob>` - kapps with a matching label
+//   * `<manifest-glob>:<kapp-glob>` - kapps with a matching fully qualified ID
+//   * `<glob>` - kapps with a matching ID, or all kapps in matching manifests
+// Globs use the syntax of path.Match, e.g. `web:word*`. Kapps are selected if
+// they match any include selector (or there aren't any) and no exclude
+// selectors. Unselected kapps are skipped.
+
+// Prefix of selectors that match labels
+const LABEL_SELECTOR_PREFIX = "label="
+
+type Selector struct {
+	Include []string
+	Exclude []string
+	// also select the kapps selected kapps depend on, unless they're excluded
+	WithDependencies bool
+}
+
+// Returns whether the selector selects all kapps
+func (s Selector) IsEmpty() bool {
+	return len(s.Include) == 0 && len(s.Exclude) == 0
+}
+
+// Returns whether a selector matches a kapp
+func selectorMatches(selector string, kappObj Kapp) bool {
+	if strings.HasPrefix(selector, LABEL_SELECTOR_PREFIX) {
+		pattern := strings.TrimPrefix(selector, LABEL_SELECTOR_PREFIX)
+		for _, label := range kappObj.Labels {
+			if globMatches(pattern, label) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if strings.Contains(selector, FQ_ID_SEPARATOR) {
+		manifestPattern, kappPattern := SplitKappRef(selector)
+		return globMatches(manifestPattern, kappObj.manifestId) &&
+			globMatches(kappPattern, kappObj.Id)
+	}
+
+	return globMatches(selector, kappObj.Id) || globMatches(selector, kappObj.manifestId)
+}
+
+// Patterns are validated before they're matched, so errors can be ignored
+func globMatches(pattern string, value string) bool {
+	matched, _ := path.Match(pattern, value)
+	return matched
+}
+
+// Returns an error if any of the globs in a selector are malformed
+func validateSelector(selector string) error {
+	patterns := []string{selector}
+
+	if strings.HasPrefix(selector, LABEL_SELECTOR_PREFIX) {
+		patterns = []string{strings.TrimPrefix(selector, LABEL_SELECTOR_PREFIX)}
+	} else if strings.Contains(selector, FQ_ID_SEPARATOR) {
+		manifestPattern, kappPattern := SplitKappRef(selector)
+		patterns = []string{manifestPattern, kappPattern}
+	}
+
+	for _, pattern := range patterns {
+		if pattern == "" {
+			return errors.New("empty pattern")
+		}
+
+		_, err := path.Match(pattern, "")
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	return nil
+}
+
+// Restricts the stack to the kapps selected by the selector. Selectors that
+// are invalid or match no kapps are errors since typos could lead to the
+// wrong kapps being installed or destroyed.
+func (s *StackConfig) SetSelector(selector Selector) error {
+	if selector.IsEmpty() {
+		s.selected = nil
+		return nil
+	}
+
+	problems := make([]string, 0)
+
+	kapps := make([]Kapp, 0)
+	for _, manifest := range s.Manifests {
+		kapps = append(kapps, manifest.Kapps...)
+	}
+
+	// returns the IDs of the kapps matching each selector
+	matching := func(selectors []string) map[string]bool {
+		matches := map[string]bool{}
+
+		for _, selector := range selectors {
+			err := validateSelector(selector)
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("Invalid selector '%s': %s",
+					selector, err))
+				continue
+			}
+
+			found := false
+			for _, kappObj := range kapps {
+				if selectorMatches(selector, kappObj) {
+					matches[kappObj.FullyQualifiedId()] = true
+					found = true
+				}
+			}
+
+			if !found {
+				problems = append(problems, fmt.Sprintf("Selector '%s' doesn't "+
+					"match any kapps in stack '%s'", selector, s.Name))
+			}
+		}
+
+		return matches
+	}
+
+	included := matching(selector.Include)
+	excluded := matching(selector.Exclude)
+
+	if len(problems) > 0 {
+		return errors.New(fmt.Sprintf("Invalid kapp selectors:\n  %s",
+			strings.Join(problems, "\n  ")))
+	}
+
+	selected := map[string]bool{}
+	for _, kappObj := range kapps {
+		id := kappObj.FullyQualifiedId()
+		if (len(selector.Include) == 0 || included[id]) && !excluded[id] {
+			selected[id] = true
+		}
+	}
+
+	if selector.WithDependencies {
+		// walk the dependencies of selected kapps until nothing new is found
+		queue := make([]Kapp, 0)
+		for _, kappObj := range kapps {
+			if selected[kappObj.FullyQualifiedId()] {
+				queue = append(queue, kappObj)
+			}
+		}
+
+		for len(queue) > 0 {
+			kappObj := queue[0]
+			queue = queue[1:]
+
+			for _, ref := range kappObj.DependsOn {
+				dependency, err := s.FindKapp(ref)
+				if err != nil {
+					return errors.Wrapf(err, "Invalid dependency of kapp '%s'",
+						kappObj.FullyQualifiedId())
+				}
+
+				id := dependency.FullyQualifiedId()
+				if selected[id] {
+					continue
+				}
+
+				if excluded[id] {
+					log.Warnf("Not selecting kapp '%s' needed by kapp '%s' "+
+						"because it's excluded", id, kappObj.FullyQualifiedId())
+					continue
+				}
+
+				log.Infof("Selecting kapp '%s' because kapp '%s' depends on it",
+					id, kappObj.FullyQualifiedId())
+				selected[id] = true
+				queue = append(queue, *dependency)
+			}
+		}
+	}
+
+	log.Infof("Selected %d of %d kapp(s) in stack '%s'", len(selected),
+		len(kapps), s.Name)
+
+	s.selected = selected
+	return nil
+}
+
+// Returns whether a kapp was selected. All kapps are selected unless a
+// selector has been set.
+func (s *StackConfig) IsSelected(kappObj Kapp) bool {
+	if s.selected == nil {
+		return true
+	}
+
+	return s.selected[kappObj.FullyQualifiedId()]
+}
+
+// Returns a copy of a manifest containing only its selected kapps
+func (s *StackConfig) FilterSelected(manifest Manifest) Manifest {
+	kapps := make([]Kapp, 0)
+	for _, kappObj := range manifest.Kapps {
+		if s.IsSelected(kappObj) {
+			kapps = append(kapps, kappObj)
+		}
+	}
+
+	manifest.Kapps = kapps
+	return manifest
+}
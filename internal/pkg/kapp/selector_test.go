@@ -0,0 +1,112 @@
+package kapp
+
+import (
+	"github.com/stretchr/testify/assert"
+	"sort"
+	"testing"
+)
+
+func TestSetSelector(t *testing.T) {
+	stackConfig := StackConfig{
+		Name: "test",
+		Manifests: []Manifest{
+			{
+				Id: "data",
+				Kapps: []Kapp{
+					{Id: "postgres", manifestId: "data", Labels: []string{"db"}},
+					{Id: "redis", manifestId: "data", Labels: []string{"cache"}},
+				},
+			},
+			{
+				Id: "web",
+				Kapps: []Kapp{
+					{Id: "wordpress", manifestId: "web", DependsOn: []string{"data:postgres"}},
+					{Id: "wiki", manifestId: "web", DependsOn: []string{"wordpress", "redis"}},
+				},
+			},
+		},
+	}
+
+	tests := []struct {
+		name          string
+		desc          string
+		selector      Selector
+		expected      []string
+		expectedError bool
+	}{
+		{
+			name:     "empty",
+			desc:     "all kapps should be selected without selectors",
+			expected: []string{"data:postgres", "data:redis", "web:wiki", "web:wordpress"},
+		},
+		{
+			name:     "kapp_id",
+			desc:     "unqualified IDs should match kapps",
+			selector: Selector{Include: []string{"wordpress"}},
+			expected: []string{"web:wordpress"},
+		},
+		{
+			name:     "manifest_id",
+			desc:     "unqualified IDs should match all kapps in manifests",
+			selector: Selector{Include: []string{"data"}},
+			expected: []string{"data:postgres", "data:redis"},
+		},
+		{
+			name:     "glob",
+			desc:     "globs should match fully qualified IDs",
+			selector: Selector{Include: []string{"web:w*"}, Exclude: []string{"*:wiki"}},
+			expected: []string{"web:wordpress"},
+		},
+		{
+			name:     "label",
+			desc:     "labels should be matched",
+			selector: Selector{Include: []string{"label=c*"}},
+			expected: []string{"data:redis"},
+		},
+		{
+			name:     "exclude",
+			desc:     "excluding kapps should select the rest",
+			selector: Selector{Exclude: []string{"label=db"}},
+			expected: []string{"data:redis", "web:wiki", "web:wordpress"},
+		},
+		{
+			name: "dependencies",
+			desc: "dependencies should be pulled in transitively",
+			selector: Selector{Include: []string{"web:wiki"}, Exclude: []string{"redis"},
+				WithDependencies: true},
+			expected: []string{"data:postgres", "web:wiki", "web:wordpress"},
+		},
+		{
+			name:          "error_no_match",
+			desc:          "selectors that don't match any kapps are errors",
+			selector:      Selector{Include: []string{"web:jenkins"}},
+			expectedError: true,
+		},
+		{
+			name:          "error_bad_glob",
+			desc:          "malformed globs are errors",
+			selector:      Selector{Exclude: []string{"web:[w"}},
+			expectedError: true,
+		},
+	}
+
+	for _, test := range tests {
+		err := stackConfig.SetSelector(test.selector)
+		if test.expectedError {
+			assert.Error(t, err, test.desc)
+			continue
+		}
+		assert.Nil(t, err, test.desc)
+
+		selected := make([]string, 0)
+		for _, manifest := range stackConfig.Manifests {
+			for _, kappObj := range stackConfig.FilterSelected(manifest).Kapps {
+				assert.True(t, stackConfig.IsSelected(kappObj), test.desc)
+				selected = append(selected, kappObj.FullyQualifiedId())
+			}
+		}
+		sort.Strings(selected)
+
+		assert.Equal(t, test.expected, selected, test.desc)
+	}
+}
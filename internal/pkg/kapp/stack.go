@@ -8,6 +8,7 @@ import (
 	"gopkg.in/yaml.v2"
 	"os"
 	"path/filepath"
+	"strings"
 )
 
 // Hold information about the status of the cluster
@@ -25,45 +26,169 @@ type StackConfig struct {
 	Provisioner   string
 	Profile       string
 	Cluster       string
+	Account       string
+	Region        string
 	VarsFilesDirs []string `yaml:"vars"`
 	Manifests     []Manifest
+	// refs of kapps that sugarkube must never install or destroy in this
+	// stack, e.g. `web:wordpress`
+	Ignored       []string
 	Status        ClusterStatus
 	OnlineTimeout uint32
 	ReadyTimeout  uint32
+	// name of the source of truth to query for installed kapps
+	Sot string
+	// commands or make targets to run around each phase of a plan
+	Hooks Hooks `yaml:"hooks"`
+	// fully qualified IDs of the kapps selected on the CLI. nil if all kapps
+	// are selected (see selector.go).
+	selected map[string]bool
+	// the slice of manifests selected on the CLI, if any (see range.go)
+	manifestRange ManifestRange
 }
 
-// Validates that there aren't multiple manifests in the stack config with the
-// same ID, which would break creating caches
+// Validates that manifest IDs are unique within the stack, and that kapp IDs
+// are unique within each manifest so fully qualified kapp IDs are unique.
+// Different manifests can declare kapps with the same ID, but unqualified
+// references to them (e.g. in `depends_on` or `ignored`) must then be
+// unambiguous. All problems are reported.
 func ValidateStackConfig(sc *StackConfig) error {
-	ids := map[string]bool{}
+	problems := make([]string, 0)
+	manifestIds := map[string]int{}
+
+	for i := range sc.Manifests {
+		manifest := &sc.Manifests[i]
+
+		manifestIds[manifest.Id]++
+		if manifestIds[manifest.Id] == 2 {
+			problems = append(problems, fmt.Sprintf("Multiple manifests exist "+
+				"with the same id: %s", manifest.Id))
+		}
+
+		problems = append(problems, validateManifest(manifest)...)
+	}
+
+	for _, problem := range validateHooks(sc.Hooks) {
+		problems = append(problems, fmt.Sprintf("Invalid stack hooks: %s", problem))
+	}
 
 	for _, manifest := range sc.Manifests {
-		id := manifest.Id
+		for _, kappObj := range manifest.Kapps {
+			for _, ref := range kappObj.DependsOn {
+				dependency, err := sc.FindKapp(ref)
+				if err != nil {
+					problems = append(problems, fmt.Sprintf("Invalid dependency "+
+						"of kapp '%s': %s", kappObj.FullyQualifiedId(), err))
+				} else if dependency.FullyQualifiedId() == kappObj.FullyQualifiedId() {
+					problems = append(problems, fmt.Sprintf("Kapp '%s' depends "+
+						"on itself", kappObj.FullyQualifiedId()))
+				}
+			}
+		}
+	}
 
-		if _, ok := ids[id]; ok {
-			return errors.New(fmt.Sprintf("Multiple manifests exist with "+
-				"the same id: %s", id))
+	// a typo here could lead to a kapp that must be left alone being
+	// installed or destroyed
+	for _, ref := range sc.Ignored {
+		_, err := sc.FindKapp(ref)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("Invalid ignored kapp: %s", err))
 		}
 	}
 
+	if len(problems) > 0 {
+		return errors.New(fmt.Sprintf("Invalid stack '%s':\n  %s", sc.Name,
+			strings.Join(problems, "\n  ")))
+	}
+
 	return nil
 }
 
-// Loads a stack config from a YAML file and returns it or an error
-func LoadStackConfig(name string, path string) (*StackConfig, error) {
+// Returns the kapp with the given fully qualified ID, e.g. `web:wordpress`.
+// Unqualified kapp IDs are accepted if they're unambiguous.
+func (s *StackConfig) FindKapp(ref string) (*Kapp, error) {
+	manifestId, kappId := SplitKappRef(ref)
+	matches := make([]*Kapp, 0)
+
+	for i, manifest := range s.Manifests {
+		if manifestId != "" && manifest.Id != manifestId {
+			continue
+		}
+
+		for j, kappObj := range manifest.Kapps {
+			if kappObj.Id == kappId {
+				matches = append(matches, &s.Manifests[i].Kapps[j])
+			}
+		}
+	}
+
+	if len(matches) == 0 {
+		return nil, errors.New(fmt.Sprintf("No kapp '%s' found in stack '%s'",
+			ref, s.Name))
+	}
+
+	if len(matches) > 1 {
+		ids := make([]string, 0)
+		for _, match := range matches {
+			ids = append(ids, match.FullyQualifiedId())
+		}
+		return nil, errors.New(fmt.Sprintf("Kapp ID '%s' is ambiguous. Use one "+
+			"of: %s", ref, strings.Join(ids, ", ")))
+	}
+
+	return matches[0], nil
+}
 
+// Returns whether a kapp must be left alone because it's ignored by the stack
+// or by its manifest
+func (s *StackConfig) IsIgnored(kappObj Kapp) bool {
+	for _, ref := range s.Ignored {
+		manifestId, kappId := SplitKappRef(ref)
+		if kappId == kappObj.Id && (manifestId == "" || manifestId == kappObj.manifestId) {
+			return true
+		}
+	}
+
+	for _, manifest := range s.Manifests {
+		if manifest.Id == kappObj.manifestId {
+			return manifest.ignores(kappObj.Id)
+		}
+	}
+
+	return false
+}
+
+// Loads the data for a stack from a YAML file, merging in the data of any
+// stacks it extends
+func LoadStackData(name string, path string) (map[interface{}]interface{}, error) {
 	data, err := vars.LoadYamlFile(path)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
 
-	stackConfig, ok := data[name]
-	if !ok {
-		return nil, errors.New(fmt.Sprintf("No stack called '%s' found in stack file %s", name, path))
+	err = LintStackFile(path)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	stackData, err := resolveStackData(name, data, []string{})
+	if err != nil {
+		return nil, errors.Wrapf(err, "Error loading stack '%s' from %s", name, path)
 	}
 
 	log.Debugf("Loaded stack '%s' from file '%s'", name, path)
 
+	return stackData, nil
+}
+
+// Loads a stack config from a YAML file and returns it or an error
+func LoadStackConfig(name string, path string) (*StackConfig, error) {
+
+	stackConfig, err := LoadStackData(name, path)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
 	// marshal the data we want so we can unmarshal it again into a struct
 	stackConfigBytes, err := yaml.Marshal(stackConfig)
 	if err != nil {
@@ -112,10 +237,19 @@ func LoadStackConfig(name string, path string) (*StackConfig, error) {
 		// todo - remove this. It should be handled by an acquirer
 		SetManifestDefaults(&manifest)
 		parsedManifest.Id = manifest.Id
+		parsedManifest.When = manifest.When
+		parsedManifest.MaxParallel = manifest.MaxParallel
+		parsedManifest.Serial = manifest.Serial
+		parsedManifest.setKappManifestIds()
 
 		stack.Manifests[i] = *parsedManifest
 	}
 
+	err = ValidateStackConfig(&stack)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
 	return &stack, nil
 }
 
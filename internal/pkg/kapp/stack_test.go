@@ -3,6 +3,7 @@ package kapp
 import (
 	"github.com/stretchr/testify/assert"
 	"github.com/sugarkube/sugarkube/internal/pkg/acquirer"
+	"github.com/sugarkube/sugarkube/internal/pkg/vars"
 	"testing"
 )
 
@@ -39,6 +40,7 @@ func TestLoadStackConfig(t *testing.T) {
 				Kapps: []Kapp{
 					{
 						Id:              "kappA",
+						manifestId:      "manifest1",
 						ShouldBePresent: true,
 						Sources: []acquirer.Acquirer{
 							acquirer.NewGitAcquirer(
@@ -56,6 +58,7 @@ func TestLoadStackConfig(t *testing.T) {
 				Kapps: []Kapp{
 					{
 						Id:              "kappB",
+						manifestId:      "exampleManifest2",
 						ShouldBePresent: true,
 						Sources: []acquirer.Acquirer{
 							acquirer.NewGitAcquirer(
@@ -75,11 +78,138 @@ func TestLoadStackConfig(t *testing.T) {
 	assert.Equal(t, expected, actual, "unexpected stack")
 }
 
+// every stack in the examples should load
+func TestLoadExampleStacks(t *testing.T) {
+	path := "../../../examples/stacks.yaml"
+
+	data, err := vars.LoadYamlFile(path)
+	assert.Nil(t, err)
+	assert.NotEmpty(t, data)
+
+	for name := range data {
+		stackConfig, err := LoadStackConfig(name, path)
+		assert.Nil(t, err, "stack '%s' should load", name)
+
+		if name == "aws-dev" {
+			assert.Equal(t, "eu-west-1", stackConfig.Region)
+		}
+	}
+}
+
 func TestLoadStackConfigMissingStackName(t *testing.T) {
 	_, err := LoadStackConfig("missing-stack-name", "../../testdata/stacks.yaml")
 	assert.Error(t, err)
 }
 
+func TestValidateStackConfig(t *testing.T) {
+	stackConfig := &StackConfig{
+		Name: "test",
+		Manifests: []Manifest{
+			{Id: "manifest1", Kapps: []Kapp{{Id: "kappA"}, {Id: "kappB"}, {Id: "kappA"}}},
+			{Id: "manifest2", Kapps: []Kapp{{Id: "kappB"}}},
+			{Id: "manifest1"},
+		},
+	}
+
+	err := ValidateStackConfig(stackConfig)
+	assert.Error(t, err)
+	assert.Equal(t, `Invalid stack 'test':
+  Multiple kapps exist in manifest 'manifest1' with the same id: kappA
+  Multiple manifests exist with the same id: manifest1`, err.Error())
+
+	// different manifests can declare kapps with the same ID
+	stackConfig.Manifests = []Manifest{
+		{Id: "manifest1", Kapps: []Kapp{{Id: "kappA"}, {Id: "kappB"}}},
+		{Id: "manifest2", Kapps: []Kapp{{Id: "kappB"}}},
+	}
+	for i := range stackConfig.Manifests {
+		stackConfig.Manifests[i].setKappManifestIds()
+	}
+	assert.Nil(t, ValidateStackConfig(stackConfig))
+
+	// but unqualified references to them must be unambiguous
+	stackConfig.Ignored = []string{"kappB"}
+	stackConfig.Manifests[0].Kapps[0].DependsOn = []string{"kappB"}
+	err = ValidateStackConfig(stackConfig)
+	assert.Error(t, err)
+	assert.Equal(t, `Invalid stack 'test':
+  Invalid dependency of kapp 'manifest1:kappA': Kapp ID 'kappB' is ambiguous. Use one of: manifest1:kappB, manifest2:kappB
+  Invalid ignored kapp: Kapp ID 'kappB' is ambiguous. Use one of: manifest1:kappB, manifest2:kappB`, err.Error())
+
+	stackConfig.Ignored = []string{"manifest2:kappB"}
+	stackConfig.Manifests[0].Kapps[0].DependsOn = []string{"manifest1:kappB"}
+	assert.Nil(t, ValidateStackConfig(stackConfig))
+
+	stackConfig.Ignored = nil
+	stackConfig.Manifests = stackConfig.Manifests[1:2]
+	stackConfig.Manifests[0].Kapps[0].DependsOn = nil
+	assert.Nil(t, ValidateStackConfig(stackConfig))
+
+	stackConfig.Ignored = []string{"manifest2:kappB", "manifest1:kappB"}
+	stackConfig.Manifests[0].Ignored = []string{"kappC"}
+	err = ValidateStackConfig(stackConfig)
+	assert.Error(t, err)
+	assert.Equal(t, `Invalid stack 'test':
+  Manifest 'manifest2' ignores kapp 'kappC' which it doesn't declare
+  Invalid ignored kapp: No kapp 'manifest1:kappB' found in stack 'test'`, err.Error())
+
+	stackConfig.Ignored = nil
+	stackConfig.Manifests[0].Ignored = nil
+	stackConfig.Manifests[0].Kapps[0].DependsOn = []string{"kappB", "kappD"}
+	err = ValidateStackConfig(stackConfig)
+	assert.Error(t, err)
+	assert.Equal(t, `Invalid stack 'test':
+  Kapp 'manifest2:kappB' depends on itself
+  Invalid dependency of kapp 'manifest2:kappB': No kapp 'kappD' found in stack 'test'`, err.Error())
+}
+
+func TestIsIgnored(t *testing.T) {
+	stackConfig := &StackConfig{
+		Ignored: []string{"manifest1:kappA", "kappC"},
+		Manifests: []Manifest{
+			{Id: "manifest1", Ignored: []string{"kappB"}, Kapps: []Kapp{
+				{Id: "kappA", manifestId: "manifest1"},
+				{Id: "kappB", manifestId: "manifest1"},
+			}},
+			{Id: "manifest2", Kapps: []Kapp{
+				{Id: "kappC", manifestId: "manifest2"},
+				{Id: "kappD", manifestId: "manifest2"},
+			}},
+		},
+	}
+
+	expected := map[string]bool{
+		"manifest1:kappA": true,
+		"manifest1:kappB": true,
+		"manifest2:kappC": true,
+		"manifest2:kappD": false,
+	}
+
+	for _, manifest := range stackConfig.Manifests {
+		for _, kappObj := range manifest.Kapps {
+			assert.Equal(t, expected[kappObj.FullyQualifiedId()],
+				stackConfig.IsIgnored(kappObj), kappObj.FullyQualifiedId())
+		}
+	}
+}
+
+func TestFindKapp(t *testing.T) {
+	stackConfig, err := LoadStackConfig("large", "../../testdata/stacks.yaml")
+	assert.Nil(t, err)
+
+	kappObj, err := stackConfig.FindKapp("exampleManifest2:kappB")
+	assert.Nil(t, err)
+	assert.Equal(t, "kappB", kappObj.Id)
+	assert.Equal(t, "exampleManifest2:kappB", kappObj.FullyQualifiedId())
+
+	kappObj, err = stackConfig.FindKapp("kappA")
+	assert.Nil(t, err)
+	assert.Equal(t, "manifest1:kappA", kappObj.FullyQualifiedId())
+
+	_, err = stackConfig.FindKapp("manifest1:kappB")
+	assert.Error(t, err)
+}
+
 func TestDir(t *testing.T) {
 	stack := StackConfig{
 		FilePath: "../../testdata/stacks.yaml",
@@ -0,0 +1,253 @@
+package kapp
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/sugarkube/sugarkube/internal/pkg/acquirer"
+	"github.com/sugarkube/sugarkube/internal/pkg/log"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Sources can declare a version constraint alongside the branch they're pinned
+// to, e.g.:
+//
+//   - uri: git@github.com:sugarkube/kapps.git
+//     version: wordpress-~0.1
+//     branch: wordpress-0.1.0
+//     path: incubator/wordpress
+//
+// Updating a manifest rewrites each `branch` to the newest tag matching its
+// `version`. Manifests are edited as text instead of being round-tripped
+// through the YAML library so comments and formatting are preserved.
+
+// Describes a source whose branch was changed
+type VersionBump struct {
+	KappId     string
+	Uri        string
+	Path       string
+	Constraint string
+	From       string
+	To         string
+}
+
+func (b VersionBump) String() string {
+	from := b.From
+	if from == "" {
+		from = "(unpinned)"
+	}
+
+	return fmt.Sprintf("%s (%s %s): %s -> %s", b.KappId, b.Uri, b.Path, from, b.To)
+}
+
+// Resolves a version constraint for a source URI to a tag
+type TagResolver func(uri string, constraint string) (string, error)
+
+var sourceKeyRegex = regexp.MustCompile(`^(\s*)(-\s+)?([A-Za-z_]+):\s*(.*)$`)
+var branchValueRegex = regexp.MustCompile(`^(\s*(?:-\s+)?branch:\s*)(["']?)([^"'\s#]*)(["']?)(.*)$`)
+
+// Updates the branches of all sources with version constraints in a manifest
+// file to the newest matching tags. The file is only written if not a dry run.
+func UpdateManifestFile(path string, dryRun bool) ([]VersionBump, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Error reading manifest %s", path)
+	}
+
+	updated, bumps, err := UpdateManifestVersions(data, acquirer.LatestMatchingTag)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Error updating manifest %s", path)
+	}
+
+	if len(bumps) == 0 {
+		log.Debugf("No versions to update in manifest %s", path)
+		return bumps, nil
+	}
+
+	if dryRun {
+		log.Infof("Dry run. Not writing updated manifest %s", path)
+		return bumps, nil
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	err = ioutil.WriteFile(path, updated, info.Mode())
+	if err != nil {
+		return nil, errors.Wrapf(err, "Error writing manifest %s", path)
+	}
+
+	return bumps, nil
+}
+
+// Rewrites manifest YAML so that each source with a `version` constraint has
+// its `branch` set to the newest tag returned by the resolver
+func UpdateManifestVersions(data []byte, resolve TagResolver) ([]byte, []VersionBump, error) {
+	lines := strings.Split(string(data), "\n")
+	bumps := make([]VersionBump, 0)
+
+	// lines to insert, keyed by the index of the line to insert them after
+	insertions := map[int]string{}
+
+	for i, line := range lines {
+		matches := sourceKeyRegex.FindStringSubmatch(line)
+		if matches == nil || matches[3] != acquirer.VERSION {
+			continue
+		}
+
+		keyIndent := len(matches[1]) + len(matches[2])
+
+		start, end, err := sourceBounds(lines, i, keyIndent)
+		if err != nil {
+			return nil, nil, errors.WithStack(err)
+		}
+
+		settings, settingLines := sourceSettings(lines, start, end, keyIndent)
+
+		constraint := settings[acquirer.VERSION]
+		if _, _, ok := acquirer.SplitRefConstraint(constraint); !ok {
+			log.Debugf("Version '%s' on line %d isn't a constraint. Skipping.",
+				constraint, i+1)
+			continue
+		}
+
+		tag, err := resolve(settings[acquirer.URI], constraint)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "Error resolving version on line %d", i+1)
+		}
+
+		currentBranch := settings[acquirer.BRANCH]
+		if currentBranch == tag {
+			continue
+		}
+
+		bumps = append(bumps, VersionBump{
+			KappId:     enclosingKappId(lines, start),
+			Uri:        settings[acquirer.URI],
+			Path:       settings[acquirer.PATH],
+			Constraint: constraint,
+			From:       currentBranch,
+			To:         tag,
+		})
+
+		if branchLine, ok := settingLines[acquirer.BRANCH]; ok {
+			lines[branchLine] = branchValueRegex.ReplaceAllString(lines[branchLine],
+				"${1}${2}"+tag+"${4}${5}")
+		} else {
+			insertions[i] = strings.Repeat(" ", keyIndent) + acquirer.BRANCH + ": " + tag
+		}
+	}
+
+	output := make([]string, 0, len(lines)+len(insertions))
+	for i, line := range lines {
+		output = append(output, line)
+		if insertion, ok := insertions[i]; ok {
+			output = append(output, insertion)
+		}
+	}
+
+	return []byte(strings.Join(output, "\n")), bumps, nil
+}
+
+// Returns the indentation of a line and whether it contains anything other
+// than whitespace and comments
+func lineIndent(line string) (int, bool) {
+	trimmed := strings.TrimLeft(line, " ")
+	if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+		return 0, false
+	}
+	return len(line) - len(trimmed), true
+}
+
+// Returns the first and last+1 line indices of the source list item
+// containing the given line
+func sourceBounds(lines []string, lineIndex int, keyIndent int) (int, int, error) {
+	start := -1
+	for j := lineIndex; j >= 0; j-- {
+		indent, ok := lineIndent(lines[j])
+		if !ok {
+			continue
+		}
+
+		matches := sourceKeyRegex.FindStringSubmatch(lines[j])
+		if matches != nil && matches[2] != "" && len(matches[1])+len(matches[2]) == keyIndent {
+			start = j
+			break
+		}
+
+		if indent < keyIndent {
+			break
+		}
+	}
+
+	if start < 0 {
+		return 0, 0, errors.New(fmt.Sprintf("The version on line %d isn't "+
+			"part of a list of sources", lineIndex+1))
+	}
+
+	end := len(lines)
+	for j := start + 1; j < len(lines); j++ {
+		if indent, ok := lineIndent(lines[j]); ok && indent < keyIndent {
+			end = j
+			break
+		}
+	}
+
+	return start, end, nil
+}
+
+// Returns the scalar settings of a source list item along with the line each
+// was found on
+func sourceSettings(lines []string, start int, end int, keyIndent int) (map[string]string, map[string]int) {
+	settings := map[string]string{}
+	settingLines := map[string]int{}
+
+	for j := start; j < end; j++ {
+		matches := sourceKeyRegex.FindStringSubmatch(lines[j])
+		if matches == nil || len(matches[1])+len(matches[2]) != keyIndent {
+			continue
+		}
+
+		value := matches[4]
+		if commentStart := strings.Index(value, " #"); commentStart >= 0 {
+			value = value[:commentStart]
+		}
+		value = strings.Trim(strings.TrimSpace(value), `"'`)
+
+		settings[matches[3]] = value
+		settingLines[matches[3]] = j
+	}
+
+	return settings, settingLines
+}
+
+// Walks up from a source list item to find the ID of the kapp it belongs to
+func enclosingKappId(lines []string, sourceStart int) string {
+	indent, _ := lineIndent(lines[sourceStart])
+
+	// find the `sources` key. List items may be indented at the same level
+	// as their parent key.
+	j := sourceStart - 1
+	for ; j >= 0; j-- {
+		matches := sourceKeyRegex.FindStringSubmatch(lines[j])
+		if matches != nil && matches[2] == "" && matches[3] == SOURCES_KEY &&
+			len(matches[1]) <= indent {
+			indent = len(matches[1])
+			break
+		}
+	}
+
+	// the kapp ID is the first key that's less indented than `sources`
+	for j--; j >= 0; j-- {
+		lineIndentation, ok := lineIndent(lines[j])
+		if ok && lineIndentation < indent {
+			return strings.TrimSuffix(strings.Fields(lines[j])[0], ":")
+		}
+	}
+
+	return ""
+}
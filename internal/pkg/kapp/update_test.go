@@ -0,0 +1,84 @@
+package kapp
+
+import (
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestUpdateManifestVersions(t *testing.T) {
+	input := `present:
+  wordpress:
+    sources:
+    - uri: git@github.com:sugarkube/kapps.git
+      version: wordpress-~0.1   # allow patch releases
+      branch: "wordpress-0.1.0"   # pinned by 'manifest update'
+      path: incubator/wordpress
+    - uri: git@github.com:sugarkube/kapps.git
+      branch: master
+      path: incubator/common-makefiles
+
+  tiller:
+    sources:
+      - version: tiller-~0.2
+        uri: git@github.com:sugarkube/kapps.git
+        path: incubator/tiller
+`
+
+	expected := `present:
+  wordpress:
+    sources:
+    - uri: git@github.com:sugarkube/kapps.git
+      version: wordpress-~0.1   # allow patch releases
+      branch: "wordpress-0.1.3"   # pinned by 'manifest update'
+      path: incubator/wordpress
+    - uri: git@github.com:sugarkube/kapps.git
+      branch: master
+      path: incubator/common-makefiles
+
+  tiller:
+    sources:
+      - version: tiller-~0.2
+        branch: tiller-0.2.4
+        uri: git@github.com:sugarkube/kapps.git
+        path: incubator/tiller
+`
+
+	resolver := func(uri string, constraint string) (string, error) {
+		switch constraint {
+		case "wordpress-~0.1":
+			return "wordpress-0.1.3", nil
+		case "tiller-~0.2":
+			return "tiller-0.2.4", nil
+		}
+		return "", errors.New("unexpected constraint")
+	}
+
+	result, bumps, err := UpdateManifestVersions([]byte(input), resolver)
+	assert.Nil(t, err)
+	assert.Equal(t, expected, string(result))
+	assert.Equal(t, []VersionBump{
+		{
+			KappId:     "wordpress",
+			Uri:        "git@github.com:sugarkube/kapps.git",
+			Path:       "incubator/wordpress",
+			Constraint: "wordpress-~0.1",
+			From:       "wordpress-0.1.0",
+			To:         "wordpress-0.1.3",
+		},
+		{
+			KappId:     "tiller",
+			Uri:        "git@github.com:sugarkube/kapps.git",
+			Path:       "incubator/tiller",
+			Constraint: "tiller-~0.2",
+			From:       "",
+			To:         "tiller-0.2.4",
+		},
+	}, bumps)
+
+	// running again should be a no-op
+	result, bumps, err = UpdateManifestVersions(result, resolver)
+	assert.Nil(t, err)
+	assert.Equal(t, expected, string(result))
+	assert.Empty(t, bumps)
+}
@@ -0,0 +1,362 @@
+package locker
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/sugarkube/sugarkube/internal/pkg/acquirer"
+	"github.com/sugarkube/sugarkube/internal/pkg/cacher"
+	"github.com/sugarkube/sugarkube/internal/pkg/kapp"
+	"github.com/sugarkube/sugarkube/internal/pkg/log"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Lockfiles record the exact revision of every source in a stack so caches
+// can be rebuilt reproducibly even when manifests refer to branches. They're
+// saved next to the stack config file, e.g. `stacks.yaml` is locked by
+// `stacks.lock`, and can contain entries for several stacks.
+
+const LOCKFILE_EXTENSION = ".lock"
+
+// The locked revision of a single kapp source
+type LockedSource struct {
+	Manifest string `yaml:"manifest"`
+	Kapp     string `yaml:"kapp"`
+	Name     string `yaml:"name"`
+	// the ID of the acquirer as declared in the manifest. If this changes the
+	// manifest no longer agrees with the lockfile.
+	Id       string `yaml:"id"`
+	Path     string `yaml:"path"`
+	Revision string `yaml:"revision"`
+}
+
+type StackLock struct {
+	Sources []LockedSource `yaml:"sources"`
+}
+
+type Lockfile struct {
+	Stacks map[string]StackLock `yaml:"stacks"`
+}
+
+// Describes a difference between a lockfile and manifests or a cache
+type Drift struct {
+	Manifest string
+	Kapp     string
+	Name     string
+	Reason   string
+}
+
+func (d Drift) String() string {
+	return fmt.Sprintf("%s/%s source '%s': %s", d.Manifest, d.Kapp, d.Name, d.Reason)
+}
+
+// Returns the path of the lockfile for a stack config file
+func PathForStackFile(stackFile string) string {
+	return strings.TrimSuffix(stackFile, filepath.Ext(stackFile)) + LOCKFILE_EXTENSION
+}
+
+// Loads a lockfile. An empty lockfile is returned if the file doesn't exist.
+func Load(path string) (*Lockfile, error) {
+	lockfile := &Lockfile{
+		Stacks: map[string]StackLock{},
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return lockfile, nil
+		}
+		return nil, errors.Wrapf(err, "Error reading lockfile %s", path)
+	}
+
+	err = yaml.UnmarshalStrict(data, lockfile)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Error parsing lockfile %s", path)
+	}
+
+	if lockfile.Stacks == nil {
+		lockfile.Stacks = map[string]StackLock{}
+	}
+
+	return lockfile, nil
+}
+
+// Writes a lockfile
+func (l *Lockfile) Save(path string) error {
+	data, err := yaml.Marshal(l)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	header := "# Generated by `sugarkube lock`. Do not edit by hand.\n"
+
+	err = ioutil.WriteFile(path, append([]byte(header), data...), 0644)
+	if err != nil {
+		return errors.Wrapf(err, "Error writing lockfile %s", path)
+	}
+
+	return nil
+}
+
+// Returns the lock for a stack loaded from a stack config file, or nil if
+// the stack isn't locked
+func LoadStackLock(stackConfig *kapp.StackConfig) (*StackLock, error) {
+	if stackConfig.FilePath == "" {
+		return nil, nil
+	}
+
+	path := PathForStackFile(stackConfig.FilePath)
+
+	lockfile, err := Load(path)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	stackLock, ok := lockfile.Stacks[stackConfig.Name]
+	if !ok {
+		return nil, nil
+	}
+
+	log.Debugf("Loaded lock for stack '%s' from %s", stackConfig.Name, path)
+
+	return &stackLock, nil
+}
+
+// Resolves every source in a stack to an immutable revision
+func Generate(stackConfig *kapp.StackConfig) (StackLock, error) {
+	stackLock := StackLock{
+		Sources: make([]LockedSource, 0),
+	}
+
+	for _, manifest := range stackConfig.Manifests {
+		for _, kappObj := range manifest.Kapps {
+			for _, acquirerImpl := range kappObj.Sources {
+				id, err := acquirerImpl.Id()
+				if err != nil {
+					return stackLock, errors.WithStack(err)
+				}
+
+				revision, err := acquirer.Revision(acquirerImpl)
+				if err != nil {
+					return stackLock, errors.Wrapf(err, "Error locking source "+
+						"'%s' of kapp '%s' in manifest '%s'", acquirerImpl.Name(),
+						kappObj.Id, manifest.Id)
+				}
+
+				log.Debugf("Locked %s to %s", id, revision)
+
+				stackLock.Sources = append(stackLock.Sources, LockedSource{
+					Manifest: manifest.Id,
+					Kapp:     kappObj.Id,
+					Name:     acquirerImpl.Name(),
+					Id:       id,
+					Path:     acquirerImpl.Path(),
+					Revision: revision,
+				})
+			}
+		}
+	}
+
+	return stackLock, nil
+}
+
+func (l StackLock) find(manifestId string, kappId string, name string) (LockedSource, bool) {
+	for _, source := range l.Sources {
+		if source.Manifest == manifestId && source.Kapp == kappId && source.Name == name {
+			return source, true
+		}
+	}
+
+	return LockedSource{}, false
+}
+
+// Returns any differences between the sources declared in a stack's
+// manifests and the lock
+func (l StackLock) Diff(stackConfig *kapp.StackConfig) ([]Drift, error) {
+	drifts := make([]Drift, 0)
+	seen := map[LockedSource]bool{}
+
+	for _, manifest := range stackConfig.Manifests {
+		for _, kappObj := range manifest.Kapps {
+			for _, acquirerImpl := range kappObj.Sources {
+				id, err := acquirerImpl.Id()
+				if err != nil {
+					return nil, errors.WithStack(err)
+				}
+
+				drift := Drift{
+					Manifest: manifest.Id,
+					Kapp:     kappObj.Id,
+					Name:     acquirerImpl.Name(),
+				}
+
+				locked, ok := l.find(manifest.Id, kappObj.Id, acquirerImpl.Name())
+				if !ok {
+					drift.Reason = "not in lockfile"
+					drifts = append(drifts, drift)
+					continue
+				}
+
+				seen[locked] = true
+
+				if locked.Id != id || locked.Path != acquirerImpl.Path() {
+					drift.Reason = fmt.Sprintf("manifest declares '%s' (path '%s') but "+
+						"lockfile has '%s' (path '%s')", id, acquirerImpl.Path(),
+						locked.Id, locked.Path)
+					drifts = append(drifts, drift)
+				}
+			}
+		}
+	}
+
+	for _, locked := range l.Sources {
+		if !seen[locked] {
+			drifts = append(drifts, Drift{
+				Manifest: locked.Manifest,
+				Kapp:     locked.Kapp,
+				Name:     locked.Name,
+				Reason:   "in lockfile but not in manifests",
+			})
+		}
+	}
+
+	return drifts, nil
+}
+
+// Pins each source in a stack to its locked revision. Sources that disagree
+// with the lockfile are left unpinned with a warning, or cause an error if
+// `frozen` is true.
+func Apply(stackLock *StackLock, stackConfig *kapp.StackConfig, frozen bool) error {
+	drifts, err := stackLock.Diff(stackConfig)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if len(drifts) > 0 {
+		if frozen {
+			return errors.New(fmt.Sprintf("Manifests and lockfile disagree:\n  %s",
+				joinDrifts(drifts)))
+		}
+
+		log.Warnf("Manifests and lockfile disagree. Run `sugarkube lock` to "+
+			"update it. Unlocked sources will use their declared "+
+			"versions:\n  %s", joinDrifts(drifts))
+	}
+
+	for i, manifest := range stackConfig.Manifests {
+		for j, kappObj := range manifest.Kapps {
+			for k, acquirerImpl := range kappObj.Sources {
+				locked, ok := stackLock.find(manifest.Id, kappObj.Id, acquirerImpl.Name())
+				if !ok {
+					continue
+				}
+
+				id, err := acquirerImpl.Id()
+				if err != nil {
+					return errors.WithStack(err)
+				}
+
+				if locked.Id != id || locked.Path != acquirerImpl.Path() {
+					continue
+				}
+
+				stackConfig.Manifests[i].Kapps[j].Sources[k] = acquirer.Pin(acquirerImpl,
+					locked.Revision)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Loads the stack's lock if there is one, checks the manifests agree with it
+// and pins sources to the locked revisions. Returns nil if the stack isn't
+// locked, which is an error if `frozen` is true.
+func ApplyToStack(stackConfig *kapp.StackConfig, frozen bool) (*StackLock, error) {
+	stackLock, err := LoadStackLock(stackConfig)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if stackLock == nil {
+		if frozen {
+			return nil, errors.New("No lockfile found for the stack but --frozen was given")
+		}
+		return nil, nil
+	}
+
+	log.Infof("Using revisions from the lockfile for stack '%s'", stackConfig.Name)
+
+	err = Apply(stackLock, stackConfig, frozen)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return stackLock, nil
+}
+
+// Returns any sources in a cache that aren't checked out at their locked
+// revisions
+func VerifyCache(stackLock *StackLock, stackConfig *kapp.StackConfig,
+	cacheDir string) ([]Drift, error) {
+	drifts := make([]Drift, 0)
+
+	for _, manifest := range stackConfig.Manifests {
+		manifestCacheDir := cacher.GetManifestCachePath(cacheDir, manifest)
+
+		for _, kappObj := range manifest.Kapps {
+			// unselected kapps may not have been cached
+			if !stackConfig.IsSelected(kappObj) {
+				continue
+			}
+
+			for _, acquirerImpl := range kappObj.Sources {
+				locked, ok := stackLock.find(manifest.Id, kappObj.Id, acquirerImpl.Name())
+				if !ok {
+					continue
+				}
+
+				id, err := acquirerImpl.Id()
+				if err != nil {
+					return nil, errors.WithStack(err)
+				}
+
+				drift := Drift{
+					Manifest: manifest.Id,
+					Kapp:     kappObj.Id,
+					Name:     acquirerImpl.Name(),
+				}
+
+				revision, err := acquirer.CachedRevision(acquirerImpl,
+					cacher.GetSourceCachePath(manifestCacheDir, kappObj,
+						acquirerImpl.Name(), id))
+				if err != nil {
+					log.Debugf("Error getting cached revision: %s", err)
+					drift.Reason = "not found in the cache"
+					drifts = append(drifts, drift)
+					continue
+				}
+
+				if revision != locked.Revision {
+					drift.Reason = fmt.Sprintf("cached at %s but locked to %s",
+						revision, locked.Revision)
+					drifts = append(drifts, drift)
+				}
+			}
+		}
+	}
+
+	return drifts, nil
+}
+
+func joinDrifts(drifts []Drift) string {
+	lines := make([]string, 0)
+	for _, drift := range drifts {
+		lines = append(lines, drift.String())
+	}
+
+	return strings.Join(lines, "\n  ")
+}
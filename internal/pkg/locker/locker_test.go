@@ -0,0 +1,235 @@
+package locker
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/sugarkube/sugarkube/internal/pkg/acquirer"
+	"github.com/sugarkube/sugarkube/internal/pkg/cacher"
+	"github.com/sugarkube/sugarkube/internal/pkg/kapp"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func testStackConfig() *kapp.StackConfig {
+	return &kapp.StackConfig{
+		Name: "test",
+		Manifests: []kapp.Manifest{
+			{
+				Id: "manifest1",
+				Kapps: []kapp.Kapp{
+					{
+						Id: "kappA",
+						Sources: []acquirer.Acquirer{
+							acquirer.NewGitAcquirer("pathA",
+								"git@github.com:sugarkube/kapps-A.git",
+								"master", "some/pathA"),
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestPathForStackFile(t *testing.T) {
+	assert.Equal(t, "/some/dir/stacks.lock", PathForStackFile("/some/dir/stacks.yaml"))
+}
+
+func TestDiff(t *testing.T) {
+	stackLock := StackLock{
+		Sources: []LockedSource{
+			{
+				Manifest: "manifest1",
+				Kapp:     "kappA",
+				Name:     "pathA",
+				Id:       "sugarkube-kapps-A-master-pathA",
+				Path:     "some/pathA",
+				Revision: "abc123",
+			},
+		},
+	}
+
+	drifts, err := stackLock.Diff(testStackConfig())
+	assert.Nil(t, err)
+	assert.Empty(t, drifts)
+
+	// changing the branch in the manifest should be reported
+	stackConfig := testStackConfig()
+	stackConfig.Manifests[0].Kapps[0].Sources[0] = acquirer.NewGitAcquirer("pathA",
+		"git@github.com:sugarkube/kapps-A.git", "develop", "some/pathA")
+
+	drifts, err = stackLock.Diff(stackConfig)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(drifts))
+
+	err = Apply(&stackLock, stackConfig, true)
+	assert.NotNil(t, err, "frozen lockfiles should reject drift")
+
+	// sources only in the lockfile should be reported
+	stackLock.Sources = append(stackLock.Sources, LockedSource{
+		Manifest: "manifest1",
+		Kapp:     "kappB",
+		Name:     "pathB",
+	})
+
+	drifts, err = stackLock.Diff(testStackConfig())
+	assert.Nil(t, err)
+	assert.Equal(t, []Drift{
+		{
+			Manifest: "manifest1",
+			Kapp:     "kappB",
+			Name:     "pathB",
+			Reason:   "in lockfile but not in manifests",
+		},
+	}, drifts)
+}
+
+func TestApply(t *testing.T) {
+	stackLock := StackLock{
+		Sources: []LockedSource{
+			{
+				Manifest: "manifest1",
+				Kapp:     "kappA",
+				Name:     "pathA",
+				Id:       "sugarkube-kapps-A-master-pathA",
+				Path:     "some/pathA",
+				Revision: "abc123",
+			},
+		},
+	}
+
+	stackConfig := testStackConfig()
+	err := Apply(&stackLock, stackConfig, true)
+	assert.Nil(t, err)
+
+	revision, err := acquirer.Revision(stackConfig.Manifests[0].Kapps[0].Sources[0])
+	assert.Nil(t, err)
+	assert.Equal(t, "abc123", revision)
+}
+
+func TestSaveLoad(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "sugarkube-lock-")
+	assert.Nil(t, err)
+	defer os.RemoveAll(tempDir)
+
+	path := filepath.Join(tempDir, "stacks.lock")
+
+	lockfile, err := Load(path)
+	assert.Nil(t, err)
+	assert.Empty(t, lockfile.Stacks)
+
+	lockfile.Stacks["test"] = StackLock{
+		Sources: []LockedSource{
+			{Manifest: "manifest1", Kapp: "kappA", Name: "pathA", Revision: "abc123"},
+		},
+	}
+
+	err = lockfile.Save(path)
+	assert.Nil(t, err)
+
+	loaded, err := Load(path)
+	assert.Nil(t, err)
+	assert.Equal(t, lockfile, loaded)
+}
+
+// Creates a git repo with a commit of `chart/` for each tag
+func testRepo(t *testing.T, dir string, tags ...string) {
+	git := func(args ...string) {
+		cmd := exec.Command("git", append([]string{"-c", "user.name=test",
+			"-c", "user.email=test@example.com"}, args...)...)
+		cmd.Dir = dir
+		output, err := cmd.CombinedOutput()
+		assert.Nil(t, err, string(output))
+	}
+
+	git("init", "-q")
+	for _, tag := range tags {
+		err := os.MkdirAll(filepath.Join(dir, "chart"), 0755)
+		assert.Nil(t, err)
+		err = ioutil.WriteFile(filepath.Join(dir, "chart", "version"), []byte(tag), 0644)
+		assert.Nil(t, err)
+
+		git("add", "-A")
+		git("commit", "-q", "-m", tag)
+		git("tag", tag)
+	}
+}
+
+func TestVerifyCacheResolved(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "sugarkube-lock-")
+	assert.Nil(t, err)
+	defer os.RemoveAll(tempDir)
+
+	repoDir := filepath.Join(tempDir, "repo")
+	err = os.MkdirAll(repoDir, 0755)
+	assert.Nil(t, err)
+	testRepo(t, repoDir, "wordpress-0.1.0", "wordpress-0.1.1", "wordpress-0.2.0")
+
+	stackConfig := testStackConfig()
+	stackConfig.Manifests[0].Kapps[0].Sources = []acquirer.Acquirer{
+		acquirer.NewGitAcquirer("chart", fmt.Sprintf("file://%s", repoDir),
+			"wordpress-~0.1", "chart"),
+	}
+
+	stackLock, err := Generate(stackConfig)
+	assert.Nil(t, err)
+
+	cacheDir := filepath.Join(tempDir, "cache")
+	err = cacher.CacheManifest(stackConfig.Manifests[0], cacheDir, false)
+	assert.Nil(t, err)
+
+	// the source should be checked out at the tag the constraint resolved to
+	version, err := ioutil.ReadFile(filepath.Join(cacheDir, "manifest1", "kappA",
+		"chart", "version"))
+	assert.Nil(t, err)
+	assert.Equal(t, "wordpress-0.1.1", string(version))
+
+	// and found where the cache is verified without resolving it again
+	drifts, err := VerifyCache(&stackLock, stackConfig, cacheDir)
+	assert.Nil(t, err)
+	assert.Empty(t, drifts)
+}
+
+func TestApplyToStack(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "sugarkube-lock-")
+	assert.Nil(t, err)
+	defer os.RemoveAll(tempDir)
+
+	stackConfig := testStackConfig()
+	stackConfig.FilePath = filepath.Join(tempDir, "stacks.yaml")
+
+	stackLock, err := ApplyToStack(stackConfig, false)
+	assert.Nil(t, err)
+	assert.Nil(t, stackLock, "stacks without lockfiles shouldn't be locked")
+
+	_, err = ApplyToStack(stackConfig, true)
+	assert.Error(t, err, "frozen stacks must have lockfiles")
+
+	lockfile := Lockfile{Stacks: map[string]StackLock{
+		"test": {
+			Sources: []LockedSource{
+				{
+					Manifest: "manifest1",
+					Kapp:     "kappA",
+					Name:     "pathA",
+					Id:       "sugarkube-kapps-A-master-pathA",
+					Path:     "some/pathA",
+					Revision: "abc123",
+				},
+			},
+		},
+	}}
+	err = lockfile.Save(PathForStackFile(stackConfig.FilePath))
+	assert.Nil(t, err)
+
+	stackLock, err = ApplyToStack(stackConfig, true)
+	assert.Nil(t, err)
+	assert.NotNil(t, stackLock)
+
+	revision, err := acquirer.Revision(stackConfig.Manifests[0].Kapps[0].Sources[0])
+	assert.Nil(t, err)
+	assert.Equal(t, "abc123", revision)
+}
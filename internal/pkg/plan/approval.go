@@ -0,0 +1,152 @@
+package plan
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/sugarkube/sugarkube/internal/pkg/cacher"
+	"github.com/sugarkube/sugarkube/internal/pkg/installer"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+// The changes kapps planned to make when the plan was run with
+// APPROVED=false, so destructive ones can be approved before the plan is run
+// with APPROVED=true
+type ChangeReport struct {
+	Kapps []KappChanges
+}
+
+type KappChanges struct {
+	// fully qualified kapp ID
+	Id string
+	// the phase the kapp is processed in
+	Action string
+	// false if the kapp's planned changes couldn't be found
+	Found   bool
+	Changes []installer.Change
+}
+
+// Returns whether kapps will destroy or replace anything. Destroying a kapp is
+// always destructive.
+func (k KappChanges) IsDestructive() bool {
+	if k.Action == PHASE_DESTROY {
+		return true
+	}
+
+	for _, change := range k.Changes {
+		if change.IsDestructive() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Collects the changes each kapp in the plan planned the last time it was run
+// with APPROVED=false
+func (p *Plan) ChangeReport() (*ChangeReport, error) {
+	report := &ChangeReport{
+		Kapps: []KappChanges{},
+	}
+
+	for _, step := range p.phaseSteps() {
+		manifestCacheDir := cacher.GetManifestCachePath(p.cacheDir,
+			p.tranche[step.trancheIndex].manifest)
+
+		for _, kappObj := range step.kapps {
+			kappRootDir := cacher.GetKappRootPath(manifestCacheDir, kappObj)
+
+			changes, found, err := installer.PlannedChanges(kappRootDir)
+			if err != nil {
+				return nil, errors.Wrapf(err, "Error finding the changes "+
+					"planned by kapp '%s'", kappObj.FullyQualifiedId())
+			}
+
+			report.Kapps = append(report.Kapps, KappChanges{
+				Id:      kappObj.FullyQualifiedId(),
+				Action:  step.phase,
+				Found:   found,
+				Changes: changes,
+			})
+		}
+	}
+
+	return report, nil
+}
+
+// Returns the kapps that will destroy or replace anything
+func (r *ChangeReport) Destructive() []KappChanges {
+	destructive := make([]KappChanges, 0)
+	for _, kappChanges := range r.Kapps {
+		if kappChanges.IsDestructive() {
+			destructive = append(destructive, kappChanges)
+		}
+	}
+	return destructive
+}
+
+// Writes the report as a table. Destructive changes are listed first.
+func (r *ChangeReport) Write(out io.Writer) error {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+
+	_, err := fmt.Fprintln(w, "KAPP\tACTION\tCHANGE\tRESOURCE")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	destructiveCount := 0
+	unknown := make([]string, 0)
+
+	for _, destructive := range []bool{true, false} {
+		for _, kappChanges := range r.Kapps {
+			for _, change := range kappChanges.Changes {
+				if change.IsDestructive() != destructive {
+					continue
+				}
+				if destructive {
+					destructiveCount++
+				}
+
+				_, err = fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", kappChanges.Id,
+					kappChanges.Action, change.Action, change.Resource)
+				if err != nil {
+					return errors.WithStack(err)
+				}
+			}
+
+			// destroying a kapp is destructive even if it didn't say what
+			// it'd destroy
+			if destructive && kappChanges.Action == PHASE_DESTROY &&
+				len(kappChanges.Changes) == 0 {
+				destructiveCount++
+
+				_, err = fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", kappChanges.Id,
+					kappChanges.Action, installer.CHANGE_DESTROY, "(whole kapp)")
+				if err != nil {
+					return errors.WithStack(err)
+				}
+			}
+
+			if !destructive && !kappChanges.Found && kappChanges.Action != PHASE_DESTROY {
+				unknown = append(unknown, kappChanges.Id)
+			}
+		}
+	}
+
+	_, err = fmt.Fprintf(w, "\n%d destructive change(s) in %d kapp(s)\n",
+		destructiveCount, len(r.Destructive()))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if len(unknown) > 0 {
+		_, err = fmt.Fprintf(w, "Changes couldn't be determined for: %s\n",
+			strings.Join(unknown, ", "))
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	return w.Flush()
+}
@@ -0,0 +1,48 @@
+package plan
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"github.com/sugarkube/sugarkube/internal/pkg/installer"
+	"strings"
+	"testing"
+)
+
+func TestChangeReport(t *testing.T) {
+	report := &ChangeReport{
+		Kapps: []KappChanges{
+			{
+				Id:     "manifest1:kappA",
+				Action: PHASE_INSTALL,
+				Found:  true,
+				Changes: []installer.Change{
+					{Resource: "aws_security_group.db", Action: installer.CHANGE_UPDATE},
+					{Resource: "aws_db_instance.main", Action: installer.CHANGE_REPLACE},
+				},
+			},
+			{Id: "manifest1:kappB", Action: PHASE_INSTALL},
+			{Id: "manifest2:kappC", Action: PHASE_DESTROY},
+		},
+	}
+
+	destructive := report.Destructive()
+	assert.Equal(t, 2, len(destructive))
+	assert.Equal(t, "manifest1:kappA", destructive[0].Id)
+	assert.Equal(t, "manifest2:kappC", destructive[1].Id,
+		"destroying kapps should always be destructive")
+
+	var out bytes.Buffer
+	assert.Nil(t, report.Write(&out))
+
+	lines := strings.Split(out.String(), "\n")
+	assert.Equal(t, []string{"KAPP", "ACTION", "CHANGE", "RESOURCE"}, strings.Fields(lines[0]))
+	// destructive changes should be listed first
+	assert.Equal(t, []string{"manifest1:kappA", "install", "replace", "aws_db_instance.main"},
+		strings.Fields(lines[1]))
+	assert.Equal(t, []string{"manifest2:kappC", "destroy", "destroy", "(whole", "kapp)"},
+		strings.Fields(lines[2]))
+	assert.Equal(t, []string{"manifest1:kappA", "install", "update", "aws_security_group.db"},
+		strings.Fields(lines[3]))
+	assert.Contains(t, out.String(), "2 destructive change(s) in 2 kapp(s)")
+	assert.Contains(t, out.String(), "Changes couldn't be determined for: manifest1:kappB")
+}
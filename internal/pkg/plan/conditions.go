@@ -0,0 +1,57 @@
+package plan
+
+import (
+	"github.com/pkg/errors"
+	"github.com/sugarkube/sugarkube/internal/pkg/expr"
+	"github.com/sugarkube/sugarkube/internal/pkg/kapp"
+	"github.com/sugarkube/sugarkube/internal/pkg/provider"
+)
+
+// Evaluates `when` conditions on manifests and kapps against a stack config.
+// Vars are only loaded the first time a condition needs evaluating so stacks
+// that don't use conditions don't pay for loading them.
+type conditionEvaluator struct {
+	stackConfig *kapp.StackConfig
+	context     map[string]interface{}
+}
+
+// Returns whether a condition is met. Empty conditions are always met.
+func (c *conditionEvaluator) matches(condition string) (bool, error) {
+	if condition == "" {
+		return true, nil
+	}
+
+	if c.context == nil {
+		context, err := conditionContext(c.stackConfig)
+		if err != nil {
+			return false, errors.WithStack(err)
+		}
+		c.context = context
+	}
+
+	return expr.Evaluate(condition, c.context)
+}
+
+// Builds the values conditions can refer to from a stack config and the vars
+// loaded by its provider
+func conditionContext(stackConfig *kapp.StackConfig) (map[string]interface{}, error) {
+	providerImpl, err := provider.NewProvider(stackConfig)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return newConditionContext(stackConfig, provider.GetVars(providerImpl)), nil
+}
+
+func newConditionContext(stackConfig *kapp.StackConfig,
+	vars provider.Values) map[string]interface{} {
+	return map[string]interface{}{
+		"provider":    stackConfig.Provider,
+		"provisioner": stackConfig.Provisioner,
+		"profile":     stackConfig.Profile,
+		"cluster":     stackConfig.Cluster,
+		"account":     stackConfig.Account,
+		"region":      stackConfig.Region,
+		"vars":        vars,
+	}
+}
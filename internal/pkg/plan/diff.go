@@ -0,0 +1,331 @@
+package plan
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/sugarkube/sugarkube/internal/pkg/acquirer"
+	"github.com/sugarkube/sugarkube/internal/pkg/cacher"
+	"github.com/sugarkube/sugarkube/internal/pkg/kapp"
+	"github.com/sugarkube/sugarkube/internal/pkg/log"
+	"github.com/sugarkube/sugarkube/internal/pkg/provider"
+	"github.com/sugarkube/sugarkube/internal/pkg/semver"
+	"github.com/sugarkube/sugarkube/internal/pkg/sot"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"strings"
+	"time"
+)
+
+// The differences between the kapps a stack says should be present or absent
+// and the kapps a source of truth says are installed in its cluster. Kapps are
+// identified by their fully qualified IDs.
+type ClusterDiff struct {
+	Stack    string `yaml:"stack"`
+	Provider string `yaml:"provider"`
+	Profile  string `yaml:"profile"`
+	Cluster  string `yaml:"cluster"`
+	Account  string `yaml:"account,omitempty"`
+	Region   string `yaml:"region,omitempty"`
+	// when the diff was generated (RFC 3339)
+	Created string `yaml:"created"`
+	// kapps that should be present but aren't installed
+	Install []KappDiff `yaml:"install"`
+	// kapps that are installed at a different version to the one they should be
+	Upgrade []KappDiff `yaml:"upgrade"`
+	// kapps that should be absent but are installed
+	Destroy []KappDiff `yaml:"destroy"`
+	// kapps that are already as they should be
+	Noop []KappDiff `yaml:"noop"`
+	// kapps that sugarkube must leave alone
+	Ignored []KappDiff `yaml:"ignored"`
+	// kapps whose conditions didn't match the stack
+	Skipped []KappDiff `yaml:"skipped"`
+}
+
+type KappDiff struct {
+	Id string `yaml:"id"`
+	// the version the kapp should be at, e.g. `wordpress-0.1.0`
+	Version          string `yaml:"version,omitempty"`
+	InstalledVersion string `yaml:"installed_version,omitempty"`
+	Reason           string `yaml:"reason,omitempty"`
+	// the kapp's `sugarkube.yaml` file. Only included in extended diffs.
+	Metadata *kapp.Metadata `yaml:"metadata,omitempty"`
+}
+
+// Actions a diff can require for a kapp
+const DIFF_INSTALL = "install"
+const DIFF_UPGRADE = "upgrade"
+const DIFF_DESTROY = "destroy"
+const DIFF_NOOP = "noop"
+
+// Queries the stack's source of truth for the kapps installed in its cluster
+// and diffs them with the plan. Extended diffs include each kapp's metadata,
+// which is loaded from the cache.
+func (p *Plan) Diff(extended bool) (*ClusterDiff, error) {
+	if extended && p.cacheDir == "" {
+		return nil, errors.New("A cache dir is required to create an extended diff")
+	}
+
+	providerImpl, err := provider.NewProvider(p.stackConfig)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	sotImpl, err := sot.NewSot(sot.Name(p.stackConfig), p.stackConfig, providerImpl)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	err = sot.Refresh(sotImpl)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error querying the source of truth")
+	}
+
+	diff := newClusterDiff(p.stackConfig)
+
+	for _, tranche := range p.tranche {
+		manifestCacheDir := cacher.GetManifestCachePath(p.cacheDir, tranche.manifest)
+
+		kapps := make([]kapp.Kapp, 0)
+		kapps = append(kapps, tranche.installables...)
+		kapps = append(kapps, tranche.destroyables...)
+
+		for _, kappObj := range kapps {
+			installedVersion, installed, err := sot.InstalledVersion(sotImpl,
+				kappObj.FullyQualifiedId())
+			if err != nil {
+				return nil, errors.WithStack(err)
+			}
+
+			action, kappDiff := diffKapp(kappObj, installedVersion, installed)
+
+			if extended {
+				kappObj.RootDir = cacher.GetKappRootPath(manifestCacheDir, kappObj)
+				err = kappObj.LoadMetadata()
+				if err != nil {
+					return nil, errors.Wrapf(err, "Error loading metadata for "+
+						"kapp '%s'", kappObj.FullyQualifiedId())
+				}
+				kappDiff.Metadata = kappObj.Metadata
+			}
+
+			switch action {
+			case DIFF_INSTALL:
+				diff.Install = append(diff.Install, kappDiff)
+			case DIFF_UPGRADE:
+				diff.Upgrade = append(diff.Upgrade, kappDiff)
+			case DIFF_DESTROY:
+				diff.Destroy = append(diff.Destroy, kappDiff)
+			default:
+				diff.Noop = append(diff.Noop, kappDiff)
+			}
+		}
+
+		for _, ignored := range tranche.ignorables {
+			diff.Ignored = append(diff.Ignored, KappDiff{
+				Id:     ignored.FullyQualifiedId(),
+				Reason: "unmanaged",
+			})
+		}
+
+		for _, skipped := range tranche.skippables {
+			diff.Skipped = append(diff.Skipped, KappDiff{
+				Id:     skipped.kapp.FullyQualifiedId(),
+				Reason: skipped.reason,
+			})
+		}
+	}
+
+	return diff, nil
+}
+
+func newClusterDiff(stackConfig *kapp.StackConfig) *ClusterDiff {
+	return &ClusterDiff{
+		Stack:    stackConfig.Name,
+		Provider: stackConfig.Provider,
+		Profile:  stackConfig.Profile,
+		Cluster:  stackConfig.Cluster,
+		Account:  stackConfig.Account,
+		Region:   stackConfig.Region,
+		Created:  time.Now().UTC().Format(time.RFC3339),
+		Install:  []KappDiff{},
+		Upgrade:  []KappDiff{},
+		Destroy:  []KappDiff{},
+		Noop:     []KappDiff{},
+		Ignored:  []KappDiff{},
+		Skipped:  []KappDiff{},
+	}
+}
+
+// Returns the action needed to make the installed state of a kapp match its
+// desired state
+func diffKapp(kappObj kapp.Kapp, installedVersion string, installed bool) (string, KappDiff) {
+	kappDiff := KappDiff{
+		Id:               kappObj.FullyQualifiedId(),
+		Version:          kappObj.Version(),
+		InstalledVersion: installedVersion,
+	}
+
+	if !kappObj.ShouldBePresent {
+		if installed {
+			return DIFF_DESTROY, kappDiff
+		}
+		kappDiff.Reason = "not installed"
+		return DIFF_NOOP, kappDiff
+	}
+
+	if !installed {
+		return DIFF_INSTALL, kappDiff
+	}
+
+	if versionMatches(kappDiff.Version, installedVersion) {
+		kappDiff.Reason = "already installed"
+		return DIFF_NOOP, kappDiff
+	}
+
+	if !isVersioned(kappDiff.Version) {
+		kappDiff.Reason = "unversioned kapps are always upgraded"
+	}
+
+	return DIFF_UPGRADE, kappDiff
+}
+
+// Returns whether a ref is an exact version (e.g. `wordpress-0.1.0`) or a
+// version constraint, as opposed to e.g. a branch
+func isVersioned(ref string) bool {
+	if _, _, ok := acquirer.SplitRefConstraint(ref); ok {
+		return true
+	}
+
+	return isExactVersion(ref)
+}
+
+// Returns whether an installed version satisfies the desired version, which
+// may be a constraint like `wordpress-~0.1`. Unversioned refs like branches
+// never match because we can't tell what's changed.
+func versionMatches(desired string, installed string) bool {
+	if desired == "" || installed == "" {
+		return false
+	}
+
+	prefix, rawConstraint, ok := acquirer.SplitRefConstraint(desired)
+	if !ok {
+		return isExactVersion(desired) && desired == installed
+	}
+
+	if !strings.HasPrefix(installed, prefix) {
+		return false
+	}
+
+	constraint, err := semver.ParseConstraint(rawConstraint)
+	if err != nil {
+		log.Warnf("Invalid version constraint '%s': %s", desired, err)
+		return false
+	}
+
+	version, err := semver.Parse(strings.TrimPrefix(installed, prefix))
+	if err != nil {
+		return false
+	}
+
+	return constraint.Check(version)
+}
+
+// Returns whether a ref is a tag like `wordpress-0.1.0` or `wordpress-0.1.0-rc1`
+func isExactVersion(ref string) bool {
+	for i, char := range ref {
+		if char != '-' {
+			continue
+		}
+
+		if _, err := semver.Parse(ref[i+1:]); err == nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Restricts the plan to the kapps that a diff says need installing, upgrading
+// or destroying. The diff must have been generated for the same stack.
+func (p *Plan) ApplyDiff(diff *ClusterDiff) error {
+	expected := newClusterDiff(p.stackConfig)
+	if diff.Stack != expected.Stack || diff.Provider != expected.Provider ||
+		diff.Profile != expected.Profile || diff.Cluster != expected.Cluster ||
+		diff.Account != expected.Account || diff.Region != expected.Region {
+		return errors.New(fmt.Sprintf("The diff is for stack '%s' (cluster "+
+			"'%s', profile '%s') but the target is stack '%s' (cluster '%s', "+
+			"profile '%s')", diff.Stack, diff.Cluster, diff.Profile,
+			expected.Stack, expected.Cluster, expected.Profile))
+	}
+
+	changes := make([]KappDiff, 0)
+	changes = append(changes, diff.Install...)
+	changes = append(changes, diff.Upgrade...)
+
+	toInstall := map[string]bool{}
+	for _, kappDiff := range changes {
+		toInstall[kappDiff.Id] = true
+	}
+
+	changes = append(changes, diff.Destroy...)
+
+	toDestroy := map[string]bool{}
+	for _, kappDiff := range diff.Destroy {
+		toDestroy[kappDiff.Id] = true
+	}
+
+	for i, tranche := range p.tranche {
+		installables := make([]kapp.Kapp, 0)
+		for _, kappObj := range tranche.installables {
+			if toInstall[kappObj.FullyQualifiedId()] {
+				installables = append(installables, kappObj)
+				delete(toInstall, kappObj.FullyQualifiedId())
+			}
+		}
+
+		destroyables := make([]kapp.Kapp, 0)
+		for _, kappObj := range tranche.destroyables {
+			if toDestroy[kappObj.FullyQualifiedId()] {
+				destroyables = append(destroyables, kappObj)
+				delete(toDestroy, kappObj.FullyQualifiedId())
+			}
+		}
+
+		p.tranche[i].installables = installables
+		p.tranche[i].destroyables = destroyables
+	}
+
+	// anything left in the diff isn't in the plan, e.g. because the manifests
+	// have changed since the diff was generated
+	unknown := make([]string, 0)
+	for _, kappDiff := range changes {
+		if toInstall[kappDiff.Id] || toDestroy[kappDiff.Id] {
+			unknown = append(unknown, kappDiff.Id)
+		}
+	}
+
+	if len(unknown) > 0 {
+		return errors.New(fmt.Sprintf("The diff is out-of-sync with the "+
+			"manifests. Regenerate it. Kapps that can't be installed/destroyed "+
+			"as the diff requires: %s", strings.Join(unknown, ", ")))
+	}
+
+	return nil
+}
+
+// Loads a cluster diff from a YAML file
+func LoadDiff(path string) (*ClusterDiff, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Error reading cluster diff %s", path)
+	}
+
+	diff := ClusterDiff{}
+	err = yaml.UnmarshalStrict(data, &diff)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Error parsing cluster diff %s", path)
+	}
+
+	return &diff, nil
+}
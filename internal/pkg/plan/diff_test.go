@@ -0,0 +1,173 @@
+package plan
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/sugarkube/sugarkube/internal/pkg/acquirer"
+	"github.com/sugarkube/sugarkube/internal/pkg/kapp"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func newTestKapp(id string, branch string, shouldBePresent bool) kapp.Kapp {
+	return kapp.Kapp{
+		Id:              id,
+		ShouldBePresent: shouldBePresent,
+		Sources: []acquirer.Acquirer{
+			acquirer.NewGitAcquirer("", "git@github.com:sugarkube/kapps.git",
+				branch, "incubator/"+id),
+		},
+	}
+}
+
+func TestDiffKapp(t *testing.T) {
+	tests := []struct {
+		name             string
+		desc             string
+		kapp             kapp.Kapp
+		installedVersion string
+		installed        bool
+		expectedAction   string
+	}{
+		{
+			name:           "install",
+			desc:           "present kapps that aren't installed should be installed",
+			kapp:           newTestKapp("wordpress", "wordpress-0.1.0", true),
+			expectedAction: DIFF_INSTALL,
+		},
+		{
+			name:             "noop_same_version",
+			desc:             "kapps installed at the right version don't need changing",
+			kapp:             newTestKapp("wordpress", "wordpress-0.1.0", true),
+			installedVersion: "wordpress-0.1.0",
+			installed:        true,
+			expectedAction:   DIFF_NOOP,
+		},
+		{
+			name:             "noop_constraint",
+			desc:             "kapps installed at a version matching a constraint don't need changing",
+			kapp:             newTestKapp("wordpress", "wordpress-~0.1", true),
+			installedVersion: "wordpress-0.1.3",
+			installed:        true,
+			expectedAction:   DIFF_NOOP,
+		},
+		{
+			name:             "upgrade",
+			desc:             "kapps installed at a different version should be upgraded",
+			kapp:             newTestKapp("wordpress", "wordpress-0.2.0", true),
+			installedVersion: "wordpress-0.1.0",
+			installed:        true,
+			expectedAction:   DIFF_UPGRADE,
+		},
+		{
+			name:             "upgrade_branch",
+			desc:             "kapps on branches are always upgraded",
+			kapp:             newTestKapp("wordpress", "master", true),
+			installedVersion: "master",
+			installed:        true,
+			expectedAction:   DIFF_UPGRADE,
+		},
+		{
+			name:             "destroy",
+			desc:             "absent kapps that are installed should be destroyed",
+			kapp:             newTestKapp("jenkins", "jenkins-0.1.0", false),
+			installedVersion: "jenkins-0.1.0",
+			installed:        true,
+			expectedAction:   DIFF_DESTROY,
+		},
+		{
+			name:           "noop_absent",
+			desc:           "absent kapps that aren't installed don't need changing",
+			kapp:           newTestKapp("jenkins", "jenkins-0.1.0", false),
+			expectedAction: DIFF_NOOP,
+		},
+	}
+
+	for _, test := range tests {
+		action, kappDiff := diffKapp(test.kapp, test.installedVersion, test.installed)
+		assert.Equal(t, test.expectedAction, action, "unexpected action for %s", test.name)
+		assert.Equal(t, test.kapp.FullyQualifiedId(), kappDiff.Id)
+		assert.Equal(t, test.installedVersion, kappDiff.InstalledVersion)
+	}
+}
+
+func TestVersionMatches(t *testing.T) {
+	tests := []struct {
+		desired   string
+		installed string
+		expected  bool
+	}{
+		{"wordpress-0.1.0", "wordpress-0.1.0", true},
+		{"wordpress-0.1.0", "wordpress-0.1.1", false},
+		{"wordpress-~0.1", "wordpress-0.1.5", true},
+		{"wordpress-~0.1", "wordpress-0.2.0", false},
+		{"wordpress-~0.1", "jenkins-0.1.0", false},
+		{"wordpress-0.1.x", "wordpress-0.1.2", true},
+		{"master", "master", false},
+		{"", "wordpress-0.1.0", false},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.expected, versionMatches(test.desired, test.installed),
+			"unexpected result comparing %s with %s", test.desired, test.installed)
+	}
+}
+
+func TestApplyDiff(t *testing.T) {
+	stackConfig, err := kapp.LoadStackConfig("large", "../../testdata/stacks.yaml")
+	assert.Nil(t, err)
+
+	actionPlan, err := Create(stackConfig, "")
+	assert.Nil(t, err)
+
+	diff := newClusterDiff(stackConfig)
+	diff.Upgrade = []KappDiff{{Id: "exampleManifest2:kappB"}}
+	diff.Noop = []KappDiff{{Id: "manifest1:kappA"}}
+
+	err = actionPlan.ApplyDiff(diff)
+	assert.Nil(t, err)
+
+	assert.Equal(t, 0, len(actionPlan.tranche[0].installables))
+	assert.Equal(t, 1, len(actionPlan.tranche[1].installables))
+	assert.Equal(t, "kappB", actionPlan.tranche[1].installables[0].Id)
+}
+
+func TestApplyDiffMismatches(t *testing.T) {
+	stackConfig, err := kapp.LoadStackConfig("large", "../../testdata/stacks.yaml")
+	assert.Nil(t, err)
+
+	actionPlan, err := Create(stackConfig, "")
+	assert.Nil(t, err)
+
+	// a diff for another cluster
+	diff := newClusterDiff(stackConfig)
+	diff.Cluster = "other"
+	assert.Error(t, actionPlan.ApplyDiff(diff))
+
+	// a diff that doesn't match the manifests
+	diff = newClusterDiff(stackConfig)
+	diff.Destroy = []KappDiff{{Id: "manifest1:kappA"}}
+	assert.Error(t, actionPlan.ApplyDiff(diff))
+}
+
+func TestLoadDiff(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "sugarkube-diff-")
+	assert.Nil(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	stackConfig := &kapp.StackConfig{Name: "large", Cluster: "large"}
+	diff := newClusterDiff(stackConfig)
+	diff.Install = []KappDiff{{Id: "web:wordpress", Version: "wordpress-0.1.0"}}
+
+	data, err := yaml.Marshal(diff)
+	assert.Nil(t, err)
+
+	path := filepath.Join(tmpDir, "diff.yaml")
+	assert.Nil(t, ioutil.WriteFile(path, data, 0644))
+
+	loaded, err := LoadDiff(path)
+	assert.Nil(t, err)
+	assert.Equal(t, diff, loaded)
+}
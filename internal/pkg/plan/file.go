@@ -0,0 +1,352 @@
+package plan
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/sugarkube/sugarkube/internal/pkg/acquirer"
+	"github.com/sugarkube/sugarkube/internal/pkg/cacher"
+	"github.com/sugarkube/sugarkube/internal/pkg/kapp"
+	"github.com/sugarkube/sugarkube/internal/pkg/log"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"strings"
+	"time"
+)
+
+// Plans can be saved with `kapps plan --out` and applied later with
+// `kapps install --plan`, e.g. so a plan can be reviewed before it's applied.
+// Saved plans record the stack they were created for and the revision of each
+// source in the cache so they can't be applied to a different cluster or
+// with a cache that's changed since.
+
+// Increment this when making incompatible changes to the format
+const PLAN_FORMAT_VERSION = 1
+
+// Actions a saved plan can take for a kapp
+const ACTION_INSTALL = "install"
+const ACTION_DESTROY = "destroy"
+const ACTION_IGNORE = "ignore"
+const ACTION_SKIP = "skip"
+
+type PlanFile struct {
+	FormatVersion int           `yaml:"format_version"`
+	Created       string        `yaml:"created"`
+	Stack         StackIdentity `yaml:"stack"`
+	// the slice of the stack's manifests the plan was created for, if any
+	Manifests *kapp.ManifestRange `yaml:"manifests,omitempty"`
+	Tranches  []PlannedTranche    `yaml:"tranches"`
+}
+
+// Identifies the stack and cluster a plan was created for
+type StackIdentity struct {
+	Name        string `yaml:"name"`
+	Provider    string `yaml:"provider"`
+	Provisioner string `yaml:"provisioner"`
+	Profile     string `yaml:"profile"`
+	Cluster     string `yaml:"cluster"`
+	Account     string `yaml:"account,omitempty"`
+	Region      string `yaml:"region,omitempty"`
+}
+
+type PlannedTranche struct {
+	Manifest string        `yaml:"manifest"`
+	Kapps    []PlannedKapp `yaml:"kapps"`
+}
+
+type PlannedKapp struct {
+	// fully qualified kapp ID
+	Id     string `yaml:"id"`
+	Action string `yaml:"action"`
+	Reason string `yaml:"reason,omitempty"`
+	// only recorded for kapps that will be installed or destroyed
+	Sources []PlannedSource `yaml:"sources,omitempty"`
+}
+
+type PlannedSource struct {
+	Name string `yaml:"name"`
+	// the ID of the acquirer as declared in the manifest
+	Id string `yaml:"id"`
+	// the revision of the source in the cache
+	Revision string `yaml:"revision"`
+}
+
+func newStackIdentity(stackConfig *kapp.StackConfig) StackIdentity {
+	return StackIdentity{
+		Name:        stackConfig.Name,
+		Provider:    stackConfig.Provider,
+		Provisioner: stackConfig.Provisioner,
+		Profile:     stackConfig.Profile,
+		Cluster:     stackConfig.Cluster,
+		Account:     stackConfig.Account,
+		Region:      stackConfig.Region,
+	}
+}
+
+// Converts the plan into its on-disk format. Sources must already be cached.
+func (p *Plan) ToFile() (*PlanFile, error) {
+	planFile := PlanFile{
+		FormatVersion: PLAN_FORMAT_VERSION,
+		Created:       time.Now().UTC().Format(time.RFC3339),
+		Stack:         newStackIdentity(p.stackConfig),
+		Tranches:      []PlannedTranche{},
+	}
+
+	manifestRange := p.stackConfig.ManifestRange()
+	if !manifestRange.IsEmpty() {
+		planFile.Manifests = &manifestRange
+	}
+
+	for _, tranche := range p.tranche {
+		manifestCacheDir := cacher.GetManifestCachePath(p.cacheDir, tranche.manifest)
+
+		plannedTranche := PlannedTranche{
+			Manifest: tranche.manifest.Id,
+			Kapps:    []PlannedKapp{},
+		}
+
+		for _, action := range []struct {
+			name  string
+			kapps []kapp.Kapp
+		}{
+			{ACTION_INSTALL, tranche.installables},
+			{ACTION_DESTROY, tranche.destroyables},
+		} {
+			for _, kappObj := range action.kapps {
+				sources, err := plannedSources(kappObj, manifestCacheDir)
+				if err != nil {
+					return nil, errors.WithStack(err)
+				}
+
+				plannedTranche.Kapps = append(plannedTranche.Kapps, PlannedKapp{
+					Id:      kappObj.FullyQualifiedId(),
+					Action:  action.name,
+					Sources: sources,
+				})
+			}
+		}
+
+		for _, kappObj := range tranche.ignorables {
+			plannedTranche.Kapps = append(plannedTranche.Kapps, PlannedKapp{
+				Id:     kappObj.FullyQualifiedId(),
+				Action: ACTION_IGNORE,
+			})
+		}
+
+		for _, skipped := range tranche.skippables {
+			plannedTranche.Kapps = append(plannedTranche.Kapps, PlannedKapp{
+				Id:     skipped.kapp.FullyQualifiedId(),
+				Action: ACTION_SKIP,
+				Reason: skipped.reason,
+			})
+		}
+
+		planFile.Tranches = append(planFile.Tranches, plannedTranche)
+	}
+
+	return &planFile, nil
+}
+
+// Returns the revisions of a kapp's sources in the cache
+func plannedSources(kappObj kapp.Kapp, manifestCacheDir string) ([]PlannedSource, error) {
+	sources := make([]PlannedSource, 0)
+
+	for _, acquirerImpl := range kappObj.Sources {
+		id, err := acquirerImpl.Id()
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		revision, err := acquirer.CachedRevision(acquirerImpl,
+			cacher.GetSourceCachePath(manifestCacheDir, kappObj, acquirerImpl.Name(), id))
+		if err != nil {
+			return nil, errors.Wrapf(err, "Source '%s' of kapp '%s' isn't in "+
+				"the cache. Run 'cache create' first", acquirerImpl.Name(),
+				kappObj.FullyQualifiedId())
+		}
+
+		sources = append(sources, PlannedSource{
+			Name:     acquirerImpl.Name(),
+			Id:       id,
+			Revision: revision,
+		})
+	}
+
+	return sources, nil
+}
+
+// Writes the plan to a YAML file
+func (p *PlanFile) Save(path string) error {
+	data, err := yaml.Marshal(p)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	err = ioutil.WriteFile(path, data, 0644)
+	if err != nil {
+		return errors.Wrapf(err, "Error writing plan %s", path)
+	}
+
+	return nil
+}
+
+// Loads a saved plan
+func LoadPlan(path string) (*PlanFile, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Error reading plan %s", path)
+	}
+
+	planFile := PlanFile{}
+	err = yaml.UnmarshalStrict(data, &planFile)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Error parsing plan %s", path)
+	}
+
+	if planFile.FormatVersion != PLAN_FORMAT_VERSION {
+		return nil, errors.New(fmt.Sprintf("Plan %s has format version %d "+
+			"but this version of sugarkube only supports version %d", path,
+			planFile.FormatVersion, PLAN_FORMAT_VERSION))
+	}
+
+	return &planFile, nil
+}
+
+// Recreates a saved plan so it can be run. All mismatches between the saved
+// plan and the stack, its manifests or the cache are reported.
+func FromFile(planFile *PlanFile, stackConfig *kapp.StackConfig, cacheDir string) (*Plan, error) {
+	problems := make([]string, 0)
+
+	identity := newStackIdentity(stackConfig)
+	if planFile.Stack != identity {
+		problems = append(problems, fmt.Sprintf("The plan is for stack '%s' "+
+			"(cluster '%s', profile '%s') but the target is stack '%s' (cluster "+
+			"'%s', profile '%s')", planFile.Stack.Name, planFile.Stack.Cluster,
+			planFile.Stack.Profile, identity.Name, identity.Cluster, identity.Profile))
+	}
+
+	// the plan only has tranches for the manifests in its range
+	if planFile.Manifests != nil {
+		err := stackConfig.SetManifestRange(*planFile.Manifests)
+		if err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+
+	tranches := make([]Tranche, 0)
+
+	for _, plannedTranche := range planFile.Tranches {
+		tranche := Tranche{
+			installables: []kapp.Kapp{},
+			destroyables: []kapp.Kapp{},
+			ignorables:   []kapp.Kapp{},
+			skippables:   []skippedKapp{},
+		}
+
+		found := false
+		for _, manifest := range stackConfig.Manifests {
+			if manifest.Id == plannedTranche.Manifest {
+				tranche.manifest = manifest
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			problems = append(problems, fmt.Sprintf("Manifest '%s' isn't in "+
+				"the stack", plannedTranche.Manifest))
+			continue
+		}
+
+		manifestCacheDir := cacher.GetManifestCachePath(cacheDir, tranche.manifest)
+
+		for _, plannedKapp := range plannedTranche.Kapps {
+			kappObj, err := stackConfig.FindKapp(plannedKapp.Id)
+			if err != nil {
+				problems = append(problems, err.Error())
+				continue
+			}
+
+			switch plannedKapp.Action {
+			case ACTION_INSTALL, ACTION_DESTROY:
+				problems = append(problems, verifySources(plannedKapp, *kappObj,
+					manifestCacheDir)...)
+
+				if plannedKapp.Action == ACTION_INSTALL {
+					tranche.installables = append(tranche.installables, *kappObj)
+				} else {
+					tranche.destroyables = append(tranche.destroyables, *kappObj)
+				}
+			case ACTION_IGNORE:
+				tranche.ignorables = append(tranche.ignorables, *kappObj)
+			case ACTION_SKIP:
+				tranche.skippables = append(tranche.skippables, skippedKapp{
+					kapp:   *kappObj,
+					reason: plannedKapp.Reason,
+				})
+			default:
+				problems = append(problems, fmt.Sprintf("Unknown action '%s' "+
+					"for kapp '%s'", plannedKapp.Action, plannedKapp.Id))
+			}
+		}
+
+		tranches = append(tranches, tranche)
+	}
+
+	if len(problems) > 0 {
+		return nil, errors.New(fmt.Sprintf("The plan no longer matches the "+
+			"stack or cache. Create a new plan:\n  %s", strings.Join(problems, "\n  ")))
+	}
+
+	log.Debugf("Loaded plan created at %s", planFile.Created)
+
+	return &Plan{
+		tranche:     tranches,
+		stackConfig: stackConfig,
+		cacheDir:    cacheDir,
+	}, nil
+}
+
+// Returns problems if a kapp's sources in the manifest or cache differ from
+// the ones recorded in the plan
+func verifySources(plannedKapp PlannedKapp, kappObj kapp.Kapp,
+	manifestCacheDir string) []string {
+	problems := make([]string, 0)
+
+	current, err := plannedSources(kappObj, manifestCacheDir)
+	if err != nil {
+		return []string{err.Error()}
+	}
+
+	currentByName := map[string]PlannedSource{}
+	for _, source := range current {
+		currentByName[source.Name] = source
+	}
+
+	for _, planned := range plannedKapp.Sources {
+		source, ok := currentByName[planned.Name]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("Kapp '%s' no longer has "+
+				"source '%s'", plannedKapp.Id, planned.Name))
+			continue
+		}
+		delete(currentByName, planned.Name)
+
+		if source.Id != planned.Id {
+			problems = append(problems, fmt.Sprintf("Source '%s' of kapp '%s' "+
+				"has changed in the manifest", planned.Name, plannedKapp.Id))
+		} else if source.Revision != planned.Revision {
+			problems = append(problems, fmt.Sprintf("Source '%s' of kapp '%s' "+
+				"is cached at %s but the plan was created with %s", planned.Name,
+				plannedKapp.Id, source.Revision, planned.Revision))
+		}
+	}
+
+	for _, source := range current {
+		if _, ok := currentByName[source.Name]; ok {
+			problems = append(problems, fmt.Sprintf("Kapp '%s' has a new "+
+				"source '%s'", plannedKapp.Id, source.Name))
+		}
+	}
+
+	return problems
+}
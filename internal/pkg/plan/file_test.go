@@ -0,0 +1,122 @@
+package plan
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/sugarkube/sugarkube/internal/pkg/kapp"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSaveLoadPlan(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "sugarkube-plan-")
+	assert.Nil(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	planFile := &PlanFile{
+		FormatVersion: PLAN_FORMAT_VERSION,
+		Created:       "2018-10-01T12:00:00Z",
+		Stack:         StackIdentity{Name: "large", Cluster: "large"},
+		Manifests:     &kapp.ManifestRange{From: "manifest1"},
+		Tranches: []PlannedTranche{
+			{
+				Manifest: "manifest1",
+				Kapps: []PlannedKapp{
+					{
+						Id:     "manifest1:kappA",
+						Action: ACTION_INSTALL,
+						Sources: []PlannedSource{
+							{Name: "pathA", Id: "sugarkube-kapps-A-kappA-0.1.0-pathA",
+								Revision: "abc123"},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	path := filepath.Join(tmpDir, "plan.yaml")
+	assert.Nil(t, planFile.Save(path))
+
+	loaded, err := LoadPlan(path)
+	assert.Nil(t, err)
+	assert.Equal(t, planFile, loaded)
+
+	// plans in other formats should be refused
+	planFile.FormatVersion = PLAN_FORMAT_VERSION + 1
+	assert.Nil(t, planFile.Save(path))
+
+	_, err = LoadPlan(path)
+	assert.Error(t, err)
+}
+
+func TestFromFile(t *testing.T) {
+	stackConfig, err := kapp.LoadStackConfig("large", "../../testdata/stacks.yaml")
+	assert.Nil(t, err)
+
+	planFile := &PlanFile{
+		FormatVersion: PLAN_FORMAT_VERSION,
+		Stack:         newStackIdentity(stackConfig),
+		Tranches: []PlannedTranche{
+			{
+				Manifest: "manifest1",
+				Kapps: []PlannedKapp{
+					{Id: "manifest1:kappA", Action: ACTION_SKIP, Reason: "condition not met"},
+				},
+			},
+			{
+				Manifest: "exampleManifest2",
+				Kapps: []PlannedKapp{
+					{Id: "exampleManifest2:kappB", Action: ACTION_IGNORE},
+				},
+			},
+		},
+	}
+
+	actionPlan, err := FromFile(planFile, stackConfig, "/nonexistent")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(actionPlan.tranche))
+	assert.Equal(t, "manifest1", actionPlan.tranche[0].manifest.Id)
+	assert.Equal(t, "condition not met", actionPlan.tranche[0].skippables[0].reason)
+	assert.Equal(t, "kappB", actionPlan.tranche[1].ignorables[0].Id)
+
+	// the stack should be sliced to the manifests the plan is for
+	planFile.Manifests = &kapp.ManifestRange{Only: []string{"exampleManifest2"}}
+	planFile.Tranches = planFile.Tranches[1:]
+
+	actionPlan, err = FromFile(planFile, stackConfig, "/nonexistent")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(stackConfig.Manifests))
+	assert.Equal(t, *planFile.Manifests, stackConfig.ManifestRange())
+}
+
+func TestFromFileMismatches(t *testing.T) {
+	stackConfig, err := kapp.LoadStackConfig("large", "../../testdata/stacks.yaml")
+	assert.Nil(t, err)
+
+	identity := newStackIdentity(stackConfig)
+	identity.Cluster = "other"
+
+	planFile := &PlanFile{
+		FormatVersion: PLAN_FORMAT_VERSION,
+		Stack:         identity,
+		Tranches: []PlannedTranche{
+			{Manifest: "removedManifest"},
+			{
+				Manifest: "manifest1",
+				Kapps: []PlannedKapp{
+					{Id: "manifest1:kappZ", Action: ACTION_INSTALL},
+					{Id: "manifest1:kappA", Action: ACTION_INSTALL},
+				},
+			},
+		},
+	}
+
+	_, err = FromFile(planFile, stackConfig, "/nonexistent")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "but the target is stack 'large' (cluster 'large'")
+	assert.Contains(t, err.Error(), "Manifest 'removedManifest' isn't in the stack")
+	assert.Contains(t, err.Error(), "No kapp 'manifest1:kappZ' found")
+	assert.Contains(t, err.Error(), "Source 'pathA' of kapp 'manifest1:kappA' isn't in the cache")
+}
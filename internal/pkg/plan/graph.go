@@ -0,0 +1,232 @@
+package plan
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"io"
+	"strings"
+)
+
+// Plans can be rendered as graphs with `kapps plan --graph` to explain to
+// reviewers what will run in what order. Each tranche is drawn as a cluster
+// of its kapps, styled by their action and labelled with the revisions of
+// their sources. Edges between tranches show the order they'll be processed
+// in for each phase.
+
+// Formats plans can be rendered as graphs in
+const GRAPH_FORMAT_DOT = "dot"
+const GRAPH_FORMAT_MERMAID = "mermaid"
+
+var GRAPH_FORMATS = []string{GRAPH_FORMAT_DOT, GRAPH_FORMAT_MERMAID}
+
+// Styles of kapps by action
+var dotStyles = map[string]string{
+	ACTION_INSTALL: `style=filled, fillcolor="#d4edda", color="#28a745"`,
+	ACTION_DESTROY: `style=filled, fillcolor="#f8d7da", color="#dc3545"`,
+	ACTION_IGNORE:  `style=dashed, color="#6c757d", fontcolor="#6c757d"`,
+	ACTION_SKIP:    `style=dotted, color="#6c757d", fontcolor="#6c757d"`,
+}
+
+var mermaidStyles = map[string]string{
+	ACTION_INSTALL: "fill:#d4edda,stroke:#28a745",
+	ACTION_DESTROY: "fill:#f8d7da,stroke:#dc3545",
+	ACTION_IGNORE:  "fill:#fff,stroke:#6c757d,color:#6c757d,stroke-dasharray:5 5",
+	ACTION_SKIP:    "fill:#fff,stroke:#6c757d,color:#6c757d,stroke-dasharray:2 2",
+}
+
+// An edge between the tranches processed one after the other in a phase
+type graphEdge struct {
+	phase string
+	from  int
+	to    int
+}
+
+// Returns an error if plans can't be rendered in the format
+func ValidateGraphFormat(format string) error {
+	for _, supported := range GRAPH_FORMATS {
+		if format == supported {
+			return nil
+		}
+	}
+
+	return errors.New(fmt.Sprintf("Unknown graph format '%s'. Must be one "+
+		"of: %s", format, strings.Join(GRAPH_FORMATS, ", ")))
+}
+
+// Writes the plan as a graph in the given format
+func (p *PlanFile) WriteGraph(out io.Writer, format string) error {
+	err := ValidateGraphFormat(format)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	graph := p.dotGraph()
+	if format == GRAPH_FORMAT_MERMAID {
+		graph = p.mermaidGraph()
+	}
+
+	_, err = io.WriteString(out, graph)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+// Returns the edges between tranches in the order they'll be processed.
+// Tranches with nothing to do in a phase are passed over, as when the plan
+// is run.
+func (p *PlanFile) graphEdges() []graphEdge {
+	edges := make([]graphEdge, 0)
+
+	for _, phase := range DEFAULT_PHASE_ORDER {
+		action := ACTION_INSTALL
+		if phase == PHASE_DESTROY {
+			action = ACTION_DESTROY
+		}
+
+		previous := -1
+		for i := range p.Tranches {
+			trancheIndex := i
+			if phase == PHASE_DESTROY {
+				trancheIndex = len(p.Tranches) - 1 - i
+			}
+
+			if p.Tranches[trancheIndex].firstWithAction(action) < 0 {
+				continue
+			}
+
+			if previous >= 0 {
+				edges = append(edges, graphEdge{
+					phase: phase,
+					from:  previous,
+					to:    trancheIndex,
+				})
+			}
+			previous = trancheIndex
+		}
+	}
+
+	return edges
+}
+
+// Returns the index of the first kapp in the tranche with the action, or -1
+func (t PlannedTranche) firstWithAction(action string) int {
+	for i, plannedKapp := range t.Kapps {
+		if plannedKapp.Action == action {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// Returns the lines of a kapp's label
+func (k PlannedKapp) graphLabel() []string {
+	lines := []string{k.Id, k.Action}
+
+	if k.Reason != "" {
+		lines[1] = fmt.Sprintf("%s: %s", k.Action, k.Reason)
+	}
+
+	for _, source := range k.Sources {
+		lines = append(lines, describeRevisions([]PlannedSource{source}))
+	}
+
+	return lines
+}
+
+func (p *PlanFile) dotGraph() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "digraph %s {\n", dotQuote(fmt.Sprintf("plan for stack %s",
+		p.Stack.Name)))
+	b.WriteString("  compound=true;\n")
+	b.WriteString("  rankdir=LR;\n")
+	b.WriteString("  node [shape=box, fontsize=10];\n")
+
+	for i, tranche := range p.Tranches {
+		fmt.Fprintf(&b, "\n  subgraph cluster_t%d {\n", i)
+		fmt.Fprintf(&b, "    label=%s;\n", dotQuote(fmt.Sprintf("tranche %d: %s",
+			i+1, tranche.Manifest)))
+
+		if len(tranche.Kapps) == 0 {
+			// clusters need a node to be drawn and have edges
+			fmt.Fprintf(&b, "    t%d_empty [label=\"no kapps\", shape=plaintext];\n", i)
+		}
+
+		for j, plannedKapp := range tranche.Kapps {
+			fmt.Fprintf(&b, "    t%d_k%d [label=%s, %s];\n", i, j,
+				dotQuote(strings.Join(plannedKapp.graphLabel(), "\n")),
+				dotStyles[plannedKapp.Action])
+		}
+
+		b.WriteString("  }\n")
+	}
+
+	edges := p.graphEdges()
+	if len(edges) > 0 {
+		b.WriteString("\n")
+	}
+
+	for _, edge := range edges {
+		action := ACTION_INSTALL
+		color := "#28a745"
+		if edge.phase == PHASE_DESTROY {
+			action = ACTION_DESTROY
+			color = "#dc3545"
+		}
+
+		fmt.Fprintf(&b, "  t%d_k%d -> t%d_k%d [ltail=cluster_t%d, lhead=cluster_t%d, "+
+			"label=%s, color=%s, fontcolor=%s];\n", edge.from,
+			p.Tranches[edge.from].firstWithAction(action), edge.to,
+			p.Tranches[edge.to].firstWithAction(action), edge.from, edge.to,
+			dotQuote(edge.phase), dotQuote(color), dotQuote(color))
+	}
+
+	b.WriteString("}\n")
+
+	return b.String()
+}
+
+func (p *PlanFile) mermaidGraph() string {
+	var b strings.Builder
+
+	b.WriteString("flowchart LR\n")
+
+	for i, tranche := range p.Tranches {
+		fmt.Fprintf(&b, "  subgraph t%d [%s]\n", i, mermaidQuote(
+			fmt.Sprintf("tranche %d: %s", i+1, tranche.Manifest)))
+
+		for j, plannedKapp := range tranche.Kapps {
+			fmt.Fprintf(&b, "    t%d_k%d[%s]:::%s\n", i, j,
+				mermaidQuote(strings.Join(plannedKapp.graphLabel(), "\n")),
+				plannedKapp.Action)
+		}
+
+		b.WriteString("  end\n")
+	}
+
+	for _, edge := range p.graphEdges() {
+		fmt.Fprintf(&b, "  t%d -- %s --> t%d\n", edge.from, edge.phase, edge.to)
+	}
+
+	for _, action := range []string{ACTION_INSTALL, ACTION_DESTROY, ACTION_IGNORE,
+		ACTION_SKIP} {
+		fmt.Fprintf(&b, "  classDef %s %s\n", action, mermaidStyles[action])
+	}
+
+	return b.String()
+}
+
+// Quotes a DOT string, with newlines as line breaks
+func dotQuote(text string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	return `"` + replacer.Replace(text) + `"`
+}
+
+// Quotes a Mermaid label, with newlines as line breaks
+func mermaidQuote(text string) string {
+	replacer := strings.NewReplacer(`"`, "#quot;", "\n", "<br/>")
+	return `"` + replacer.Replace(text) + `"`
+}
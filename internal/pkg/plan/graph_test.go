@@ -0,0 +1,88 @@
+package plan
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestWriteGraph(t *testing.T) {
+	planFile := PlanFile{
+		Stack: StackIdentity{Name: "large"},
+		Tranches: []PlannedTranche{
+			{
+				Manifest: "manifest1",
+				Kapps: []PlannedKapp{
+					{Id: "manifest1:kappA", Action: ACTION_INSTALL, Sources: []PlannedSource{
+						{Name: "pathA", Revision: OLD_SHA},
+					}},
+					{Id: "manifest1:kappB", Action: ACTION_DESTROY},
+				},
+			},
+			{
+				Manifest: "manifest2",
+				Kapps: []PlannedKapp{
+					{Id: "manifest2:kappC", Action: ACTION_SKIP, Reason: `condition not met: "dev"`},
+				},
+			},
+			{
+				Manifest: "manifest3",
+				Kapps: []PlannedKapp{
+					{Id: "manifest3:kappD", Action: ACTION_IGNORE},
+					{Id: "manifest3:kappE", Action: ACTION_INSTALL},
+					{Id: "manifest3:kappF", Action: ACTION_DESTROY},
+				},
+			},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		desc     string
+		format   string
+		expected []string
+	}{
+		{
+			name:   "dot",
+			desc:   "tranches should be clusters of kapps labelled with their action and revisions",
+			format: GRAPH_FORMAT_DOT,
+			expected: []string{
+				`subgraph cluster_t0 {`,
+				`label="tranche 1: manifest1";`,
+				`t0_k0 [label="manifest1:kappA\ninstall\npathA@11111111", style=filled`,
+				`t1_k0 [label="manifest2:kappC\nskip: condition not met: \"dev\"", style=dotted`,
+				`t2_k0 [label="manifest3:kappD\nignore", style=dashed`,
+				// tranches without kapps to process in a phase are passed over
+				`t2_k2 -> t0_k1 [ltail=cluster_t2, lhead=cluster_t0, label="destroy"`,
+				`t0_k0 -> t2_k1 [ltail=cluster_t0, lhead=cluster_t2, label="install"`,
+			},
+		},
+		{
+			name:   "mermaid",
+			desc:   "tranches should be subgraphs of kapps labelled with their action and revisions",
+			format: GRAPH_FORMAT_MERMAID,
+			expected: []string{
+				"flowchart LR\n",
+				`subgraph t0 ["tranche 1: manifest1"]`,
+				`t0_k0["manifest1:kappA<br/>install<br/>pathA@11111111"]:::install`,
+				`t1_k0["manifest2:kappC<br/>skip: condition not met: #quot;dev#quot;"]:::skip`,
+				"t2 -- destroy --> t0\n",
+				"t0 -- install --> t2\n",
+				"classDef ignore ",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		var out bytes.Buffer
+		err := planFile.WriteGraph(&out, test.format)
+		assert.Nil(t, err, test.desc)
+
+		for _, expected := range test.expected {
+			assert.Contains(t, out.String(), expected, test.desc)
+		}
+	}
+
+	var out bytes.Buffer
+	assert.Error(t, planFile.WriteGraph(&out, "svg"), "unknown formats should be rejected")
+}
@@ -0,0 +1,115 @@
+package plan
+
+import (
+	"github.com/pkg/errors"
+	"github.com/sugarkube/sugarkube/internal/pkg/cacher"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Approved runs record the revisions of the sources of each kapp they
+// successfully install in a history file in the cache dir. Unlike the journal
+// it's kept between runs, so kapps whose install fails can be rolled back to
+// the revisions that were last installed successfully.
+
+// Name of the history file in the cache dir's sugarkube dir
+const HISTORY_FILE = "history.yaml"
+
+type History struct {
+	// keyed by fully qualified kapp ID
+	Kapps map[string]InstalledRevision `yaml:"kapps"`
+
+	path  string
+	mutex sync.Mutex
+}
+
+type InstalledRevision struct {
+	Installed string          `yaml:"installed"`
+	Sources   []PlannedSource `yaml:"sources"`
+}
+
+// Returns the path to the history for a cache dir
+func historyPath(cacheDir string) string {
+	return filepath.Join(cacheDir, cacher.CACHE_DIR, HISTORY_FILE)
+}
+
+// Loads the history in a cache dir. An empty history is returned if there
+// isn't one yet.
+func LoadHistory(cacheDir string) (*History, error) {
+	path := historyPath(cacheDir)
+
+	history := History{
+		Kapps: map[string]InstalledRevision{},
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, errors.Wrapf(err, "Error reading history %s", path)
+	}
+
+	if err == nil {
+		err = yaml.UnmarshalStrict(data, &history)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Error parsing history %s", path)
+		}
+
+		if history.Kapps == nil {
+			history.Kapps = map[string]InstalledRevision{}
+		}
+	}
+
+	history.path = path
+
+	return &history, nil
+}
+
+// Returns the revisions a kapp was last installed successfully with
+func (h *History) lastInstalled(id string) (InstalledRevision, bool) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	installed, ok := h.Kapps[id]
+	return installed, ok
+}
+
+// Records that a kapp was installed with the given revisions
+func (h *History) recordInstalled(id string, sources []PlannedSource) error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.Kapps[id] = InstalledRevision{
+		Installed: time.Now().UTC().Format(time.RFC3339),
+		Sources:   sources,
+	}
+
+	return h.save()
+}
+
+// Records that a kapp was destroyed so it's never rolled back to what was
+// installed before
+func (h *History) recordDestroyed(id string) error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if _, ok := h.Kapps[id]; !ok {
+		return nil
+	}
+
+	delete(h.Kapps, id)
+
+	return h.save()
+}
+
+// Writes the history to the cache dir. The mutex must be held.
+func (h *History) save() error {
+	data, err := yaml.Marshal(h)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	return errors.WithStack(writeFileAtomically(h.path, data))
+}
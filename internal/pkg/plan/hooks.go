@@ -0,0 +1,74 @@
+package plan
+
+import (
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/sugarkube/sugarkube/internal/pkg/installer"
+	"github.com/sugarkube/sugarkube/internal/pkg/kapp"
+	"github.com/sugarkube/sugarkube/internal/pkg/provider"
+	"path/filepath"
+)
+
+// Hooks declared in stacks.yaml run in the stack file's directory before the
+// first and after the last step of each phase. on_failure hooks run once at
+// the end if anything failed. Hooks only run when changes are approved unless
+// they opt in with `on_plan` (see kapp.Hooks.ForPass). Their output is logged
+// in the run's log dir, manifest hooks' in the manifest's and kapp hooks' in
+// the kapp's.
+func (p *Plan) runStackHooks(ctx context.Context, event string,
+	providerImpl provider.Provider, approved bool, dryRun bool) error {
+	hooks := p.stackConfig.Hooks.ForPass(event, approved)
+	if len(hooks) == 0 {
+		return nil
+	}
+
+	envVars := installer.StackEnvVars(p.stackConfig, providerImpl, approved)
+
+	err := installer.RunHooks(ctx, fmt.Sprintf("stack %s", event), hooks,
+		p.stackConfig.Dir(), envVars, p.gracePeriod, p.logDir, dryRun)
+	return errors.WithStack(err)
+}
+
+// Hooks declared in a manifest run in the manifest's directory before and
+// after its kapps are processed in each phase. The manifest ID is passed to
+// them in MANIFEST.
+func (p *Plan) runManifestHooks(ctx context.Context, event string,
+	manifest kapp.Manifest, providerImpl provider.Provider, approved bool,
+	dryRun bool) error {
+	hooks := manifest.Hooks.ForPass(event, approved)
+	if len(hooks) == 0 {
+		return nil
+	}
+
+	envVars := installer.StackEnvVars(p.stackConfig, providerImpl, approved)
+	envVars["MANIFEST"] = manifest.Id
+
+	err := installer.RunHooks(ctx, fmt.Sprintf("manifest '%s' %s", manifest.Id,
+		event), hooks, filepath.Dir(manifest.Uri), envVars, p.gracePeriod,
+		installer.ManifestLogDir(p.logDir, manifest.Id), dryRun)
+	return errors.WithStack(err)
+}
+
+// Hooks declared in a kapp's installer block run with the same directory and
+// env vars as its installer
+func (p *Plan) runKappHooks(ctx context.Context, event string,
+	installerImpl installer.Installer, kappObj *kapp.Kapp, approved bool,
+	dryRun bool) error {
+	hooks := kappObj.Installer.Hooks.ForPass(event, approved)
+	if len(hooks) == 0 {
+		return nil
+	}
+
+	dir, envVars, err := installer.KappHookEnv(installerImpl, kappObj,
+		p.stackConfig, approved, dryRun)
+	if err != nil {
+		return errors.Wrapf(err, "Error getting the env vars for hooks of "+
+			"kapp '%s'", kappObj.FullyQualifiedId())
+	}
+
+	err = installer.RunHooks(ctx, fmt.Sprintf("kapp '%s' %s",
+		kappObj.FullyQualifiedId(), event), hooks, dir, envVars, p.gracePeriod,
+		installer.KappLogDir(p.logDir, kappObj.FullyQualifiedId()), dryRun)
+	return errors.WithStack(err)
+}
@@ -0,0 +1,92 @@
+// +build !windows
+
+package plan
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/sugarkube/sugarkube/internal/pkg/kapp"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunHooksOncePerApprovedAction(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "sugarkube-hooks-")
+	assert.Nil(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	// kapps are run with a kube context
+	assert.Nil(t, os.Setenv("KUBE_CONTEXT", "test"))
+	defer os.Unsetenv("KUBE_CONTEXT")
+
+	stackConfig, err := kapp.LoadStackConfig("large", "../../testdata/stacks.yaml")
+	assert.Nil(t, err)
+
+	cacheDir := filepath.Join(tmpDir, "cache")
+	for _, manifest := range stackConfig.Manifests {
+		for _, kappObj := range manifest.Kapps {
+			kappDir := filepath.Join(cacheDir, manifest.Id, kappObj.Id)
+			assert.Nil(t, os.MkdirAll(kappDir, 0755))
+			assert.Nil(t, ioutil.WriteFile(filepath.Join(kappDir, "Makefile"),
+				[]byte("install:\n\t@echo installing\n"), 0644))
+		}
+	}
+
+	hooksLog := filepath.Join(tmpDir, "hooks.log")
+	// returns a hook that records it ran and whether changes were approved
+	hook := func(name string, onPlan bool) kapp.Hook {
+		return kapp.Hook{
+			Command: fmt.Sprintf("echo %s-$APPROVED >> %s", name, hooksLog),
+			OnPlan:  onPlan,
+		}
+	}
+
+	stackConfig.Hooks.PreInstall = []kapp.Hook{hook("stack", false)}
+	stackConfig.Hooks.PostInstall = []kapp.Hook{hook("stack-plan", true)}
+	stackConfig.Manifests[0].Hooks.PreInstall = []kapp.Hook{hook("manifest", false)}
+	stackConfig.Manifests[0].Kapps[0].Installer.Hooks.PostInstall = []kapp.Hook{
+		hook("kapp", false)}
+
+	actionPlan, err := Create(stackConfig, cacheDir)
+	assert.Nil(t, err)
+
+	logDir := filepath.Join(tmpDir, "logs")
+	actionPlan.SetLogDir(logDir)
+
+	_, err = actionPlan.Run(context.Background(), false, false)
+	assert.Nil(t, err)
+	_, err = actionPlan.Run(context.Background(), true, false)
+	assert.Nil(t, err)
+
+	data, err := ioutil.ReadFile(hooksLog)
+	assert.Nil(t, err)
+
+	expected := []string{
+		"stack-plan-false",
+		"stack-true",
+		"manifest-true",
+		"kapp-true",
+		"stack-plan-true",
+	}
+	assert.Equal(t, expected, strings.Split(strings.TrimSpace(string(data)), "\n"),
+		"hooks should run once when changes are applied, and on_plan hooks "+
+			"when they're planned too")
+
+	kappLog, err := ioutil.ReadFile(filepath.Join(logDir, "manifest1", "kappA",
+		"stdout.log"))
+	assert.Nil(t, err)
+	assert.Contains(t, string(kappLog), "=== kapp 'manifest1:kappA' post_install hook",
+		"kapp hooks should be logged with the kapp")
+
+	manifestLog, err := ioutil.ReadFile(filepath.Join(logDir, "manifest1", "stdout.log"))
+	assert.Nil(t, err)
+	assert.Contains(t, string(manifestLog), "=== manifest 'manifest1' pre_install hook")
+
+	stackLog, err := ioutil.ReadFile(filepath.Join(logDir, "stdout.log"))
+	assert.Nil(t, err)
+	assert.Contains(t, string(stackLog), "=== stack pre_install hook")
+}
@@ -0,0 +1,295 @@
+package plan
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/sugarkube/sugarkube/internal/pkg/cacher"
+	"github.com/sugarkube/sugarkube/internal/pkg/kapp"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Running a plan records the status of each action in a journal in the cache
+// dir so a run that failed part way through can be resumed with
+// `kapps install --resume`. Resuming skips actions that already succeeded
+// and retries the rest. The journal records hashes of the plan, the stack and
+// the cache so a run can't be resumed if any of them have changed.
+
+// Name of the journal file in the cache dir's sugarkube dir
+const JOURNAL_FILE = "journal.yaml"
+
+// actions are pending until they're run
+const STATUS_PENDING = "pending"
+
+type Journal struct {
+	// the plan being run. Resumed runs rerun this plan.
+	Plan      *PlanFile      `yaml:"plan"`
+	PlanHash  string         `yaml:"plan_hash"`
+	StackHash string         `yaml:"stack_hash"`
+	CacheHash string         `yaml:"cache_hash"`
+	Updated   string         `yaml:"updated"`
+	Entries   []JournalEntry `yaml:"entries"`
+
+	path  string
+	mutex sync.Mutex
+}
+
+type JournalEntry struct {
+	// fully qualified kapp ID
+	Id     string `yaml:"id"`
+	Action string `yaml:"action"`
+	// whether the action was run with APPROVED=true
+	Approved bool   `yaml:"approved"`
+	Status   string `yaml:"status"`
+	Updated  string `yaml:"updated"`
+	Error    string `yaml:"error,omitempty"`
+}
+
+// Returns the path to the journal for a cache dir
+func journalPath(cacheDir string) string {
+	return filepath.Join(cacheDir, cacher.CACHE_DIR, JOURNAL_FILE)
+}
+
+// Creates a new journal for running a plan. Any existing journal in the
+// cache dir is replaced when it's saved.
+func NewJournal(planFile *PlanFile, stackConfig *kapp.StackConfig,
+	cacheDir string) (*Journal, error) {
+
+	planHash, cacheHash, err := planFile.hashes()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	stackHash, err := hashStack(stackConfig)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return &Journal{
+		Plan:      planFile,
+		PlanHash:  planHash,
+		StackHash: stackHash,
+		CacheHash: cacheHash,
+		Entries:   []JournalEntry{},
+		path:      journalPath(cacheDir),
+	}, nil
+}
+
+// Loads the journal in a cache dir. Returns nil if there isn't one.
+func LoadJournal(cacheDir string) (*Journal, error) {
+	path := journalPath(cacheDir)
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "Error reading journal %s", path)
+	}
+
+	journal := Journal{}
+	err = yaml.UnmarshalStrict(data, &journal)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Error parsing journal %s", path)
+	}
+
+	if journal.Plan == nil {
+		return nil, errors.New(fmt.Sprintf("Journal %s doesn't contain a plan", path))
+	}
+
+	journal.path = path
+
+	return &journal, nil
+}
+
+// Returns an error unless the journal's plan can be resumed against the
+// given stack and the plan currently in the cache dir
+func (j *Journal) VerifyResumable(current *PlanFile, stackConfig *kapp.StackConfig) error {
+	planHash, cacheHash, err := current.hashes()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	stackHash, err := hashStack(stackConfig)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if stackHash != j.StackHash {
+		return errors.New("Can't resume because the stack's settings, vars or " +
+			"kapp parameters have changed since the run started")
+	}
+
+	if cacheHash != j.CacheHash {
+		return errors.New("Can't resume because sources in the cache have " +
+			"changed since the run started")
+	}
+
+	if planHash != j.PlanHash {
+		return errors.New("Can't resume because the plan has changed since " +
+			"the run started")
+	}
+
+	return nil
+}
+
+// Returns whether an action already succeeded
+func (j *Journal) succeeded(id string, action string, approved bool) bool {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	for _, entry := range j.Entries {
+		if entry.Id == id && entry.Action == action && entry.Approved == approved {
+			return entry.Status == STATUS_SUCCEEDED
+		}
+	}
+
+	return false
+}
+
+// Records the status of an action and saves the journal
+func (j *Journal) record(id string, action string, approved bool, status string,
+	actionErr error) error {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	now := time.Now().UTC().Format(time.RFC3339)
+
+	entry := JournalEntry{
+		Id:       id,
+		Action:   action,
+		Approved: approved,
+		Status:   status,
+		Updated:  now,
+	}
+
+	if actionErr != nil {
+		entry.Error = truncate(actionErr.Error())
+	}
+
+	found := false
+	for i, existing := range j.Entries {
+		if existing.Id == id && existing.Action == action && existing.Approved == approved {
+			j.Entries[i] = entry
+			found = true
+			break
+		}
+	}
+
+	if !found {
+		j.Entries = append(j.Entries, entry)
+	}
+
+	j.Updated = now
+
+	return j.save()
+}
+
+// Writes the journal to the cache dir. The mutex must be held.
+func (j *Journal) save() error {
+	data, err := yaml.Marshal(j)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	return errors.WithStack(writeFileAtomically(j.path, data))
+}
+
+// Writes a file in the cache dir's sugarkube dir, writing to a temporary file
+// then renaming it so an interrupted write doesn't corrupt it
+func writeFileAtomically(path string, data []byte) error {
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	tmpPath := path + ".tmp"
+	err = ioutil.WriteFile(tmpPath, data, 0644)
+	if err != nil {
+		return errors.Wrapf(err, "Error writing %s", tmpPath)
+	}
+
+	err = os.Rename(tmpPath, path)
+	if err != nil {
+		return errors.Wrapf(err, "Error writing %s", path)
+	}
+
+	return nil
+}
+
+// Returns a hash of the stack and kapps the plan acts on, and a hash of the
+// revisions of the sources in the cache. The creation time isn't included.
+func (p *PlanFile) hashes() (string, string, error) {
+	kapps := PlanFile{
+		FormatVersion: p.FormatVersion,
+		Stack:         p.Stack,
+		Manifests:     p.Manifests,
+		Tranches:      []PlannedTranche{},
+	}
+	sources := make([]PlannedSource, 0)
+
+	for _, tranche := range p.Tranches {
+		plannedTranche := PlannedTranche{
+			Manifest: tranche.Manifest,
+			Kapps:    []PlannedKapp{},
+		}
+
+		for _, plannedKapp := range tranche.Kapps {
+			sources = append(sources, plannedKapp.Sources...)
+			plannedKapp.Sources = nil
+			plannedTranche.Kapps = append(plannedTranche.Kapps, plannedKapp)
+		}
+
+		kapps.Tranches = append(kapps.Tranches, plannedTranche)
+	}
+
+	planHash, err := hash(kapps)
+	if err != nil {
+		return "", "", errors.WithStack(err)
+	}
+
+	cacheHash, err := hash(sources)
+	if err != nil {
+		return "", "", errors.WithStack(err)
+	}
+
+	return planHash, cacheHash, nil
+}
+
+// Returns a hash of the settings of a stack that affect how kapps are run
+func hashStack(stackConfig *kapp.StackConfig) (string, error) {
+	params := map[string]map[string]string{}
+	for _, manifest := range stackConfig.Manifests {
+		for _, kappObj := range manifest.Kapps {
+			params[kappObj.FullyQualifiedId()] = kappObj.Params
+		}
+	}
+
+	return hash(struct {
+		Stack   StackIdentity
+		Vars    []string
+		Ignored []string
+		Params  map[string]map[string]string
+	}{
+		Stack:   newStackIdentity(stackConfig),
+		Vars:    stackConfig.VarsFilesDirs,
+		Ignored: stackConfig.Ignored,
+		Params:  params,
+	})
+}
+
+// Returns the SHA256 of a value serialised as YAML. Map keys are sorted when
+// serialised so this is deterministic.
+func hash(value interface{}) (string, error) {
+	data, err := yaml.Marshal(value)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	return fmt.Sprintf("%x", sha256.Sum256(data)), nil
+}
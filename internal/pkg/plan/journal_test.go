@@ -0,0 +1,126 @@
+package plan
+
+import (
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/sugarkube/sugarkube/internal/pkg/kapp"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func newTestPlanFile(stackConfig *kapp.StackConfig) *PlanFile {
+	return &PlanFile{
+		FormatVersion: PLAN_FORMAT_VERSION,
+		Created:       "2018-10-01T12:00:00Z",
+		Stack:         newStackIdentity(stackConfig),
+		Tranches: []PlannedTranche{
+			{
+				Manifest: "manifest1",
+				Kapps: []PlannedKapp{
+					{
+						Id:     "manifest1:kappA",
+						Action: ACTION_INSTALL,
+						Sources: []PlannedSource{
+							{Name: "pathA", Id: "sugarkube-kapps-A-kappA-0.1.0-pathA",
+								Revision: "abc123"},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestJournal(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "sugarkube-journal-")
+	assert.Nil(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	stackConfig, err := kapp.LoadStackConfig("large", "../../testdata/stacks.yaml")
+	assert.Nil(t, err)
+
+	journal, err := LoadJournal(tmpDir)
+	assert.Nil(t, err)
+	assert.Nil(t, journal, "there shouldn't be a journal in a new cache dir")
+
+	journal, err = NewJournal(newTestPlanFile(stackConfig), stackConfig, tmpDir)
+	assert.Nil(t, err)
+
+	assert.Nil(t, journal.record("manifest1:kappA", PHASE_INSTALL, false, STATUS_PENDING, nil))
+	assert.False(t, journal.succeeded("manifest1:kappA", PHASE_INSTALL, false))
+
+	assert.Nil(t, journal.record("manifest1:kappA", PHASE_INSTALL, false, STATUS_SUCCEEDED, nil))
+	assert.Nil(t, journal.record("manifest1:kappA", PHASE_INSTALL, true, STATUS_FAILED,
+		errors.New("make failed")))
+
+	loaded, err := LoadJournal(tmpDir)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(loaded.Entries), "entries should be updated in place")
+	assert.True(t, loaded.succeeded("manifest1:kappA", PHASE_INSTALL, false))
+	assert.False(t, loaded.succeeded("manifest1:kappA", PHASE_INSTALL, true),
+		"approved and unapproved runs should be tracked separately")
+	assert.Equal(t, "make failed", loaded.Entries[1].Error)
+	assert.Equal(t, journal.Plan, loaded.Plan)
+}
+
+func TestVerifyResumable(t *testing.T) {
+	stackConfig, err := kapp.LoadStackConfig("large", "../../testdata/stacks.yaml")
+	assert.Nil(t, err)
+
+	journal, err := NewJournal(newTestPlanFile(stackConfig), stackConfig, "/nonexistent")
+	assert.Nil(t, err)
+
+	tests := []struct {
+		name          string
+		desc          string
+		modify        func(planFile *PlanFile, sc *kapp.StackConfig)
+		expectedError string
+	}{
+		{
+			name:   "unchanged",
+			desc:   "recreating the plan later shouldn't stop it being resumed",
+			modify: func(planFile *PlanFile, sc *kapp.StackConfig) { planFile.Created = "later" },
+		},
+		{
+			name: "plan",
+			desc: "changes to the plan should be refused",
+			modify: func(planFile *PlanFile, sc *kapp.StackConfig) {
+				planFile.Tranches[0].Kapps[0].Action = ACTION_DESTROY
+			},
+			expectedError: "the plan has changed",
+		},
+		{
+			name: "cache",
+			desc: "changes to the cache should be refused",
+			modify: func(planFile *PlanFile, sc *kapp.StackConfig) {
+				planFile.Tranches[0].Kapps[0].Sources[0].Revision = "def456"
+			},
+			expectedError: "sources in the cache have changed",
+		},
+		{
+			name: "stack",
+			desc: "changes to the stack should be refused",
+			modify: func(planFile *PlanFile, sc *kapp.StackConfig) {
+				sc.VarsFilesDirs = append(sc.VarsFilesDirs, "extra-vars.yaml")
+			},
+			expectedError: "the stack's settings",
+		},
+	}
+
+	for _, test := range tests {
+		sc, err := kapp.LoadStackConfig("large", "../../testdata/stacks.yaml")
+		assert.Nil(t, err)
+
+		planFile := newTestPlanFile(sc)
+		test.modify(planFile, sc)
+
+		err = journal.VerifyResumable(planFile, sc)
+		if test.expectedError == "" {
+			assert.Nil(t, err, test.desc)
+		} else {
+			assert.Error(t, err, test.desc)
+			assert.Contains(t, err.Error(), test.expectedError, test.desc)
+		}
+	}
+}
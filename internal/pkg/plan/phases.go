@@ -0,0 +1,117 @@
+package plan
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/sugarkube/sugarkube/internal/pkg/kapp"
+	"strings"
+)
+
+// Plans are run in two phases. Kapps are destroyed in reverse tranche order so
+// kapps are destroyed before the kapps they were installed after, and
+// installed in forward tranche order. Each phase applies the same rules around
+// parallelisation.
+const PHASE_DESTROY = "destroy"
+const PHASE_INSTALL = "install"
+
+// Destroying first frees up resources and names for the kapps being installed
+var DEFAULT_PHASE_ORDER = []string{PHASE_DESTROY, PHASE_INSTALL}
+
+// The kapps to process in parallel for a tranche in a phase
+type phaseStep struct {
+	phase string
+	// index of the tranche in the plan
+	trancheIndex int
+	kapps        []kapp.Kapp
+}
+
+// Sets the order to run the phases of the plan in. Both phases must be given.
+func (p *Plan) SetPhaseOrder(phases []string) error {
+	if len(phases) != 2 || phases[0] == phases[1] {
+		return errors.New(fmt.Sprintf("The phase order must contain '%s' and "+
+			"'%s' once each. Got: %s", PHASE_DESTROY, PHASE_INSTALL,
+			strings.Join(phases, ",")))
+	}
+
+	for _, phase := range phases {
+		if phase != PHASE_DESTROY && phase != PHASE_INSTALL {
+			return errors.New(fmt.Sprintf("Unknown phase '%s'", phase))
+		}
+	}
+
+	p.phaseOrder = phases
+	return nil
+}
+
+// Returns the steps to run the plan in. Tranches without any kapps to process
+// in a phase are left out.
+func (p *Plan) phaseSteps() []phaseStep {
+	phases := p.phaseOrder
+	if phases == nil {
+		phases = DEFAULT_PHASE_ORDER
+	}
+
+	steps := make([]phaseStep, 0)
+
+	for _, phase := range phases {
+		for i := range p.tranche {
+			trancheIndex := i
+			kapps := p.tranche[i].installables
+
+			if phase == PHASE_DESTROY {
+				trancheIndex = len(p.tranche) - 1 - i
+				kapps = p.tranche[trancheIndex].destroyables
+			}
+
+			if len(kapps) == 0 {
+				continue
+			}
+
+			steps = append(steps, phaseStep{
+				phase:        phase,
+				trancheIndex: trancheIndex,
+				kapps:        kapps,
+			})
+		}
+	}
+
+	return steps
+}
+
+// Describes the order the plan will be run in, phase by phase
+func (p *Plan) describePhases() string {
+	lines := make([]string, 0)
+	steps := p.phaseSteps()
+
+	phases := p.phaseOrder
+	if phases == nil {
+		phases = DEFAULT_PHASE_ORDER
+	}
+
+	for i, phase := range phases {
+		lines = append(lines, fmt.Sprintf("Phase %d: %s", i+1, phase))
+
+		found := false
+		for _, step := range steps {
+			if step.phase != phase {
+				continue
+			}
+			found = true
+
+			ids := make([]string, 0)
+			for _, kappObj := range step.kapps {
+				ids = append(ids, kappObj.FullyQualifiedId())
+			}
+
+			lines = append(lines, fmt.Sprintf("  tranche %d (%s): %s",
+				step.trancheIndex+1, p.tranche[step.trancheIndex].manifest.Id,
+				strings.Join(ids, ", ")))
+		}
+
+		if !found {
+			lines = append(lines, "  nothing to do")
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,84 @@
+package plan
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/sugarkube/sugarkube/internal/pkg/kapp"
+	"testing"
+)
+
+func newTestPlan() *Plan {
+	return &Plan{
+		tranche: []Tranche{
+			{
+				manifest:     kapp.Manifest{Id: "manifest1"},
+				installables: []kapp.Kapp{{Id: "kappA"}},
+				destroyables: []kapp.Kapp{{Id: "kappB"}},
+			},
+			{
+				manifest:     kapp.Manifest{Id: "manifest2"},
+				installables: []kapp.Kapp{{Id: "kappC"}, {Id: "kappD"}},
+			},
+			{
+				manifest:     kapp.Manifest{Id: "manifest3"},
+				destroyables: []kapp.Kapp{{Id: "kappE"}},
+			},
+		},
+	}
+}
+
+func TestPhaseSteps(t *testing.T) {
+	tests := []struct {
+		name       string
+		desc       string
+		phaseOrder []string
+		expected   []string
+	}{
+		{
+			name:     "default",
+			desc:     "kapps should be destroyed in reverse order before installing in order",
+			expected: []string{"destroy 3", "destroy 1", "install 1", "install 2"},
+		},
+		{
+			name:       "install_first",
+			desc:       "the phase order should be configurable",
+			phaseOrder: []string{PHASE_INSTALL, PHASE_DESTROY},
+			expected:   []string{"install 1", "install 2", "destroy 3", "destroy 1"},
+		},
+	}
+
+	for _, test := range tests {
+		p := newTestPlan()
+		if test.phaseOrder != nil {
+			assert.Nil(t, p.SetPhaseOrder(test.phaseOrder))
+		}
+
+		actual := make([]string, 0)
+		for _, step := range p.phaseSteps() {
+			actual = append(actual, fmt.Sprintf("%s %d", step.phase, step.trancheIndex+1))
+		}
+
+		assert.Equal(t, test.expected, actual, "unexpected steps for %s", test.name)
+	}
+}
+
+func TestSetPhaseOrderInvalid(t *testing.T) {
+	p := newTestPlan()
+	assert.Error(t, p.SetPhaseOrder([]string{PHASE_INSTALL}))
+	assert.Error(t, p.SetPhaseOrder([]string{PHASE_INSTALL, PHASE_INSTALL}))
+	assert.Error(t, p.SetPhaseOrder([]string{PHASE_INSTALL, "upgrade"}))
+}
+
+func TestDescribePhases(t *testing.T) {
+	p := newTestPlan()
+	p.tranche[0].destroyables = nil
+	p.tranche[2].destroyables = nil
+
+	expected := `Phase 1: destroy
+  nothing to do
+Phase 2: install
+  tranche 1 (manifest1): kappA
+  tranche 2 (manifest2): kappC, kappD`
+
+	assert.Equal(t, expected, p.describePhases())
+}
@@ -3,12 +3,8 @@ package plan
 import (
 	"fmt"
 	"github.com/pkg/errors"
-	"github.com/sugarkube/sugarkube/internal/pkg/cacher"
-	"github.com/sugarkube/sugarkube/internal/pkg/installer"
 	"github.com/sugarkube/sugarkube/internal/pkg/kapp"
-	"github.com/sugarkube/sugarkube/internal/pkg/log"
-	"github.com/sugarkube/sugarkube/internal/pkg/provider"
-	"os"
+	"time"
 )
 
 type Tranche struct {
@@ -18,33 +14,108 @@ type Tranche struct {
 	installables []kapp.Kapp
 	// Kapps to destroy from the target cluster
 	destroyables []kapp.Kapp
-	// Kapps that are already in the target cluster so can be ignored
+	// Kapps that sugarkube must leave alone because the stack or manifest
+	// ignores them
 	ignorables []kapp.Kapp
+	// Kapps whose conditions didn't match the target stack
+	skippables []skippedKapp
+}
+
+// A kapp excluded from a plan along with the reason why
+type skippedKapp struct {
+	kapp   kapp.Kapp
+	reason string
 }
 
 type Plan struct {
 	// installation/destruction phases. Tranches will be run sequentially, but
-	// each kapp in the tranche will be processed in parallel
+	// kapps in each tranche will be processed in parallel (see pool.go)
 	tranche []Tranche
 	// contains details of the target cluster
 	stackConfig *kapp.StackConfig
 	// a cache dir to run the (make) installer over. It should already have
 	// been validated to match the stack config.
 	cacheDir string
+	// the order to run phases in. Defaults to DEFAULT_PHASE_ORDER.
+	phaseOrder []string
+	// what to do when a kapp fails. Defaults to ON_ERROR_FAIL_FAST.
+	errorPolicy string
+	// how long interrupted installers have to exit before they're killed
+	gracePeriod time.Duration
+	// the directory to write the output of kapps to. Not written if empty.
+	logDir string
+	// records the status of each action if set so runs can be resumed
+	journal *Journal
+	// the maximum number of kapps to process at once. 0 means no limit.
+	parallelism int
+	// whether to roll back kapps that fail to install (see rollback.go)
+	rollback bool
+	// revisions kapps were last installed with, if set
+	history *History
+	// versions of kapps the SOT reported as installed before an approved run
+	// in rollback mode
+	installedVersions map[string]string
 }
 
-// create a plan containing all kapps in the stackConfig, then filter out the
-// ones that don't need running based on the current state of the target cluster
-// as described by SOTs
+// create a plan containing all kapps in the stackConfig. Kapps that don't need
+// running based on the current state of the target cluster as described by
+// SOTs are filtered out by applying a cluster diff (see ApplyDiff).
 func Create(stackConfig *kapp.StackConfig, cacheDir string) (*Plan, error) {
 
 	tranches := make([]Tranche, 0)
 
+	conditions := conditionEvaluator{stackConfig: stackConfig}
+
 	for _, manifest := range stackConfig.Manifests {
 		installables := make([]kapp.Kapp, 0)
 		destroyables := make([]kapp.Kapp, 0)
+		ignorables := make([]kapp.Kapp, 0)
+		skippables := make([]skippedKapp, 0)
+
+		manifestMatches, err := conditions.matches(manifest.When)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Error evaluating the condition "+
+				"for manifest '%s'", manifest.Id)
+		}
 
 		for _, manifestKapp := range manifest.Kapps {
+			// ignored kapps are never touched, regardless of conditions
+			if stackConfig.IsIgnored(manifestKapp) {
+				ignorables = append(ignorables, manifestKapp)
+				continue
+			}
+
+			if !stackConfig.IsSelected(manifestKapp) {
+				skippables = append(skippables, skippedKapp{
+					kapp:   manifestKapp,
+					reason: "not selected by --include/--exclude",
+				})
+				continue
+			}
+
+			if !manifestMatches {
+				skippables = append(skippables, skippedKapp{
+					kapp: manifestKapp,
+					reason: fmt.Sprintf("manifest '%s' condition not met: %s",
+						manifest.Id, manifest.When),
+				})
+				continue
+			}
+
+			kappMatches, err := conditions.matches(manifestKapp.When)
+			if err != nil {
+				return nil, errors.Wrapf(err, "Error evaluating the condition "+
+					"for kapp '%s' in manifest '%s'", manifestKapp.Id, manifest.Id)
+			}
+
+			if !kappMatches {
+				skippables = append(skippables, skippedKapp{
+					kapp:   manifestKapp,
+					reason: fmt.Sprintf("condition not met: %s", manifestKapp.When),
+				})
+				continue
+			}
+
 			if manifestKapp.ShouldBePresent {
 				installables = append(installables, manifestKapp)
 			} else {
@@ -56,6 +127,8 @@ func Create(stackConfig *kapp.StackConfig, cacheDir string) (*Plan, error) {
 			manifest:     manifest,
 			installables: installables,
 			destroyables: destroyables,
+			ignorables:   ignorables,
+			skippables:   skippables,
 		}
 
 		tranches = append(tranches, tranche)
@@ -67,105 +140,5 @@ func Create(stackConfig *kapp.StackConfig, cacheDir string) (*Plan, error) {
 		cacheDir:    cacheDir,
 	}
 
-	// todo - use Sources of Truth (SOTs) to discover the current set of kapps installed
-	// todo - diff the cluster state with the desired state from the manifests to
-	// create a cluster diff
-
 	return &plan, nil
 }
-
-// Run a plan to make a target cluster have the necessary kapps installed/
-// destroyed to match the input manifests. Each tranche is run sequentially,
-// and each kapp in each tranche is processed in parallel.
-func (p *Plan) Run(approved bool, dryRun bool) error {
-
-	if p.tranche == nil {
-		log.Info("No tranches in plan to process")
-		return nil
-	}
-
-	providerImpl, err := provider.NewProvider(p.stackConfig)
-	if err != nil {
-		return errors.WithStack(err)
-	}
-
-	doneCh := make(chan bool)
-	errCh := make(chan error)
-
-	log.Debugf("Applying plan: %#v", p)
-
-	for i, tranche := range p.tranche {
-		manifestCacheDir := cacher.GetManifestCachePath(p.cacheDir, tranche.manifest)
-
-		for _, installable := range tranche.installables {
-			go processKapp(installable, p.stackConfig, manifestCacheDir, true,
-				providerImpl, doneCh, errCh, approved, dryRun)
-		}
-
-		for _, destroyable := range tranche.destroyables {
-			go processKapp(destroyable, p.stackConfig, manifestCacheDir, false,
-				providerImpl, doneCh, errCh, approved, dryRun)
-		}
-
-		totalOperations := len(tranche.installables) + len(tranche.destroyables)
-
-		for success := 0; success < totalOperations; success++ {
-			select {
-			case err := <-errCh:
-				log.Fatalf("Error processing kapp in tranche %d of plan: %s", i+1, err)
-				close(doneCh)
-				return errors.Wrapf(err, "Error processing kapp goroutine "+
-					"in tranche %d of plan", i+1)
-			case <-doneCh:
-				log.Debugf("%d kapp(s) successfully processed in tranche %d",
-					success+1, i+1)
-			}
-		}
-	}
-
-	log.Infof("Finished applying plan")
-
-	return nil
-}
-
-// Installs or destroys a kapp using the appropriate Installer
-func processKapp(kappObj kapp.Kapp, stackConfig *kapp.StackConfig,
-	manifestCacheDir string, install bool, providerImpl provider.Provider,
-	doneCh chan bool, errCh chan error, approved bool, dryRun bool) {
-
-	kappRootDir := cacher.GetKappRootPath(manifestCacheDir, kappObj)
-
-	log.Debugf("Processing kapp '%s' in %s", kappObj.Id, kappRootDir)
-
-	_, err := os.Stat(kappRootDir)
-	if err != nil {
-		msg := fmt.Sprintf("Kapp '%s' doesn't exist in the cache at '%s'",
-			kappObj.Id, kappRootDir)
-		log.Warn(msg)
-		errCh <- errors.Wrap(err, msg)
-	}
-
-	kappObj.RootDir = kappRootDir
-
-	// kapp exists, run the appropriate installer method
-	installerImpl, err := installer.NewInstaller(installer.MAKE, providerImpl)
-	if err != nil {
-		errCh <- errors.Wrapf(err, "Error instantiating installer for "+
-			"kapp '%s'", kappObj.Id)
-	}
-
-	// install the kapp
-	if install {
-		err := installer.Install(installerImpl, &kappObj, stackConfig, approved, dryRun)
-		if err != nil {
-			errCh <- errors.Wrapf(err, "Error installing kapp '%s'", kappObj.Id)
-		}
-	} else { // destroy the kapp
-		err := installer.Destroy(installerImpl, &kappObj, stackConfig, approved, dryRun)
-		if err != nil {
-			errCh <- errors.Wrapf(err, "Error destroying kapp '%s'", kappObj.Id)
-		}
-	}
-
-	doneCh <- true
-}
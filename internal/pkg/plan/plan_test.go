@@ -0,0 +1,88 @@
+package plan
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/sugarkube/sugarkube/internal/pkg/kapp"
+	"testing"
+)
+
+func TestCreateConditions(t *testing.T) {
+	tests := []struct {
+		name          string
+		desc          string
+		manifestWhen  string
+		kappWhen      string
+		expected      []string
+		expectedSkips map[string]string
+		expectedError bool
+	}{
+		{
+			name:     "no_conditions",
+			desc:     "kapps without conditions should be installed",
+			expected: []string{"manifest1:kappA", "exampleManifest2:kappB"},
+		},
+		{
+			name:         "manifest_met",
+			desc:         "kapps should be installed when their manifest's condition is met",
+			manifestWhen: `profile == "local" && vars.provisioner.memory == 4096`,
+			expected:     []string{"manifest1:kappA", "exampleManifest2:kappB"},
+		},
+		{
+			name:         "manifest_not_met",
+			desc:         "all kapps in a manifest should be skipped when its condition isn't met",
+			manifestWhen: `provider == "aws"`,
+			expected:     []string{"exampleManifest2:kappB"},
+			expectedSkips: map[string]string{
+				"manifest1:kappA": `manifest 'manifest1' condition not met: provider == "aws"`,
+			},
+		},
+		{
+			name:     "kapp_not_met",
+			desc:     "kapps should be skipped when their condition isn't met",
+			kappWhen: `vars.provisioner.memory == "4096"`,
+			expected: []string{"exampleManifest2:kappB"},
+			expectedSkips: map[string]string{
+				"manifest1:kappA": `condition not met: vars.provisioner.memory == "4096"`,
+			},
+		},
+		{
+			name:          "error_invalid",
+			desc:          "invalid conditions are errors",
+			kappWhen:      `cluster ==`,
+			expectedError: true,
+		},
+	}
+
+	for _, test := range tests {
+		stackConfig, err := kapp.LoadStackConfig("large", "../../testdata/stacks.yaml")
+		assert.Nil(t, err)
+
+		stackConfig.Manifests[0].When = test.manifestWhen
+		stackConfig.Manifests[0].Kapps[0].When = test.kappWhen
+
+		actionPlan, err := Create(stackConfig, "")
+		if test.expectedError {
+			assert.Error(t, err, test.desc)
+			continue
+		}
+		assert.Nil(t, err, test.desc)
+
+		installed := make([]string, 0)
+		skipped := map[string]string{}
+		for _, tranche := range actionPlan.tranche {
+			for _, kappObj := range tranche.installables {
+				installed = append(installed, kappObj.FullyQualifiedId())
+			}
+			for _, skippable := range tranche.skippables {
+				skipped[skippable.kapp.FullyQualifiedId()] = skippable.reason
+			}
+		}
+
+		if test.expectedSkips == nil {
+			test.expectedSkips = map[string]string{}
+		}
+
+		assert.Equal(t, test.expected, installed, test.desc)
+		assert.Equal(t, test.expectedSkips, skipped, test.desc)
+	}
+}
@@ -0,0 +1,94 @@
+package plan
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/sugarkube/sugarkube/internal/pkg/kapp"
+	"github.com/sugarkube/sugarkube/internal/pkg/log"
+	"strings"
+	"sync"
+)
+
+// Sets the maximum number of kapps to process at once across the plan. 0
+// means there's no limit. Manifests can set lower limits.
+func (p *Plan) SetParallelism(parallelism int) error {
+	if parallelism < 0 {
+		return errors.New(fmt.Sprintf("Parallelism must be 0 (unlimited) or "+
+			"more. Got: %d", parallelism))
+	}
+
+	p.parallelism = parallelism
+	return nil
+}
+
+// Returns the maximum number of kapps in a manifest to process at once, taking
+// the plan's and the manifest's limits into account. 0 means there's no limit.
+func (p *Plan) manifestParallelism(manifest kapp.Manifest) int {
+	limit := p.parallelism
+	manifestLimit := manifest.Parallelism()
+
+	if manifestLimit > 0 && (limit == 0 || manifestLimit < limit) {
+		limit = manifestLimit
+	}
+
+	return limit
+}
+
+// Tracks which kapps in a step are queued and which are running so progress
+// can be logged
+type kappQueue struct {
+	mutex sync.Mutex
+	// describes the step in logs
+	name    string
+	queued  []string
+	running []string
+}
+
+func newKappQueue(name string, kapps []kapp.Kapp) *kappQueue {
+	queued := make([]string, 0)
+	for _, kappObj := range kapps {
+		queued = append(queued, kappObj.FullyQualifiedId())
+	}
+
+	return &kappQueue{
+		name:    name,
+		queued:  queued,
+		running: []string{},
+	}
+}
+
+// Marks a kapp as running
+func (q *kappQueue) start(id string) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	q.queued = removeString(q.queued, id)
+	q.running = append(q.running, id)
+	q.log()
+}
+
+// Marks a kapp as no longer running or queued
+func (q *kappQueue) finish(id string) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	q.queued = removeString(q.queued, id)
+	q.running = removeString(q.running, id)
+	q.log()
+}
+
+// The mutex must be held
+func (q *kappQueue) log() {
+	log.Infof("%s: %d running [%s], %d queued [%s]", q.name, len(q.running),
+		strings.Join(q.running, ", "), len(q.queued), strings.Join(q.queued, ", "))
+}
+
+func removeString(values []string, value string) []string {
+	result := make([]string, 0)
+	for _, v := range values {
+		if v != value {
+			result = append(result, v)
+		}
+	}
+	return result
+}
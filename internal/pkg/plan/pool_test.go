@@ -0,0 +1,78 @@
+package plan
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/sugarkube/sugarkube/internal/pkg/kapp"
+	"testing"
+)
+
+func TestManifestParallelism(t *testing.T) {
+	tests := []struct {
+		name        string
+		desc        string
+		parallelism int
+		manifest    kapp.Manifest
+		expected    int
+	}{
+		{
+			name:     "unlimited",
+			desc:     "there should be no limit by default",
+			manifest: kapp.Manifest{Id: "manifest1"},
+			expected: 0,
+		},
+		{
+			name:        "global",
+			desc:        "the plan's limit should apply to manifests without one",
+			parallelism: 4,
+			manifest:    kapp.Manifest{Id: "manifest1"},
+			expected:    4,
+		},
+		{
+			name:        "manifest_lower",
+			desc:        "lower manifest limits should take precedence",
+			parallelism: 4,
+			manifest:    kapp.Manifest{Id: "manifest1", MaxParallel: 2},
+			expected:    2,
+		},
+		{
+			name:        "manifest_higher",
+			desc:        "manifests shouldn't be able to exceed the plan's limit",
+			parallelism: 4,
+			manifest:    kapp.Manifest{Id: "manifest1", MaxParallel: 8},
+			expected:    4,
+		},
+		{
+			name:        "serial",
+			desc:        "serial manifests should process one kapp at a time",
+			parallelism: 4,
+			manifest:    kapp.Manifest{Id: "manifest1", Serial: true},
+			expected:    1,
+		},
+	}
+
+	for _, test := range tests {
+		p := &Plan{}
+		assert.Nil(t, p.SetParallelism(test.parallelism))
+		assert.Equal(t, test.expected, p.manifestParallelism(test.manifest), test.desc)
+	}
+
+	assert.Error(t, (&Plan{}).SetParallelism(-1))
+}
+
+func TestKappQueue(t *testing.T) {
+	kapps := []kapp.Kapp{{Id: "kappA"}, {Id: "kappB"}, {Id: "kappC"}}
+	queue := newKappQueue("test", kapps)
+	assert.Equal(t, 3, len(queue.queued))
+
+	queue.start(kapps[0].FullyQualifiedId())
+	queue.start(kapps[1].FullyQualifiedId())
+	assert.Equal(t, []string{kapps[2].FullyQualifiedId()}, queue.queued)
+	assert.Equal(t, 2, len(queue.running))
+
+	queue.finish(kapps[0].FullyQualifiedId())
+	assert.Equal(t, []string{kapps[1].FullyQualifiedId()}, queue.running)
+
+	// kapps can finish without having started, e.g. if they're cancelled
+	queue.finish(kapps[2].FullyQualifiedId())
+	assert.Equal(t, []string{}, queue.queued)
+}
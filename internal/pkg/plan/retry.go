@@ -0,0 +1,101 @@
+package plan
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"github.com/sugarkube/sugarkube/internal/pkg/config"
+	"github.com/sugarkube/sugarkube/internal/pkg/kapp"
+	"github.com/sugarkube/sugarkube/internal/pkg/log"
+	"time"
+)
+
+// How a kapp's installer is run. Kapps can override the defaults from the
+// config in their installer block.
+type retryPolicy struct {
+	// how long each attempt can take. 0 means there's no limit.
+	timeout time.Duration
+	retries int
+	// delay before the first retry, doubled for each retry after it
+	backoff time.Duration
+}
+
+// Returns the retry policy for a kapp
+func newRetryPolicy(kappObj kapp.Kapp, conf config.Provider) retryPolicy {
+	policy := retryPolicy{
+		timeout: conf.GetDuration("installer_timeout"),
+		retries: conf.GetInt("installer_retries"),
+		backoff: conf.GetDuration("installer_backoff"),
+	}
+
+	if kappObj.Installer.Timeout > 0 {
+		policy.timeout = kappObj.Installer.Timeout
+	}
+
+	if kappObj.Installer.Retries != nil {
+		policy.retries = *kappObj.Installer.Retries
+	}
+
+	if kappObj.Installer.Backoff > 0 {
+		policy.backoff = kappObj.Installer.Backoff
+	}
+
+	return policy
+}
+
+// Returns how long to wait before the given retry (starting at 1)
+func (r retryPolicy) delay(retry int) time.Duration {
+	delay := r.backoff
+	for i := 1; i < retry; i++ {
+		delay *= 2
+	}
+	return delay
+}
+
+// Calls fn until it succeeds or the retries run out, giving each attempt a
+// context that's cancelled when it times out. Attempts aren't retried once
+// ctx is cancelled. Returns the number of attempts made and the last error.
+func (r retryPolicy) run(ctx context.Context, id string,
+	fn func(ctx context.Context) error) (int, error) {
+
+	var err error
+	attempts := 0
+
+	for {
+		attempts++
+		err = r.attempt(ctx, fn)
+		if err == nil || ctx.Err() != nil {
+			return attempts, err
+		}
+
+		if attempts > r.retries {
+			return attempts, err
+		}
+
+		delay := r.delay(attempts)
+		log.Warnf("Attempt %d of %d for kapp '%s' failed. Retrying in %s: %s",
+			attempts, r.retries+1, id, delay, err)
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return attempts, err
+		}
+	}
+}
+
+// Makes a single attempt, with a timeout if there is one
+func (r retryPolicy) attempt(ctx context.Context, fn func(ctx context.Context) error) error {
+	if r.timeout <= 0 {
+		return fn(ctx)
+	}
+
+	attemptCtx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	err := fn(attemptCtx)
+	if err != nil && ctx.Err() == nil && attemptCtx.Err() == context.DeadlineExceeded {
+		return errors.Wrapf(err, "Timed out after %s", r.timeout)
+	}
+
+	return err
+}
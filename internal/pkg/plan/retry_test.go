@@ -0,0 +1,118 @@
+package plan
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/sugarkube/sugarkube/internal/pkg/config"
+	"github.com/sugarkube/sugarkube/internal/pkg/kapp"
+	"testing"
+	"time"
+)
+
+func TestNewRetryPolicy(t *testing.T) {
+	conf := config.LoadConfigProvider("SUGARKUBE_TEST")
+	retries := 0
+
+	policy := newRetryPolicy(kapp.Kapp{Id: "kappA"}, conf)
+	assert.Equal(t, retryPolicy{timeout: 0, retries: 0, backoff: 10 * time.Second},
+		policy, "kapps without settings should use the defaults")
+
+	policy = newRetryPolicy(kapp.Kapp{
+		Id: "kappA",
+		Installer: kapp.InstallerSettings{
+			Timeout: 40 * time.Minute,
+			Retries: &retries,
+			Backoff: time.Minute,
+		},
+	}, conf)
+	assert.Equal(t, retryPolicy{timeout: 40 * time.Minute, retries: 0,
+		backoff: time.Minute}, policy, "kapps should override the defaults")
+}
+
+func TestRetryPolicyDelay(t *testing.T) {
+	policy := retryPolicy{backoff: time.Second}
+	assert.Equal(t, time.Second, policy.delay(1))
+	assert.Equal(t, 2*time.Second, policy.delay(2))
+	assert.Equal(t, 4*time.Second, policy.delay(3))
+}
+
+func TestRetryPolicyRun(t *testing.T) {
+	tests := []struct {
+		name             string
+		desc             string
+		policy           retryPolicy
+		failures         int
+		hang             bool
+		expectedAttempts int
+		expectedError    string
+	}{
+		{
+			name:             "success",
+			desc:             "successful kapps should only be run once",
+			policy:           retryPolicy{retries: 2, backoff: time.Millisecond},
+			expectedAttempts: 1,
+		},
+		{
+			name:             "retried",
+			desc:             "failed attempts should be retried",
+			policy:           retryPolicy{retries: 2, backoff: time.Millisecond},
+			failures:         2,
+			expectedAttempts: 3,
+		},
+		{
+			name:             "exhausted",
+			desc:             "the last error should be returned when retries run out",
+			policy:           retryPolicy{retries: 1, backoff: time.Millisecond},
+			failures:         5,
+			expectedAttempts: 2,
+			expectedError:    "attempt 2 failed",
+		},
+		{
+			name: "timeout",
+			desc: "attempts should be stopped when they time out",
+			policy: retryPolicy{timeout: 50 * time.Millisecond, retries: 1,
+				backoff: time.Millisecond},
+			hang:             true,
+			expectedAttempts: 2,
+			expectedError:    "Timed out after 50ms",
+		},
+	}
+
+	for _, test := range tests {
+		attempts := 0
+		actualAttempts, err := test.policy.run(context.Background(), "kappA",
+			func(ctx context.Context) error {
+				attempts++
+				if test.hang {
+					<-ctx.Done()
+					return errors.New("killed")
+				}
+				if attempts <= test.failures {
+					return errors.Errorf("attempt %d failed", attempts)
+				}
+				return nil
+			})
+
+		assert.Equal(t, test.expectedAttempts, actualAttempts, test.desc)
+		if test.expectedError == "" {
+			assert.Nil(t, err, test.desc)
+		} else {
+			assert.Error(t, err, test.desc)
+			assert.Contains(t, err.Error(), test.expectedError, test.desc)
+		}
+	}
+}
+
+func TestRetryPolicyCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	policy := retryPolicy{retries: 3, backoff: time.Hour}
+	attempts, err := policy.run(ctx, "kappA", func(ctx context.Context) error {
+		return errors.New("interrupted")
+	})
+
+	assert.Error(t, err)
+	assert.Equal(t, 1, attempts, "cancelled kapps shouldn't be retried")
+}
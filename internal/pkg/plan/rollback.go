@@ -0,0 +1,278 @@
+package plan
+
+import (
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/sugarkube/sugarkube/internal/pkg/acquirer"
+	"github.com/sugarkube/sugarkube/internal/pkg/cacher"
+	"github.com/sugarkube/sugarkube/internal/pkg/installer"
+	"github.com/sugarkube/sugarkube/internal/pkg/kapp"
+	"github.com/sugarkube/sugarkube/internal/pkg/log"
+	"github.com/sugarkube/sugarkube/internal/pkg/provider"
+	"github.com/sugarkube/sugarkube/internal/pkg/sot"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// In rollback mode, kapps that fail to install are reinstalled with the
+// revisions of their sources that were last installed successfully. These are
+// found in the history in the cache dir, or failing that by pinning the kapp's
+// main source to the tag of the version the SOT reported as installed before
+// the plan was run. Rolled back kapps are acquired into a separate cache dir
+// so the cache still matches the manifests.
+
+// Name of the dir in the cache dir's sugarkube dir kapps are rolled back from
+const ROLLBACK_DIR = "rollback"
+
+// Where the target revisions of a rollback came from
+const ROLLBACK_FROM_HISTORY = "history"
+const ROLLBACK_FROM_SOT = "sot"
+
+// Sets whether to roll back kapps that fail to install
+func (p *Plan) SetRollback(enabled bool) {
+	p.rollback = enabled
+}
+
+// Sets the history of revisions kapps were installed with. Kapps installed or
+// destroyed by approved runs are recorded in it.
+func (p *Plan) SetHistory(history *History) {
+	p.history = history
+}
+
+// Returns the versions of the plan's kapps installed in the target cluster
+// according to the SOT. Only used to find revisions to roll back to, so
+// errors are logged instead of stopping the plan.
+func (p *Plan) queryInstalledVersions(providerImpl provider.Provider) map[string]string {
+	versions := map[string]string{}
+
+	sotImpl, err := sot.NewSot(sot.Name(p.stackConfig), p.stackConfig, providerImpl)
+	if err == nil {
+		err = sot.Refresh(sotImpl)
+	}
+	if err != nil {
+		log.Warnf("Error querying the source of truth for installed versions "+
+			"to roll back to. Only the history will be used: %s", err)
+		return versions
+	}
+
+	for _, tranche := range p.tranche {
+		for _, kappObj := range tranche.installables {
+			id := kappObj.FullyQualifiedId()
+			version, installed, err := sot.InstalledVersion(sotImpl, id)
+			if err != nil {
+				log.Warnf("Error finding the installed version of kapp '%s': %s", id, err)
+				continue
+			}
+
+			if installed {
+				versions[id] = version
+			}
+		}
+	}
+
+	return versions
+}
+
+// Records a successful approved action in the history if there is one.
+// Failing to write the history shouldn't fail the kapp.
+func (p *Plan) recordInHistory(kappObj kapp.Kapp, manifestCacheDir string, install bool) {
+	if p.history == nil {
+		return
+	}
+
+	id := kappObj.FullyQualifiedId()
+
+	var err error
+	if install {
+		var sources []PlannedSource
+		sources, err = plannedSources(kappObj, manifestCacheDir)
+		if err == nil {
+			err = p.history.recordInstalled(id, sources)
+		}
+	} else {
+		err = p.history.recordDestroyed(id)
+	}
+
+	if err != nil {
+		log.Warnf("Error recording kapp '%s' in the history: %s", id, err)
+	}
+}
+
+// Returns a copy of the kapp with its sources pinned to the revisions to roll
+// back to from the current ones, the revisions and where they came from
+func (p *Plan) rollbackTarget(kappObj kapp.Kapp, current []PlannedSource) (kapp.Kapp,
+	[]PlannedSource, string, error) {
+
+	id := kappObj.FullyQualifiedId()
+
+	if p.history != nil {
+		if installed, ok := p.history.lastInstalled(id); ok {
+			if sameRevisions(installed.Sources, current) {
+				return kappObj, nil, "", errors.New("the revisions that failed " +
+					"are the ones last installed successfully")
+			}
+
+			pinned, err := pinSources(kappObj, installed.Sources)
+			if err != nil {
+				return kappObj, nil, "", errors.WithStack(err)
+			}
+
+			return pinned, installed.Sources, ROLLBACK_FROM_HISTORY, nil
+		}
+	}
+
+	version, ok := p.installedVersions[id]
+	mainSource := kappObj.MainSourceIndex()
+	if ok && mainSource >= 0 && isExactVersion(version) {
+		// the main source is pinned to the tag of the installed version and
+		// the others to the revisions in the cache
+		target := make([]PlannedSource, len(current))
+		copy(target, current)
+		for i := range target {
+			if target[i].Name == kappObj.Sources[mainSource].Name() {
+				target[i].Revision = version
+			}
+		}
+
+		pinned, err := pinSources(kappObj, target)
+		if err != nil {
+			return kappObj, nil, "", errors.WithStack(err)
+		}
+
+		return pinned, target, ROLLBACK_FROM_SOT, nil
+	}
+
+	return kappObj, nil, "", errors.New("no earlier successfully installed " +
+		"revision was found in the history or the source of truth")
+}
+
+// Returns a copy of a kapp with each source pinned to the revision of the
+// planned source with the same name
+func pinSources(kappObj kapp.Kapp, revisions []PlannedSource) (kapp.Kapp, error) {
+	byName := map[string]string{}
+	for _, source := range revisions {
+		byName[source.Name] = source.Revision
+	}
+
+	pinned := make([]acquirer.Acquirer, 0)
+	for _, acquirerImpl := range kappObj.Sources {
+		revision, ok := byName[acquirerImpl.Name()]
+		if !ok {
+			return kappObj, errors.New(fmt.Sprintf("Source '%s' of kapp '%s' "+
+				"has no revision to roll back to", acquirerImpl.Name(),
+				kappObj.FullyQualifiedId()))
+		}
+
+		pinned = append(pinned, acquirer.Pin(acquirerImpl, revision))
+	}
+
+	kappObj.Sources = pinned
+	return kappObj, nil
+}
+
+// Returns whether two sets of sources have the same revisions
+func sameRevisions(left []PlannedSource, right []PlannedSource) bool {
+	if len(left) != len(right) {
+		return false
+	}
+
+	revisions := map[string]string{}
+	for _, source := range left {
+		revisions[source.Name] = source.Revision
+	}
+
+	for _, source := range right {
+		if revision, ok := revisions[source.Name]; !ok || revision != source.Revision {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Describes revisions for logs and summaries, e.g. `wordpress@1a2b3c4d`
+func describeRevisions(sources []PlannedSource) string {
+	descriptions := make([]string, 0)
+	for _, source := range sources {
+		revision := source.Revision
+		// abbreviate commit SHAs
+		if len(revision) == 40 {
+			revision = revision[:8]
+		}
+		descriptions = append(descriptions, fmt.Sprintf("%s@%s", source.Name, revision))
+	}
+
+	return strings.Join(descriptions, ", ")
+}
+
+// Reinstalls a kapp that failed to install with the revisions it was last
+// installed with. The result of the failed install is updated with the
+// outcome. The original error is kept either way.
+func (p *Plan) rollbackKapp(ctx context.Context, kappObj kapp.Kapp,
+	manifest kapp.Manifest, manifestCacheDir string, providerImpl provider.Provider,
+	policy retryPolicy, failed KappResult) KappResult {
+
+	id := kappObj.FullyQualifiedId()
+	result := failed
+
+	var target []PlannedSource
+	var from string
+
+	current, err := plannedSources(kappObj, manifestCacheDir)
+	if err == nil {
+		kappObj, target, from, err = p.rollbackTarget(kappObj, current)
+	}
+	if err != nil {
+		log.Errorf("Not rolling back kapp '%s': %s", id, err)
+		result.Rollback = fmt.Sprintf("wasn't rolled back: %s", err)
+		return result
+	}
+
+	description := describeRevisions(target)
+	log.Warnf("Rolling back kapp '%s' to %s (from the %s) after it failed "+
+		"to install: %s", id, description, from, failed.Err)
+
+	start := time.Now()
+	rollbackCacheDir := filepath.Join(p.cacheDir, cacher.CACHE_DIR, ROLLBACK_DIR)
+
+	err = cacher.CacheKapp(manifest, kappObj, rollbackCacheDir, false)
+	if err == nil {
+		rollbackManifestDir := cacher.GetManifestCachePath(rollbackCacheDir, manifest)
+
+		var installerImpl installer.Installer
+		installerImpl, err = prepareKapp(&kappObj, rollbackManifestDir, providerImpl,
+			p.gracePeriod, p.logDir)
+		if err == nil {
+			// attempts aren't counted as retries of the failed install
+			_, err = policy.run(ctx, id, func(attemptCtx context.Context) error {
+				return processKapp(attemptCtx, installerImpl, kappObj, p.stackConfig,
+					true, true, false)
+			})
+		}
+	}
+
+	result.Duration += time.Since(start)
+
+	if err != nil {
+		log.Errorf("Error rolling back kapp '%s' to %s: %s", id, description, err)
+		result.Rollback = fmt.Sprintf("couldn't be rolled back to %s: %s",
+			description, truncate(err.Error()))
+		return result
+	}
+
+	if p.history != nil {
+		err = p.history.recordInstalled(id, target)
+		if err != nil {
+			log.Warnf("Error recording kapp '%s' in the history: %s", id, err)
+		}
+	}
+
+	log.Warnf("Rolled back kapp '%s' to %s", id, description)
+
+	result.Status = STATUS_ROLLED_BACK
+	result.Rollback = fmt.Sprintf("was rolled back to %s", description)
+	result.Reason = fmt.Sprintf("rolled back to %s", description)
+	return result
+}
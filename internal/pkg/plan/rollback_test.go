@@ -0,0 +1,147 @@
+package plan
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/sugarkube/sugarkube/internal/pkg/acquirer"
+	"github.com/sugarkube/sugarkube/internal/pkg/kapp"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+const OLD_SHA = "1111111111111111111111111111111111111111"
+const NEW_SHA = "2222222222222222222222222222222222222222"
+
+func TestHistory(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "sugarkube-history-")
+	assert.Nil(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	history, err := LoadHistory(tmpDir)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(history.Kapps), "a new cache dir should have no history")
+
+	sources := []PlannedSource{{Name: "wordpress", Id: "wordpress-id", Revision: OLD_SHA}}
+	assert.Nil(t, history.recordInstalled("web:wordpress", sources))
+	assert.Nil(t, history.recordInstalled("web:jenkins", sources))
+	assert.Nil(t, history.recordDestroyed("web:jenkins"))
+
+	loaded, err := LoadHistory(tmpDir)
+	assert.Nil(t, err)
+
+	installed, ok := loaded.lastInstalled("web:wordpress")
+	assert.True(t, ok)
+	assert.Equal(t, sources, installed.Sources)
+
+	_, ok = loaded.lastInstalled("web:jenkins")
+	assert.False(t, ok, "destroyed kapps shouldn't be rolled back")
+}
+
+func TestRollbackTarget(t *testing.T) {
+	kappObj := kapp.Kapp{
+		Id: "wordpress",
+		Sources: []acquirer.Acquirer{
+			acquirer.NewGitAcquirer("wordpress", "git@github.com:sugarkube/kapps.git",
+				"wordpress-~0.1", "incubator/wordpress"),
+			acquirer.NewGitAcquirer("values", "git@github.com:sugarkube/values.git",
+				"master", "wordpress"),
+		},
+	}
+	id := kappObj.FullyQualifiedId()
+
+	current := []PlannedSource{
+		{Name: "wordpress", Revision: NEW_SHA},
+		{Name: "values", Revision: NEW_SHA},
+	}
+	previous := []PlannedSource{
+		{Name: "wordpress", Revision: OLD_SHA},
+		{Name: "values", Revision: OLD_SHA},
+	}
+
+	tests := []struct {
+		name              string
+		desc              string
+		history           map[string]InstalledRevision
+		installedVersions map[string]string
+		expected          []PlannedSource
+		expectedFrom      string
+		expectedError     bool
+	}{
+		{
+			name:         "history",
+			desc:         "the revisions last installed successfully should be used",
+			history:      map[string]InstalledRevision{id: {Sources: previous}},
+			expected:     previous,
+			expectedFrom: ROLLBACK_FROM_HISTORY,
+		},
+		{
+			name:          "history_unchanged",
+			desc:          "kapps can't be rolled back to the revisions that failed",
+			history:       map[string]InstalledRevision{id: {Sources: current}},
+			expectedError: true,
+		},
+		{
+			name: "history_missing_source",
+			desc: "all sources need a revision to roll back to",
+			history: map[string]InstalledRevision{id: {Sources: []PlannedSource{
+				{Name: "wordpress", Revision: OLD_SHA}}}},
+			expectedError: true,
+		},
+		{
+			name:              "sot",
+			desc:              "the main source should be pinned to the installed version",
+			installedVersions: map[string]string{id: "wordpress-0.1.0"},
+			expected: []PlannedSource{
+				{Name: "wordpress", Revision: "wordpress-0.1.0"},
+				{Name: "values", Revision: NEW_SHA},
+			},
+			expectedFrom: ROLLBACK_FROM_SOT,
+		},
+		{
+			name:              "sot_unversioned",
+			desc:              "installed versions that aren't tags can't be used",
+			installedVersions: map[string]string{id: "wordpress"},
+			expectedError:     true,
+		},
+		{
+			name:          "nothing",
+			desc:          "kapps with no earlier revision can't be rolled back",
+			expectedError: true,
+		},
+	}
+
+	for _, test := range tests {
+		p := &Plan{
+			installedVersions: test.installedVersions,
+		}
+		if test.history != nil {
+			p.history = &History{Kapps: test.history}
+		}
+
+		pinned, target, from, err := p.rollbackTarget(kappObj, current)
+		if test.expectedError {
+			assert.Error(t, err, test.desc)
+			continue
+		}
+
+		assert.Nil(t, err, test.desc)
+		assert.Equal(t, test.expected, target, test.desc)
+		assert.Equal(t, test.expectedFrom, from, test.desc)
+		assert.Equal(t, 2, len(pinned.Sources), test.desc)
+
+		// pinning mustn't change where sources are cached
+		for i, source := range pinned.Sources {
+			pinnedId, _ := source.Id()
+			originalId, _ := kappObj.Sources[i].Id()
+			assert.Equal(t, originalId, pinnedId, test.desc)
+		}
+	}
+}
+
+func TestDescribeRevisions(t *testing.T) {
+	assert.Equal(t, "wordpress@11111111, values@wordpress-0.1.0", describeRevisions(
+		[]PlannedSource{
+			{Name: "wordpress", Revision: OLD_SHA},
+			{Name: "values", Revision: "wordpress-0.1.0"},
+		}))
+}
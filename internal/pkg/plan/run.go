@@ -0,0 +1,526 @@
+package plan
+
+import (
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/sugarkube/sugarkube/internal/pkg/cacher"
+	"github.com/sugarkube/sugarkube/internal/pkg/config"
+	"github.com/sugarkube/sugarkube/internal/pkg/installer"
+	"github.com/sugarkube/sugarkube/internal/pkg/kapp"
+	"github.com/sugarkube/sugarkube/internal/pkg/log"
+	"github.com/sugarkube/sugarkube/internal/pkg/provider"
+	"os"
+	"time"
+)
+
+// What to do when a kapp fails. With either policy, later steps of the plan
+// aren't run because they may depend on the kapp that failed.
+//   - fail-fast: cancels the other kapps in the same tranche
+//   - continue: lets the other kapps in the same tranche finish
+const ON_ERROR_FAIL_FAST = "fail-fast"
+const ON_ERROR_CONTINUE = "continue"
+
+// Sets what to do when a kapp fails
+func (p *Plan) SetErrorPolicy(policy string) error {
+	if policy != ON_ERROR_FAIL_FAST && policy != ON_ERROR_CONTINUE {
+		return errors.New(fmt.Sprintf("Unknown error policy '%s'. Use '%s' "+
+			"or '%s'", policy, ON_ERROR_FAIL_FAST, ON_ERROR_CONTINUE))
+	}
+
+	p.errorPolicy = policy
+	return nil
+}
+
+// Sets how long interrupted installers have to exit before they're killed
+func (p *Plan) SetGracePeriod(gracePeriod time.Duration) {
+	p.gracePeriod = gracePeriod
+}
+
+// Sets the directory of the run's logs. The output of each kapp is written to
+// a directory in it (see installer.NewRunLogDir).
+func (p *Plan) SetLogDir(logDir string) {
+	p.logDir = logDir
+}
+
+// Sets the journal to record the status of each action in. Actions the
+// journal says already succeeded aren't run again.
+func (p *Plan) SetJournal(journal *Journal) {
+	p.journal = journal
+}
+
+// Run a plan to make a target cluster have the necessary kapps installed/
+// destroyed to match the input manifests. Kapps are destroyed walking the
+// tranches in reverse and installed walking them forwards (see phases.go).
+// Each tranche is run sequentially, and each kapp in each tranche is processed
+// in parallel. A summary of what happened to each kapp is always returned. If
+// any kapps failed or were interrupted the error is a *RunError.
+//
+// Cancelling the context (e.g. on SIGINT) interrupts the kapps being processed
+// and stops any more being started.
+func (p *Plan) Run(ctx context.Context, approved bool, dryRun bool) (*RunSummary, error) {
+	summary := &RunSummary{
+		Results: []KappResult{},
+	}
+
+	manifestRange := p.stackConfig.ManifestRange()
+	if !manifestRange.IsEmpty() {
+		summary.Manifests = manifestRange.String()
+	}
+
+	if p.tranche == nil {
+		log.Info("No tranches in plan to process")
+		return summary, nil
+	}
+
+	providerImpl, err := provider.NewProvider(p.stackConfig)
+	if err != nil {
+		return summary, errors.WithStack(err)
+	}
+
+	log.Debugf("Applying plan: %#v", p)
+
+	for _, tranche := range p.tranche {
+		for _, ignored := range tranche.ignorables {
+			log.Infof("Ignoring unmanaged kapp '%s'", ignored.FullyQualifiedId())
+			summary.add(KappResult{
+				Id:     ignored.FullyQualifiedId(),
+				Status: STATUS_SKIPPED,
+				Reason: "ignored",
+			})
+		}
+
+		for _, skipped := range tranche.skippables {
+			log.Infof("Skipping kapp '%s': %s", skipped.kapp.FullyQualifiedId(),
+				skipped.reason)
+			summary.add(KappResult{
+				Id:     skipped.kapp.FullyQualifiedId(),
+				Status: STATUS_SKIPPED,
+				Reason: skipped.reason,
+			})
+		}
+	}
+
+	if dryRun {
+		log.Infof("Plan phases:\n%s", p.describePhases())
+	}
+
+	// what's installed has to be found before the kapps are upgraded
+	if p.rollback && approved && !dryRun {
+		p.installedVersions = p.queryInstalledVersions(providerImpl)
+	}
+
+	steps := p.phaseSteps()
+
+	if p.journal != nil && !dryRun {
+		for _, step := range steps {
+			for _, kappObj := range step.kapps {
+				if !p.journal.succeeded(kappObj.FullyQualifiedId(), step.phase, approved) {
+					p.recordInJournal(kappObj.FullyQualifiedId(), step.phase,
+						approved, STATUS_PENDING, nil)
+				}
+			}
+		}
+	}
+
+	failed := false
+	// why steps after a failure aren't started
+	cancelReason := "not started because an earlier kapp failed"
+
+	for index, step := range steps {
+		if failed || ctx.Err() != nil {
+			// later steps may depend on the kapp that failed
+			reason := cancelReason
+			if ctx.Err() != nil {
+				reason = "not started because the plan was interrupted"
+			}
+
+			for _, kappObj := range step.kapps {
+				summary.add(KappResult{
+					Id:     kappObj.FullyQualifiedId(),
+					Action: step.phase,
+					Status: STATUS_CANCELLED,
+					Reason: reason,
+				})
+			}
+			continue
+		}
+
+		preEvent, postEvent := kapp.HookEvents(step.phase == PHASE_INSTALL)
+
+		// stack hooks run around each phase
+		if index == 0 || steps[index-1].phase != step.phase {
+			err = p.runStackHooks(ctx, preEvent, providerImpl, approved, dryRun)
+			if err != nil {
+				log.Errorf("Not running the %s phase: %s", step.phase, err)
+				summary.addHookFailure(err)
+				failed = true
+				cancelReason = "not started because a hook failed"
+
+				for _, kappObj := range step.kapps {
+					summary.add(KappResult{
+						Id:     kappObj.FullyQualifiedId(),
+						Action: step.phase,
+						Status: STATUS_CANCELLED,
+						Reason: fmt.Sprintf("not started because a stack %s "+
+							"hook failed", preEvent),
+					})
+				}
+				continue
+			}
+		}
+
+		results, err := p.runStep(ctx, step, providerImpl, approved, dryRun)
+		if err != nil {
+			summary.addHookFailure(err)
+			failed = true
+			cancelReason = "not started because a hook failed"
+		}
+
+		for _, result := range results {
+			summary.add(result)
+			if result.failed() {
+				failed = true
+				cancelReason = "not started because an earlier kapp failed"
+			}
+		}
+
+		if !failed && ctx.Err() == nil &&
+			(index == len(steps)-1 || steps[index+1].phase != step.phase) {
+			err = p.runStackHooks(ctx, postEvent, providerImpl, approved, dryRun)
+			if err != nil {
+				log.Errorf("Error after the %s phase: %s", step.phase, err)
+				summary.addHookFailure(err)
+				failed = true
+				cancelReason = "not started because a hook failed"
+			}
+		}
+	}
+
+	// interrupted runs don't run failure hooks since they'd be interrupted too
+	if failed && ctx.Err() == nil {
+		err = p.runStackHooks(ctx, kapp.HOOK_ON_FAILURE, providerImpl, approved, dryRun)
+		if err != nil {
+			log.Errorf("Error running failure hooks: %s", err)
+			summary.addHookFailure(err)
+		}
+	}
+
+	interrupted := summary.WithStatus(STATUS_INTERRUPTED)
+	for _, result := range interrupted {
+		log.Warnf("Kapp '%s' was interrupted while running its %s target and "+
+			"may be partially applied", result.Id, result.Action)
+	}
+
+	if failed || len(interrupted) > 0 {
+		return summary, &RunError{Summary: summary}
+	}
+
+	log.Infof("Finished applying plan")
+
+	return summary, nil
+}
+
+// Processes the kapps in a step in parallel with a pool of workers, and returns
+// their results in the order the kapps are declared. Kapps are started in the
+// order they're declared. The manifest's hooks are run around the kapps, and
+// an error is returned if any of them fail.
+func (p *Plan) runStep(parentCtx context.Context, step phaseStep,
+	providerImpl provider.Provider, approved bool, dryRun bool) ([]KappResult, error) {
+
+	i := step.trancheIndex
+	manifest := p.tranche[i].manifest
+	preEvent, postEvent := kapp.HookEvents(step.phase == PHASE_INSTALL)
+
+	err := p.runManifestHooks(parentCtx, preEvent, manifest, providerImpl,
+		approved, dryRun)
+	if err != nil {
+		log.Errorf("Not running the %s phase for manifest '%s': %s",
+			step.phase, manifest.Id, err)
+
+		results := make([]KappResult, 0)
+		for _, kappObj := range step.kapps {
+			results = append(results, KappResult{
+				Id:     kappObj.FullyQualifiedId(),
+				Action: step.phase,
+				Status: STATUS_CANCELLED,
+				Reason: fmt.Sprintf("not started because a manifest %s hook "+
+					"failed", preEvent),
+			})
+		}
+
+		p.runManifestFailureHooks(parentCtx, manifest, providerImpl, approved, dryRun)
+		return results, err
+	}
+
+	workers := p.manifestParallelism(manifest)
+	if workers == 0 || workers > len(step.kapps) {
+		workers = len(step.kapps)
+	}
+
+	log.Infof("Running %s phase for tranche %d (manifest '%s') with %d "+
+		"kapp(s) at a time", step.phase, i+1, manifest.Id, workers)
+
+	ctx, cancel := context.WithCancel(parentCtx)
+	defer cancel()
+
+	type indexedResult struct {
+		index  int
+		result KappResult
+	}
+
+	jobs := make(chan int, len(step.kapps))
+	for j := range step.kapps {
+		jobs <- j
+	}
+	close(jobs)
+
+	queue := newKappQueue(fmt.Sprintf("Tranche %d %s", i+1, step.phase), step.kapps)
+	resultCh := make(chan indexedResult)
+
+	for w := 0; w < workers; w++ {
+		go func() {
+			for index := range jobs {
+				result := p.runKapp(ctx, parentCtx, step, step.kapps[index],
+					queue, providerImpl, approved, dryRun)
+				resultCh <- indexedResult{index: index, result: result}
+			}
+		}()
+	}
+
+	results := make([]KappResult, len(step.kapps))
+
+	for received := 0; received < len(step.kapps); received++ {
+		indexed := <-resultCh
+		results[indexed.index] = indexed.result
+
+		if indexed.result.failed() {
+			log.Errorf("Error processing kapp '%s' in tranche %d of plan: %s",
+				indexed.result.Id, i+1, indexed.result.Err)
+
+			if p.errorPolicy != ON_ERROR_CONTINUE && ctx.Err() == nil {
+				log.Warnf("Cancelling the other kapps in tranche %d", i+1)
+				cancel()
+			}
+		}
+	}
+
+	kappFailed := false
+	for _, result := range results {
+		if result.failed() {
+			kappFailed = true
+		}
+	}
+
+	if parentCtx.Err() != nil {
+		return results, nil
+	}
+
+	if !kappFailed {
+		err = p.runManifestHooks(parentCtx, postEvent, manifest, providerImpl,
+			approved, dryRun)
+		if err != nil {
+			log.Errorf("Error after the %s phase for manifest '%s': %s",
+				step.phase, manifest.Id, err)
+		}
+	}
+
+	if kappFailed || err != nil {
+		p.runManifestFailureHooks(parentCtx, manifest, providerImpl, approved, dryRun)
+	}
+
+	return results, err
+}
+
+// Runs a manifest's on_failure hooks. They're only logged if they fail since
+// the step has already failed.
+func (p *Plan) runManifestFailureHooks(ctx context.Context, manifest kapp.Manifest,
+	providerImpl provider.Provider, approved bool, dryRun bool) {
+	err := p.runManifestHooks(ctx, kapp.HOOK_ON_FAILURE, manifest, providerImpl,
+		approved, dryRun)
+	if err != nil {
+		log.Errorf("Error running failure hooks for manifest '%s': %s",
+			manifest.Id, err)
+	}
+}
+
+// Processes a single kapp in a step unless it already succeeded or the step
+// was cancelled while it was queued. parentCtx is cancelled if the plan is
+// interrupted, and ctx if another kapp in the step failed.
+func (p *Plan) runKapp(ctx context.Context, parentCtx context.Context,
+	step phaseStep, kappObj kapp.Kapp, queue *kappQueue,
+	providerImpl provider.Provider, approved bool, dryRun bool) KappResult {
+
+	id := kappObj.FullyQualifiedId()
+
+	if p.journal != nil && !dryRun && p.journal.succeeded(id, step.phase, approved) {
+		log.Infof("Not running %s for kapp '%s' because it already "+
+			"succeeded", step.phase, id)
+		queue.finish(id)
+		return KappResult{
+			Id:     id,
+			Action: step.phase,
+			Status: STATUS_SKIPPED,
+			Reason: "already succeeded in the resumed run",
+		}
+	}
+
+	if ctx.Err() != nil {
+		queue.finish(id)
+
+		reason := "not started because another kapp failed"
+		if parentCtx.Err() != nil {
+			reason = "not started because the plan was interrupted"
+		}
+
+		return KappResult{
+			Id:     id,
+			Action: step.phase,
+			Status: STATUS_CANCELLED,
+			Reason: reason,
+		}
+	}
+
+	manifest := p.tranche[step.trancheIndex].manifest
+	manifestCacheDir := cacher.GetManifestCachePath(p.cacheDir, manifest)
+
+	install := step.phase == PHASE_INSTALL
+	preEvent, postEvent := kapp.HookEvents(install)
+	policy := newRetryPolicy(kappObj, config.Config())
+	attempts := 0
+
+	queue.start(id)
+	start := time.Now()
+
+	installerImpl, err := prepareKapp(&kappObj, manifestCacheDir, providerImpl,
+		p.gracePeriod, p.logDir)
+	if err == nil {
+		err = p.runKappHooks(ctx, preEvent, installerImpl, &kappObj, approved, dryRun)
+	}
+	if err == nil {
+		attempts, err = policy.run(ctx, id, func(attemptCtx context.Context) error {
+			return processKapp(attemptCtx, installerImpl, kappObj, p.stackConfig,
+				install, approved, dryRun)
+		})
+	}
+	if err == nil {
+		err = p.runKappHooks(ctx, postEvent, installerImpl, &kappObj, approved, dryRun)
+	}
+
+	// kapps that were stopped didn't fail
+	if err != nil && installerImpl != nil && ctx.Err() == nil {
+		hookErr := p.runKappHooks(parentCtx, kapp.HOOK_ON_FAILURE, installerImpl,
+			&kappObj, approved, dryRun)
+		if hookErr != nil {
+			log.Errorf("Error running failure hooks for kapp '%s': %s", id, hookErr)
+		}
+	}
+
+	result := KappResult{
+		Id:       id,
+		Action:   step.phase,
+		Status:   STATUS_SUCCEEDED,
+		Duration: time.Since(start),
+		Attempts: attempts,
+		Err:      err,
+	}
+
+	if err != nil {
+		result.Status = STATUS_FAILED
+		// kapps stopped because of a signal or because a sibling
+		// failed didn't fail themselves
+		if parentCtx.Err() != nil {
+			result.Status = STATUS_INTERRUPTED
+			result.Reason = "interrupted"
+		} else if ctx.Err() != nil {
+			result.Status = STATUS_CANCELLED
+			result.Reason = "cancelled because another kapp failed"
+		}
+	}
+
+	if approved && !dryRun {
+		if err == nil {
+			p.recordInHistory(kappObj, manifestCacheDir, install)
+		} else if result.Status == STATUS_FAILED && install && p.rollback {
+			result = p.rollbackKapp(ctx, kappObj, manifest, manifestCacheDir,
+				providerImpl, policy, result)
+		}
+	}
+	queue.finish(id)
+
+	if !dryRun {
+		p.recordInJournal(result.Id, result.Action, approved, result.Status, err)
+	}
+
+	return result
+}
+
+// Records the status of an action in the journal if there is one. Failing to
+// write the journal shouldn't stop kapps from being processed.
+func (p *Plan) recordInJournal(id string, action string, approved bool,
+	status string, actionErr error) {
+	if p.journal == nil {
+		return
+	}
+
+	err := p.journal.record(id, action, approved, status, actionErr)
+	if err != nil {
+		log.Warnf("Error recording status of kapp '%s' in the journal: %s", id, err)
+	}
+}
+
+// Points a kapp at its directory in the cache, loads its metadata and returns
+// the installer to process it with
+func prepareKapp(kappObj *kapp.Kapp, manifestCacheDir string,
+	providerImpl provider.Provider, gracePeriod time.Duration,
+	logDir string) (installer.Installer, error) {
+
+	kappRootDir := cacher.GetKappRootPath(manifestCacheDir, *kappObj)
+
+	log.Debugf("Processing kapp '%s' in %s", kappObj.FullyQualifiedId(), kappRootDir)
+
+	_, err := os.Stat(kappRootDir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Kapp '%s' doesn't exist in the cache at '%s'",
+			kappObj.FullyQualifiedId(), kappRootDir)
+	}
+
+	kappObj.RootDir = kappRootDir
+
+	err = kappObj.LoadMetadata()
+	if err != nil {
+		return nil, errors.Wrapf(err, "Error loading metadata for kapp '%s'",
+			kappObj.FullyQualifiedId())
+	}
+
+	// kapp exists, create the installer to run it with
+	installerImpl, err := installer.NewInstaller(installer.MAKE, providerImpl, gracePeriod,
+		logDir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Error instantiating installer for "+
+			"kapp '%s'", kappObj.FullyQualifiedId())
+	}
+
+	return installerImpl, nil
+}
+
+// Installs or destroys a kapp using the appropriate Installer. Installers
+// stop if the context is cancelled.
+func processKapp(ctx context.Context, installerImpl installer.Installer,
+	kappObj kapp.Kapp, stackConfig *kapp.StackConfig, install bool,
+	approved bool, dryRun bool) error {
+
+	if install {
+		err := installer.Install(ctx, installerImpl, &kappObj, stackConfig, approved, dryRun)
+		if err != nil {
+			return errors.Wrapf(err, "Error installing kapp '%s'", kappObj.FullyQualifiedId())
+		}
+	} else {
+		err := installer.Destroy(ctx, installerImpl, &kappObj, stackConfig, approved, dryRun)
+		if err != nil {
+			return errors.Wrapf(err, "Error destroying kapp '%s'", kappObj.FullyQualifiedId())
+		}
+	}
+
+	return nil
+}
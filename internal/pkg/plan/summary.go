@@ -0,0 +1,227 @@
+package plan
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Statuses of kapps after running a plan
+const STATUS_SUCCEEDED = "succeeded"
+const STATUS_FAILED = "failed"
+
+// excluded from the plan, e.g. because a condition wasn't met
+const STATUS_SKIPPED = "skipped"
+
+// planned but stopped or never started
+const STATUS_CANCELLED = "cancelled"
+
+// stopped part way through by a signal, so may be partially applied
+const STATUS_INTERRUPTED = "interrupted"
+
+// failed to install but reinstalled with the revisions last installed
+// successfully
+const STATUS_ROLLED_BACK = "rolled-back"
+
+// Exit code used when kapps fail
+const EXIT_KAPPS_FAILED = 2
+
+// Exit code used when the plan was interrupted, as shells do for SIGINT
+const EXIT_INTERRUPTED = 130
+
+// What happened to a kapp when a plan was run
+type KappResult struct {
+	// fully qualified kapp ID
+	Id string
+	// the phase the kapp was processed in. Empty for skipped kapps.
+	Action   string
+	Status   string
+	Reason   string
+	Duration time.Duration
+	// how many times the installer was run. 0 if it never started.
+	Attempts int
+	Err      error
+	// what happened when the kapp was rolled back after failing to install.
+	// Empty if it wasn't.
+	Rollback string
+}
+
+// Returns whether the kapp didn't end up how the plan intended. Rolled back
+// kapps failed even though they were reinstalled.
+func (r KappResult) failed() bool {
+	return r.Status == STATUS_FAILED || r.Status == STATUS_ROLLED_BACK
+}
+
+// The results of running a plan, in the order kapps were processed
+type RunSummary struct {
+	// describes the slice of the stack's manifests that was run, if any
+	Manifests string
+	Results   []KappResult
+	// stack and manifest hooks that failed
+	HookFailures []error
+}
+
+func (s *RunSummary) add(result KappResult) {
+	s.Results = append(s.Results, result)
+}
+
+func (s *RunSummary) addHookFailure(err error) {
+	s.HookFailures = append(s.HookFailures, err)
+}
+
+// Returns the number of kapps with each status
+func (s *RunSummary) Counts() map[string]int {
+	counts := map[string]int{}
+	for _, result := range s.Results {
+		counts[result.Status]++
+	}
+	return counts
+}
+
+// Returns the total number of retries made across all kapps
+func (s *RunSummary) Retries() int {
+	retries := 0
+	for _, result := range s.Results {
+		if result.Attempts > 1 {
+			retries += result.Attempts - 1
+		}
+	}
+	return retries
+}
+
+// Returns the results of kapps with the given status
+func (s *RunSummary) WithStatus(status string) []KappResult {
+	results := make([]KappResult, 0)
+	for _, result := range s.Results {
+		if result.Status == status {
+			results = append(results, result)
+		}
+	}
+	return results
+}
+
+// Writes the summary as a table
+func (s *RunSummary) Write(out io.Writer) error {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+
+	_, err := fmt.Fprintln(w, "KAPP\tACTION\tSTATUS\tDURATION\tATTEMPTS\tDETAILS")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	for _, result := range s.Results {
+		action := result.Action
+		if action == "" {
+			action = "-"
+		}
+
+		duration := "-"
+		if result.Duration > 0 {
+			duration = result.Duration.Round(100 * time.Millisecond).String()
+		}
+
+		attempts := "-"
+		if result.Attempts > 0 {
+			attempts = fmt.Sprintf("%d", result.Attempts)
+		}
+
+		details := result.Reason
+		if result.Status == STATUS_FAILED && result.Err != nil {
+			details = truncate(result.Err.Error())
+		}
+
+		_, err = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", result.Id, action,
+			result.Status, duration, attempts, details)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	counts := s.Counts()
+	_, err = fmt.Fprintf(w, "\n%d succeeded, %d failed, %d skipped, %d cancelled, "+
+		"%d interrupted, %d rolled back, %d retries\n", counts[STATUS_SUCCEEDED],
+		counts[STATUS_FAILED], counts[STATUS_SKIPPED], counts[STATUS_CANCELLED],
+		counts[STATUS_INTERRUPTED], counts[STATUS_ROLLED_BACK], s.Retries())
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if s.Manifests != "" {
+		_, err = fmt.Fprintf(w, "Manifests: %s\n", s.Manifests)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	// the table only has room for the start of these
+	for _, result := range s.Results {
+		if result.Rollback == "" {
+			continue
+		}
+
+		_, err = fmt.Fprintf(w, "Kapp '%s' %s. Original error: %s\n", result.Id,
+			result.Rollback, truncate(result.Err.Error()))
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	for _, hookErr := range s.HookFailures {
+		_, err = fmt.Fprintf(w, "Hook failed: %s\n", truncate(hookErr.Error()))
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	return w.Flush()
+}
+
+// Full errors are logged so only show the start of them in tables
+const MAX_DETAILS_LENGTH = 80
+
+func truncate(message string) string {
+	message = strings.SplitN(message, "\n", 2)[0]
+	if len(message) > MAX_DETAILS_LENGTH {
+		message = message[:MAX_DETAILS_LENGTH-3] + "..."
+	}
+	return message
+}
+
+// Returned when kapps or hooks fail while running a plan
+type RunError struct {
+	Summary *RunSummary
+}
+
+func (e *RunError) Error() string {
+	messages := make([]string, 0)
+
+	for _, status := range []string{STATUS_FAILED, STATUS_ROLLED_BACK, STATUS_INTERRUPTED} {
+		ids := make([]string, 0)
+		for _, result := range e.Summary.WithStatus(status) {
+			ids = append(ids, result.Id)
+		}
+
+		if len(ids) > 0 {
+			messages = append(messages, fmt.Sprintf("%d kapp(s) %s: %s",
+				len(ids), status, strings.Join(ids, ", ")))
+		}
+	}
+
+	if len(e.Summary.HookFailures) > 0 {
+		messages = append(messages, fmt.Sprintf("%d hook(s) failed",
+			len(e.Summary.HookFailures)))
+	}
+
+	return strings.Join(messages, "; ")
+}
+
+// Interruptions take precedence so scripts can tell when a run was stopped
+func (e *RunError) ExitCode() int {
+	if len(e.Summary.WithStatus(STATUS_INTERRUPTED)) > 0 {
+		return EXIT_INTERRUPTED
+	}
+	return EXIT_KAPPS_FAILED
+}
@@ -0,0 +1,157 @@
+package plan
+
+import (
+	"bytes"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestSummary() *RunSummary {
+	return &RunSummary{
+		Results: []KappResult{
+			{Id: "manifest1:kappA", Status: STATUS_SKIPPED, Reason: "condition not met"},
+			{Id: "manifest1:kappB", Action: PHASE_INSTALL, Status: STATUS_SUCCEEDED,
+				Duration: 1500 * time.Millisecond, Attempts: 1},
+			{Id: "manifest1:kappC", Action: PHASE_INSTALL, Status: STATUS_FAILED,
+				Duration: 2 * time.Second, Attempts: 3,
+				Err:      errors.New("Error installing kapp 'kappC'\nmore output")},
+			{Id: "manifest2:kappD", Action: PHASE_INSTALL, Status: STATUS_CANCELLED,
+				Reason: "not started because an earlier kapp failed"},
+		},
+	}
+}
+
+func TestCounts(t *testing.T) {
+	expected := map[string]int{
+		STATUS_SKIPPED:   1,
+		STATUS_SUCCEEDED: 1,
+		STATUS_FAILED:    1,
+		STATUS_CANCELLED: 1,
+	}
+
+	assert.Equal(t, expected, newTestSummary().Counts())
+}
+
+func TestWriteSummary(t *testing.T) {
+	var out bytes.Buffer
+	err := newTestSummary().Write(&out)
+	assert.Nil(t, err)
+
+	lines := strings.Split(out.String(), "\n")
+	assert.Equal(t, []string{"KAPP", "ACTION", "STATUS", "DURATION", "ATTEMPTS", "DETAILS"},
+		strings.Fields(lines[0]))
+	assert.Equal(t, []string{"manifest1:kappA", "-", "skipped", "-", "-", "condition",
+		"not", "met"}, strings.Fields(lines[1]))
+	assert.Equal(t, []string{"manifest1:kappB", "install", "succeeded", "1.5s", "1"},
+		strings.Fields(lines[2]))
+	// only the first line of errors is shown
+	assert.Equal(t, []string{"manifest1:kappC", "install", "failed", "2s", "3", "Error",
+		"installing", "kapp", "'kappC'"}, strings.Fields(lines[3]))
+	assert.Contains(t, out.String(), "1 succeeded, 1 failed, 1 skipped, 1 cancelled, "+
+		"0 interrupted, 0 rolled back, 2 retries")
+}
+
+func TestWriteSummaryManifests(t *testing.T) {
+	summary := newTestSummary()
+	summary.Manifests = "from manifest2"
+
+	var out bytes.Buffer
+	err := summary.Write(&out)
+	assert.Nil(t, err)
+
+	assert.Contains(t, out.String(), "2 retries\nManifests: from manifest2\n")
+}
+
+func TestWriteSummaryRollback(t *testing.T) {
+	summary := newTestSummary()
+	summary.add(KappResult{Id: "manifest2:kappE", Action: PHASE_INSTALL,
+		Status: STATUS_ROLLED_BACK, Attempts: 1, Reason: "rolled back to kappE@1a2b3c4d",
+		Rollback: "was rolled back to kappE@1a2b3c4d",
+		Err:      errors.New("Error installing kapp 'kappE'")})
+
+	var out bytes.Buffer
+	err := summary.Write(&out)
+	assert.Nil(t, err)
+
+	lines := strings.Split(out.String(), "\n")
+	assert.Equal(t, []string{"manifest2:kappE", "install", "rolled-back", "-", "1",
+		"rolled", "back", "to", "kappE@1a2b3c4d"}, strings.Fields(lines[5]))
+	// the original error should be reported
+	assert.Contains(t, out.String(), "1 rolled back, 2 retries\nKapp 'manifest2:kappE' "+
+		"was rolled back to kappE@1a2b3c4d. Original error: Error installing kapp 'kappE'\n")
+
+	// rolled back kapps didn't install the intended revisions
+	runErr := &RunError{Summary: summary}
+	assert.Equal(t, "1 kapp(s) failed: manifest1:kappC; 1 kapp(s) rolled-back: "+
+		"manifest2:kappE", runErr.Error())
+	assert.Equal(t, EXIT_KAPPS_FAILED, runErr.ExitCode())
+}
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		name     string
+		desc     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "short",
+			desc:     "short messages should be left alone",
+			input:    "failed",
+			expected: "failed",
+		},
+		{
+			name:     "multiline",
+			desc:     "only the first line should be kept",
+			input:    "failed\nstdout",
+			expected: "failed",
+		},
+		{
+			name:     "long",
+			desc:     "long messages should be cut short",
+			input:    strings.Repeat("a", MAX_DETAILS_LENGTH+10),
+			expected: strings.Repeat("a", MAX_DETAILS_LENGTH-3) + "...",
+		},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.expected, truncate(test.input), test.desc)
+	}
+}
+
+func TestRunError(t *testing.T) {
+	err := &RunError{Summary: newTestSummary()}
+	assert.Equal(t, "1 kapp(s) failed: manifest1:kappC", err.Error())
+	assert.Equal(t, EXIT_KAPPS_FAILED, err.ExitCode())
+
+	// interruptions should take precedence over failures
+	summary := newTestSummary()
+	summary.add(KappResult{Id: "manifest2:kappE", Action: PHASE_INSTALL,
+		Status: STATUS_INTERRUPTED})
+	err = &RunError{Summary: summary}
+	assert.Equal(t, "1 kapp(s) failed: manifest1:kappC; 1 kapp(s) interrupted: "+
+		"manifest2:kappE", err.Error())
+	assert.Equal(t, EXIT_INTERRUPTED, err.ExitCode())
+
+	// hooks that failed should be reported
+	summary = newTestSummary()
+	summary.addHookFailure(errors.New("Error running stack post_install hook"))
+	err = &RunError{Summary: summary}
+	assert.Equal(t, "1 kapp(s) failed: manifest1:kappC; 1 hook(s) failed", err.Error())
+	assert.Equal(t, EXIT_KAPPS_FAILED, err.ExitCode())
+
+	// the exit code should still be found once the error is wrapped
+	wrapped := errors.WithStack(err)
+	_, ok := errors.Cause(wrapped).(*RunError)
+	assert.True(t, ok)
+}
+
+func TestSetErrorPolicy(t *testing.T) {
+	p := &Plan{}
+	assert.Nil(t, p.SetErrorPolicy(ON_ERROR_CONTINUE))
+	assert.Equal(t, ON_ERROR_CONTINUE, p.errorPolicy)
+	assert.Error(t, p.SetErrorPolicy("ignore"))
+}
@@ -0,0 +1,76 @@
+package provider
+
+import (
+	"github.com/pkg/errors"
+	"github.com/sugarkube/sugarkube/internal/pkg/kapp"
+	"github.com/sugarkube/sugarkube/internal/pkg/log"
+	"os"
+	"path/filepath"
+)
+
+// Manifest overlays are searched for in this subdirectory of each vars dir,
+// named after the ID of the manifest they patch, e.g.
+// `providers/local/profiles/prod/manifests/40-wordpress-sites.yaml`
+const MANIFEST_OVERLAYS_DIR = "manifests"
+
+// Returns the paths of overlays for a manifest, from the least to the most
+// specific
+func ManifestOverlayPaths(stackConfig *kapp.StackConfig, manifest kapp.Manifest) ([]string, error) {
+	providerImpl, err := newProviderImpl(stackConfig.Provider)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	varsDirs, err := providerImpl.varsDirs(stackConfig)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	paths := make([]string, 0)
+
+	for _, varsDir := range varsDirs {
+		path := filepath.Join(varsDir, MANIFEST_OVERLAYS_DIR, manifest.Id+".yaml")
+
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+
+		paths = append(paths, path)
+	}
+
+	return paths, nil
+}
+
+// Applies any overlays for the stack's profile, cluster, etc. to its manifests
+func ApplyManifestOverlays(stackConfig *kapp.StackConfig) error {
+	if stackConfig.Provider == "" {
+		log.Debug("No provider configured. Not applying manifest overlays.")
+		return errors.WithStack(kapp.ValidateStackConfig(stackConfig))
+	}
+
+	for i, manifest := range stackConfig.Manifests {
+		overlayPaths, err := ManifestOverlayPaths(stackConfig, manifest)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		if len(overlayPaths) == 0 {
+			continue
+		}
+
+		log.Infof("Applying overlays to manifest '%s': %v", manifest.Id, overlayPaths)
+
+		err = kapp.ApplyOverlays(&stackConfig.Manifests[i], overlayPaths)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	// overlays may add kapps
+	err := kapp.ValidateStackConfig(stackConfig)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
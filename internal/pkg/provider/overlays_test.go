@@ -0,0 +1,45 @@
+package provider
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/sugarkube/sugarkube/internal/pkg/acquirer"
+	"github.com/sugarkube/sugarkube/internal/pkg/kapp"
+	"testing"
+)
+
+func TestManifestOverlayPaths(t *testing.T) {
+	sc, err := kapp.LoadStackConfig("large", "../../testdata/stacks.yaml")
+	assert.Nil(t, err)
+
+	actual, err := ManifestOverlayPaths(sc, sc.Manifests[1])
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		"../../testdata/stacks/local/profiles/local/manifests/exampleManifest2.yaml",
+		"../../testdata/stacks/local/profiles/local/clusters/large/manifests/exampleManifest2.yaml",
+	}, actual)
+
+	actual, err = ManifestOverlayPaths(sc, sc.Manifests[0])
+	assert.Nil(t, err)
+	assert.Empty(t, actual)
+}
+
+func TestApplyManifestOverlays(t *testing.T) {
+	sc, err := kapp.LoadStackConfig("large", "../../testdata/stacks.yaml")
+	assert.Nil(t, err)
+
+	err = ApplyManifestOverlays(sc)
+	assert.Nil(t, err)
+
+	kapps := sc.Manifests[1].Kapps
+	assert.Equal(t, 2, len(kapps))
+
+	// the most specific overlay wins
+	assert.Equal(t, "kappB", kapps[0].Id)
+	assert.Equal(t, []acquirer.Acquirer{
+		acquirer.NewGitAcquirer("pathB", "git@github.com:sugarkube/kapps-B.git",
+			"kappB-0.3.0", "some/pathB"),
+	}, kapps[0].Sources)
+
+	assert.Equal(t, "exampleManifest2:kappC", kapps[1].FullyQualifiedId())
+	assert.False(t, kapps[1].ShouldBePresent)
+}
@@ -0,0 +1,121 @@
+package schema
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// The YAML library doesn't report where values were parsed from, so this
+// builds an index of the line and column of each key and list item in a
+// document by scanning its text. Only block-style YAML is indexed. Values in
+// flow-style collections (e.g. `[a, b]`) are reported at the position of the
+// collection.
+
+type Position struct {
+	Line   int
+	Column int
+}
+
+var keyLineRegex = regexp.MustCompile(`^("[^"]*"|'[^']*'|[^\s"'#][^#]*?)\s*:(?:\s+(.*))?$`)
+
+type positionFrame struct {
+	indent int
+	path   string
+	isItem bool
+	items  int
+}
+
+// Returns the position of each key and list item in a YAML document keyed by
+// its path, e.g. `present.wordpress.sources[0].uri`
+func indexPositions(data []byte) map[string]Position {
+	positions := map[string]Position{}
+	stack := []*positionFrame{{indent: -1}}
+
+	// lines more indented than this are part of a block scalar
+	blockScalarIndent := -1
+
+	for i, line := range strings.Split(string(data), "\n") {
+		trimmed := strings.TrimLeft(line, " ")
+		indent := len(line) - len(trimmed)
+
+		if blockScalarIndent >= 0 {
+			if trimmed == "" || indent > blockScalarIndent {
+				continue
+			}
+			blockScalarIndent = -1
+		}
+
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") ||
+			strings.HasPrefix(trimmed, "---") {
+			continue
+		}
+
+		// list items may contain a key on the same line, e.g. `- uri: ...`
+		for trimmed == "-" || strings.HasPrefix(trimmed, "- ") {
+			for len(stack) > 1 {
+				top := stack[len(stack)-1]
+				if top.indent > indent || (top.indent == indent && top.isItem) {
+					stack = stack[:len(stack)-1]
+				} else {
+					break
+				}
+			}
+
+			parent := stack[len(stack)-1]
+			path := parent.path + "[" + strconv.Itoa(parent.items) + "]"
+			parent.items++
+
+			positions[path] = Position{Line: i + 1, Column: indent + 1}
+			stack = append(stack, &positionFrame{indent: indent, path: path, isItem: true})
+
+			rest := strings.TrimLeft(strings.TrimPrefix(trimmed, "-"), " ")
+			indent += len(trimmed) - len(rest)
+			trimmed = rest
+		}
+
+		matches := keyLineRegex.FindStringSubmatch(trimmed)
+		if matches == nil {
+			continue
+		}
+
+		for len(stack) > 1 && stack[len(stack)-1].indent >= indent {
+			stack = stack[:len(stack)-1]
+		}
+
+		key := strings.Trim(matches[1], `"'`)
+		path := key
+		if parent := stack[len(stack)-1]; parent.path != "" {
+			path = parent.path + "." + key
+		}
+
+		positions[path] = Position{Line: i + 1, Column: indent + 1}
+
+		value := strings.TrimSpace(matches[2])
+		if strings.HasPrefix(value, "|") || strings.HasPrefix(value, ">") {
+			blockScalarIndent = indent
+		} else if value == "" || strings.HasPrefix(value, "#") {
+			stack = append(stack, &positionFrame{indent: indent, path: path})
+		}
+	}
+
+	return positions
+}
+
+// Returns the position of the value at a path, or of its closest ancestor
+// that was indexed
+func lookupPosition(positions map[string]Position, path string) Position {
+	for path != "" {
+		if position, ok := positions[path]; ok {
+			return position
+		}
+
+		cut := strings.LastIndexAny(path, ".[")
+		if cut < 0 {
+			break
+		}
+		path = path[:cut]
+	}
+
+	return Position{Line: 1, Column: 1}
+}
@@ -0,0 +1,186 @@
+package schema
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"testing"
+)
+
+// the published schemas must match the ones used for validation
+func TestPublishedSchemas(t *testing.T) {
+	for path, schema := range map[string]string{
+		"../../../schemas/manifest.schema.json": MANIFEST_SCHEMA,
+		"../../../schemas/stacks.schema.json":   STACKS_SCHEMA,
+		"../../../schemas/metadata.schema.json": METADATA_SCHEMA,
+	} {
+		data, err := ioutil.ReadFile(path)
+		assert.Nil(t, err)
+
+		var published, internal interface{}
+		assert.Nil(t, json.Unmarshal(data, &published))
+		assert.Nil(t, json.Unmarshal([]byte(schema), &internal))
+		assert.Equal(t, published, internal, "schema %s is out of sync", path)
+	}
+}
+
+func TestIndexPositions(t *testing.T) {
+	input := `# a comment
+present:
+  wordpress:
+    when: |
+      provider == "aws"
+    sources:
+    - uri: git@github.com:sugarkube/kapps.git
+      path: incubator/wordpress
+    -   uri: git@github.com:sugarkube/kapps.git
+        path: incubator/common-makefiles
+  "tiller":
+    sources:
+      - uri: git@github.com:sugarkube/kapps.git
+vars:
+- providers/
+`
+
+	expected := map[string]Position{
+		"present":                           {Line: 2, Column: 1},
+		"present.wordpress":                 {Line: 3, Column: 3},
+		"present.wordpress.when":            {Line: 4, Column: 5},
+		"present.wordpress.sources":         {Line: 6, Column: 5},
+		"present.wordpress.sources[0]":      {Line: 7, Column: 5},
+		"present.wordpress.sources[0].uri":  {Line: 7, Column: 7},
+		"present.wordpress.sources[0].path": {Line: 8, Column: 7},
+		"present.wordpress.sources[1]":      {Line: 9, Column: 5},
+		"present.wordpress.sources[1].uri":  {Line: 9, Column: 9},
+		"present.wordpress.sources[1].path": {Line: 10, Column: 9},
+		"present.tiller":                    {Line: 11, Column: 3},
+		"present.tiller.sources":            {Line: 12, Column: 5},
+		"present.tiller.sources[0]":         {Line: 13, Column: 7},
+		"present.tiller.sources[0].uri":     {Line: 13, Column: 9},
+		"vars":                              {Line: 14, Column: 1},
+		"vars[0]":                           {Line: 15, Column: 1},
+	}
+
+	assert.Equal(t, expected, indexPositions([]byte(input)))
+}
+
+func TestValidateManifest(t *testing.T) {
+	tests := []struct {
+		name         string
+		desc         string
+		input        string
+		expectValues []string
+	}{
+		{
+			name: "good",
+			desc: "check valid manifests have no problems",
+			input: `
+present:
+  wordpress:
+    when: provider == "aws"
+    params:
+      replicas: 2
+    sources:
+    - uri: git@github.com:sugarkube/kapps.git
+      version: wordpress-~0.1
+      path: incubator/wordpress
+`,
+			expectValues: []string{},
+		},
+		{
+			name: "bad_keys_and_types",
+			desc: "check problems are reported with positions and suggestions",
+			input: `
+present:
+  wordpress:
+    sorces:
+    - uri: git@github.com:sugarkube/kapps.git
+  tiller:
+    sources:
+    - uri: git@github.com:sugarkube/kapps.git
+      branh: master
+    - uri: git@github.com:sugarkube/kapps.git
+      path: 1.0
+absnt: {}
+`,
+			expectValues: []string{
+				"test.yaml:4:5: unknown key 'sorces' in 'present.wordpress'. Did you mean 'sources'?",
+				"test.yaml:8:5: 'present.tiller.sources[0]' is missing required key 'path'",
+				"test.yaml:9:7: unknown key 'branh' in 'present.tiller.sources[0]'. Did you mean 'branch'?",
+				"test.yaml:11:7: 'present.tiller.sources[1].path' should be a string but is a number",
+				"test.yaml:12:1: unknown key 'absnt' in the document. Did you mean 'absent'?",
+			},
+		},
+		{
+			name:  "bad_syntax",
+			desc:  "check YAML syntax errors are reported as problems",
+			input: "present:\n  a:\n   b: [\n",
+			expectValues: []string{
+				"test.yaml:3:1: did not find expected node content",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		problems, err := ValidateManifest("test.yaml", []byte(test.input))
+		assert.Nil(t, err, "unexpected error for %s", test.name)
+
+		actual := make([]string, 0)
+		for _, problem := range problems {
+			actual = append(actual, problem.String())
+		}
+
+		assert.Equal(t, test.expectValues, actual, "unexpected problems for %s", test.name)
+	}
+}
+
+func TestValidateStacks(t *testing.T) {
+	input := `
+dev:
+  provider: aws
+  manifests:
+  - uri: manifests/10-core.yaml
+    remove: "yes"
+`
+
+	problems, err := ValidateStacks("stacks.yaml", []byte(input))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(problems))
+	assert.Equal(t, "stacks.yaml:6:5: 'dev.manifests[0].remove' should be a "+
+		"boolean but is a string", problems[0].String())
+}
+
+func TestValidateMetadata(t *testing.T) {
+	input := `
+implements:
+- ansible
+secrets:
+- name: my-token
+  default: abc
+env_vars:
+- description: no name
+`
+
+	problems, err := ValidateMetadata("sugarkube.yaml", []byte(input))
+	assert.Nil(t, err)
+
+	actual := make([]string, 0)
+	for _, problem := range problems {
+		actual = append(actual, problem.String())
+	}
+
+	assert.Equal(t, []string{
+		"sugarkube.yaml:3:1: 'implements[0]' should be one of 'helm', 'terraform', 'k8s' but is 'ansible'",
+		"sugarkube.yaml:5:3: 'secrets[0].name' should match '^[A-Za-z_][A-Za-z0-9_]*$' but is 'my-token'",
+		"sugarkube.yaml:6:3: unknown key 'default' in 'secrets[0]'",
+		"sugarkube.yaml:8:1: 'env_vars[0]' is missing required key 'name'",
+	}, actual)
+}
+
+func TestClosestMatch(t *testing.T) {
+	candidates := []string{"sources", "when", "template", "namespace", "params"}
+
+	assert.Equal(t, "sources", closestMatch("source", candidates))
+	assert.Equal(t, "template", closestMatch("tempalte", candidates))
+	assert.Equal(t, "", closestMatch("installer", candidates))
+}
@@ -0,0 +1,354 @@
+package schema
+
+// JSON schemas for manifests, stack config files and kapp metadata. These are published in
+// the `schemas` directory at the root of the repo so editors can use them to
+// validate files, and must be kept in sync with them.
+
+const MANIFEST_SCHEMA = `{
+  "$schema": "http://json-schema.org/draft-07/schema#",
+  "$id": "https://sugarkube.io/schemas/manifest.schema.json",
+  "title": "Sugarkube manifest",
+  "type": "object",
+  "additionalProperties": false,
+  "properties": {
+    "templates": {
+      "description": "Kapp definitions that kapps can create instances of with 'template'",
+      "type": "object",
+      "additionalProperties": {"$ref": "#/definitions/kapp"}
+    },
+    "present": {
+      "description": "Kapps that should be installed",
+      "type": "object",
+      "additionalProperties": {"$ref": "#/definitions/kapp"}
+    },
+    "absent": {
+      "description": "Kapps that should be deleted",
+      "type": "object",
+      "additionalProperties": {"$ref": "#/definitions/kapp"}
+    },
+    "ignored": {
+      "description": "IDs of kapps that sugarkube must never install or delete",
+      "type": "array",
+      "items": {"type": "string"}
+    },
+    "hooks": {"$ref": "#/definitions/hooks"}
+  },
+  "definitions": {
+    "kapp": {
+      "type": "object",
+      "additionalProperties": false,
+      "properties": {
+        "sources": {
+          "type": "array",
+          "items": {"$ref": "#/definitions/source"}
+        },
+        "when": {
+          "description": "Condition that must be true for the kapp to be included in a plan",
+          "type": "string"
+        },
+        "template": {
+          "description": "Name of a template to create an instance of",
+          "type": "string"
+        },
+        "namespace": {
+          "type": "string"
+        },
+        "labels": {
+          "description": "Labels the kapp can be selected by with e.g. '--include label=db'",
+          "type": "array",
+          "items": {"type": "string"}
+        },
+        "depends_on": {
+          "description": "Kapps this kapp needs, e.g. 'data:postgres', selected along with it by '--with-dependencies'",
+          "type": "array",
+          "items": {"type": "string"}
+        },
+        "params": {
+          "description": "Parameters passed to the installer as env vars",
+          "type": "object",
+          "additionalProperties": {"type": ["string", "number", "boolean"]}
+        },
+        "installer": {
+          "description": "Settings for how the installer runs the kapp",
+          "type": "object",
+          "additionalProperties": false,
+          "properties": {
+            "timeout": {
+              "description": "How long each attempt can take, e.g. '45m'",
+              "type": "string"
+            },
+            "retries": {
+              "description": "How many times to retry after a failed attempt",
+              "type": "integer",
+              "minimum": 0
+            },
+            "backoff": {
+              "description": "Delay before the first retry, doubled for each retry after it, e.g. '30s'",
+              "type": "string"
+            },
+            "hooks": {"$ref": "#/definitions/hooks"}
+          }
+        }
+      }
+    },
+    "source": {
+      "type": "object",
+      "additionalProperties": false,
+      "required": ["uri", "path"],
+      "properties": {
+        "acquirer": {"type": "string", "enum": ["git"]},
+        "uri": {"type": "string"},
+        "branch": {"type": "string"},
+        "version": {
+          "description": "Version constraint used to select a tag, e.g. 'wordpress-~0.1'",
+          "type": "string"
+        },
+        "path": {"type": "string"},
+        "name": {"type": "string"}
+      }
+    },
+    "hooks": {
+      "description": "Commands or make targets to run before and after kapps are installed or destroyed",
+      "type": "object",
+      "additionalProperties": false,
+      "properties": {
+        "pre_install": {"$ref": "#/definitions/hookList"},
+        "post_install": {"$ref": "#/definitions/hookList"},
+        "pre_destroy": {"$ref": "#/definitions/hookList"},
+        "post_destroy": {"$ref": "#/definitions/hookList"},
+        "on_failure": {"$ref": "#/definitions/hookList"}
+      }
+    },
+    "hookList": {
+      "type": "array",
+      "items": {"$ref": "#/definitions/hook"}
+    },
+    "hook": {
+      "type": "object",
+      "description": "Either a command or a make target to run",
+      "additionalProperties": false,
+      "properties": {
+        "command": {
+          "description": "Shell command to run",
+          "type": "string"
+        },
+        "target": {
+          "description": "Make target to run",
+          "type": "string"
+        },
+        "on_error": {
+          "description": "Whether a failure of the hook fails what it was run for, or is only logged",
+          "type": "string",
+          "enum": ["fail", "continue"]
+        },
+        "on_plan": {
+          "description": "Also run the hook when changes are only planned (APPROVED=false)",
+          "type": "boolean"
+        }
+      }
+    }
+  }
+}
+`
+
+const STACKS_SCHEMA = `{
+  "$schema": "http://json-schema.org/draft-07/schema#",
+  "$id": "https://sugarkube.io/schemas/stacks.schema.json",
+  "title": "Sugarkube stack config",
+  "type": "object",
+  "additionalProperties": {"$ref": "#/definitions/stack"},
+  "definitions": {
+    "stack": {
+      "type": "object",
+      "additionalProperties": false,
+      "properties": {
+        "extends": {
+          "description": "Name of a stack in the same file to inherit settings from",
+          "type": "string"
+        },
+        "provider": {"type": "string"},
+        "provisioner": {"type": "string"},
+        "sot": {
+          "description": "Source of truth to query for the kapps installed in the cluster. Defaults to 'helm'",
+          "type": "string",
+          "enum": ["helm"]
+        },
+        "account": {"type": "string"},
+        "profile": {"type": "string"},
+        "cluster": {"type": "string"},
+        "region": {"type": "string"},
+        "onlinetimeout": {"type": "number"},
+        "readytimeout": {"type": "number"},
+        "vars": {
+          "description": "Paths to directories to load vars from",
+          "type": "array",
+          "items": {"type": "string"}
+        },
+        "manifests": {
+          "type": "array",
+          "items": {"$ref": "#/definitions/manifest"}
+        },
+        "ignored": {
+          "description": "Kapps that sugarkube must never install or delete, e.g. 'web:wordpress'",
+          "type": "array",
+          "items": {"type": "string"}
+        },
+        "hooks": {"$ref": "#/definitions/hooks"}
+      }
+    },
+    "manifest": {
+      "type": "object",
+      "additionalProperties": false,
+      "properties": {
+        "uri": {"type": "string"},
+        "id": {"type": "string"},
+        "when": {
+          "description": "Condition that must be true for the manifest's kapps to be included in a plan",
+          "type": "string"
+        },
+        "remove": {
+          "description": "Remove the manifest with this ID inherited from an extended stack",
+          "type": "boolean"
+        },
+        "max_parallel": {
+          "description": "Maximum number of the manifest's kapps to process at once",
+          "type": "integer",
+          "minimum": 0
+        },
+        "serial": {
+          "description": "Process the manifest's kapps one at a time",
+          "type": "boolean"
+        }
+      }
+    },
+    "hooks": {
+      "description": "Commands or make targets to run before and after kapps are installed or destroyed",
+      "type": "object",
+      "additionalProperties": false,
+      "properties": {
+        "pre_install": {"$ref": "#/definitions/hookList"},
+        "post_install": {"$ref": "#/definitions/hookList"},
+        "pre_destroy": {"$ref": "#/definitions/hookList"},
+        "post_destroy": {"$ref": "#/definitions/hookList"},
+        "on_failure": {"$ref": "#/definitions/hookList"}
+      }
+    },
+    "hookList": {
+      "type": "array",
+      "items": {"$ref": "#/definitions/hook"}
+    },
+    "hook": {
+      "type": "object",
+      "description": "Either a command or a make target to run",
+      "additionalProperties": false,
+      "properties": {
+        "command": {
+          "description": "Shell command to run",
+          "type": "string"
+        },
+        "target": {
+          "description": "Make target to run",
+          "type": "string"
+        },
+        "on_error": {
+          "description": "Whether a failure of the hook fails what it was run for, or is only logged",
+          "type": "string",
+          "enum": ["fail", "continue"]
+        },
+        "on_plan": {
+          "description": "Also run the hook when changes are only planned (APPROVED=false)",
+          "type": "boolean"
+        }
+      }
+    }
+  }
+}
+`
+
+const METADATA_SCHEMA = `{
+  "$schema": "http://json-schema.org/draft-07/schema#",
+  "$id": "https://sugarkube.io/schemas/metadata.schema.json",
+  "title": "Sugarkube kapp metadata (sugarkube.yaml)",
+  "type": "object",
+  "additionalProperties": false,
+  "properties": {
+    "description": {"type": "string"},
+    "implements": {
+      "description": "Types of kapp. If given they're used instead of heuristics",
+      "type": "array",
+      "items": {
+        "type": "string",
+        "enum": ["helm", "terraform", "k8s"]
+      }
+    },
+    "secrets": {
+      "description": "Env vars that must be set when the kapp is installed",
+      "type": "array",
+      "items": {"$ref": "#/definitions/secret"}
+    },
+    "env_vars": {
+      "description": "Other env vars to pass to the kapp",
+      "type": "array",
+      "items": {"$ref": "#/definitions/env_var"}
+    }
+  },
+  "definitions": {
+    "name": {
+      "type": "string",
+      "pattern": "^[A-Za-z_][A-Za-z0-9_]*$"
+    },
+    "secret": {
+      "type": "object",
+      "description": "Secrets can't have defaults",
+      "additionalProperties": false,
+      "required": ["name"],
+      "properties": {
+        "name": {"$ref": "#/definitions/name"},
+        "description": {"type": "string"},
+        "optional": {
+          "description": "Don't fail if the env var isn't set",
+          "type": "boolean"
+        }
+      }
+    },
+    "env_var": {
+      "type": "object",
+      "additionalProperties": false,
+      "required": ["name"],
+      "properties": {
+        "name": {"$ref": "#/definitions/name"},
+        "description": {"type": "string"},
+        "default": {
+          "description": "Value to use if the env var isn't set",
+          "type": "string"
+        },
+        "optional": {
+          "description": "Don't fail if the env var isn't set",
+          "type": "boolean"
+        }
+      }
+    }
+  }
+}
+`
+
+// Validates a manifest against the manifest schema
+func ValidateManifest(file string, data []byte) ([]Problem, error) {
+	return Validate(MANIFEST_SCHEMA, file, data)
+}
+
+// Validates a stack config file against the stacks schema
+func ValidateStacks(file string, data []byte) ([]Problem, error) {
+	return Validate(STACKS_SCHEMA, file, data)
+}
+
+// Validates a kapp's metadata (sugarkube.yaml) against the metadata schema
+func ValidateMetadata(file string, data []byte) ([]Problem, error) {
+	return Validate(METADATA_SCHEMA, file, data)
+}
+
+// Validates a manifest overlay against the manifest schema. Overlays may omit
+// required settings.
+func ValidateManifestOverlay(file string, data []byte) ([]Problem, error) {
+	return validateDocument(MANIFEST_SCHEMA, file, data, true)
+}
@@ -0,0 +1,430 @@
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Validates YAML documents against the subset of JSON schema used by the
+// schemas in this package: `type`, `properties`, `additionalProperties`,
+// `required`, `items`, `enum`, `pattern` and local `$ref`s.
+
+// A problem found in a document
+type Problem struct {
+	File     string
+	Position Position
+	// path to the offending value, e.g. `present.wordpress.sources[0]`
+	Path    string
+	Message string
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("%s:%d:%d: %s", p.File, p.Position.Line,
+		p.Position.Column, p.Message)
+}
+
+// Returns an error listing problems, or nil if there aren't any
+func ProblemsError(problems []Problem) error {
+	if len(problems) == 0 {
+		return nil
+	}
+
+	lines := make([]string, 0)
+	for _, problem := range problems {
+		lines = append(lines, problem.String())
+	}
+
+	return errors.New(strings.Join(lines, "\n"))
+}
+
+type schemaNode struct {
+	Ref                  string                 `json:"$ref"`
+	Type                 interface{}            `json:"type"`
+	Properties           map[string]*schemaNode `json:"properties"`
+	AdditionalProperties interface{}            `json:"additionalProperties"`
+	Required             []string               `json:"required"`
+	Items                *schemaNode            `json:"items"`
+	Enum                 []interface{}          `json:"enum"`
+	Pattern              string                 `json:"pattern"`
+	Definitions          map[string]*schemaNode `json:"definitions"`
+}
+
+type validator struct {
+	root      *schemaNode
+	file      string
+	positions map[string]Position
+	problems  []Problem
+	// overlays only contain the settings they change so required keys may
+	// be missing
+	ignoreRequired bool
+}
+
+var yamlLineRegex = regexp.MustCompile(`^yaml: line (\d+): (.*)$`)
+
+// Validates a YAML document against a JSON schema. Problems with the document
+// are returned. An error is only returned if the schema is invalid.
+func Validate(schema string, file string, data []byte) ([]Problem, error) {
+	return validateDocument(schema, file, data, false)
+}
+
+func validateDocument(schema string, file string, data []byte,
+	ignoreRequired bool) ([]Problem, error) {
+	root := &schemaNode{}
+	err := json.Unmarshal([]byte(schema), root)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error parsing schema")
+	}
+
+	v := &validator{
+		root:      root,
+		file:      file,
+		positions: indexPositions(data),
+		problems:  make([]Problem, 0),
+
+		ignoreRequired: ignoreRequired,
+	}
+
+	var document interface{}
+	err = yaml.Unmarshal(data, &document)
+	if err != nil {
+		// make YAML syntax errors look like other problems
+		position := Position{Line: 1, Column: 1}
+		message := err.Error()
+		if matches := yamlLineRegex.FindStringSubmatch(message); matches != nil {
+			position.Line, _ = strconv.Atoi(matches[1])
+			message = matches[2]
+		}
+
+		return []Problem{{
+			File:     file,
+			Position: position,
+			Message:  message,
+		}}, nil
+	}
+
+	if document == nil {
+		document = map[interface{}]interface{}{}
+	}
+
+	err = v.validate(root, document, "")
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	sort.SliceStable(v.problems, func(i, j int) bool {
+		left, right := v.problems[i].Position, v.problems[j].Position
+		return left.Line < right.Line || (left.Line == right.Line && left.Column < right.Column)
+	})
+
+	return v.problems, nil
+}
+
+func (v *validator) report(path string, format string, args ...interface{}) {
+	v.problems = append(v.problems, Problem{
+		File:     v.file,
+		Position: lookupPosition(v.positions, path),
+		Path:     path,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+func (v *validator) resolve(node *schemaNode) (*schemaNode, error) {
+	for node.Ref != "" {
+		name := strings.TrimPrefix(node.Ref, "#/definitions/")
+		definition, ok := v.root.Definitions[name]
+		if !ok {
+			return nil, errors.New(fmt.Sprintf("Unresolvable schema reference: %s",
+				node.Ref))
+		}
+		node = definition
+	}
+
+	return node, nil
+}
+
+func (v *validator) validate(node *schemaNode, value interface{}, path string) error {
+	node, err := v.resolve(node)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	valueType := typeOf(value)
+	if !node.allowsType(valueType) {
+		v.report(path, "%s should be %s but is %s", describePath(path),
+			node.describeType(), withArticle(valueType))
+		return nil
+	}
+
+	if len(node.Enum) > 0 && !inEnum(node.Enum, value) {
+		v.report(path, "%s should be one of %s but is '%v'", describePath(path),
+			describeEnum(node.Enum), value)
+	}
+
+	if str, ok := value.(string); ok && node.Pattern != "" {
+		pattern, err := regexp.Compile(node.Pattern)
+		if err != nil {
+			return errors.Wrapf(err, "Invalid pattern in schema: %s", node.Pattern)
+		}
+		if !pattern.MatchString(str) {
+			v.report(path, "%s should match '%s' but is '%s'", describePath(path),
+				node.Pattern, str)
+		}
+	}
+
+	switch typed := value.(type) {
+	case map[interface{}]interface{}:
+		return v.validateObject(node, typed, path)
+	case []interface{}:
+		if node.Items == nil {
+			return nil
+		}
+		for i, item := range typed {
+			err := v.validate(node.Items, item, path+"["+strconv.Itoa(i)+"]")
+			if err != nil {
+				return errors.WithStack(err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (v *validator) validateObject(node *schemaNode, value map[interface{}]interface{},
+	path string) error {
+
+	keys := make([]string, 0)
+	for key := range value {
+		keyStr, ok := key.(string)
+		if !ok {
+			v.report(path, "%s has a key that isn't a string: %v",
+				describePath(path), key)
+			continue
+		}
+		keys = append(keys, keyStr)
+	}
+	sort.Strings(keys)
+
+	if !v.ignoreRequired {
+		for _, required := range node.Required {
+			if _, ok := value[required]; !ok {
+				v.report(path, "%s is missing required key '%s'", describePath(path),
+					required)
+			}
+		}
+	}
+
+	for _, key := range keys {
+		childPath := key
+		if path != "" {
+			childPath = path + "." + key
+		}
+
+		if property, ok := node.Properties[key]; ok {
+			err := v.validate(property, value[key], childPath)
+			if err != nil {
+				return errors.WithStack(err)
+			}
+			continue
+		}
+
+		switch additional := node.AdditionalProperties.(type) {
+		case bool:
+			if !additional {
+				message := fmt.Sprintf("unknown key '%s' in %s", key, describePath(path))
+				if suggestion := closestMatch(key, node.propertyNames()); suggestion != "" {
+					message += fmt.Sprintf(". Did you mean '%s'?", suggestion)
+				}
+				v.report(childPath, "%s", message)
+			}
+		case map[string]interface{}:
+			// decode the schema for additional properties
+			encoded, err := json.Marshal(additional)
+			if err != nil {
+				return errors.WithStack(err)
+			}
+			additionalNode := &schemaNode{}
+			err = json.Unmarshal(encoded, additionalNode)
+			if err != nil {
+				return errors.WithStack(err)
+			}
+
+			err = v.validate(additionalNode, value[key], childPath)
+			if err != nil {
+				return errors.WithStack(err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (n *schemaNode) types() []string {
+	switch typed := n.Type.(type) {
+	case string:
+		return []string{typed}
+	case []interface{}:
+		types := make([]string, 0)
+		for _, t := range typed {
+			types = append(types, fmt.Sprintf("%v", t))
+		}
+		return types
+	}
+
+	return []string{}
+}
+
+func (n *schemaNode) allowsType(valueType string) bool {
+	types := n.types()
+	if len(types) == 0 {
+		return true
+	}
+
+	for _, t := range types {
+		if t == valueType || (t == "number" && valueType == "integer") {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (n *schemaNode) describeType() string {
+	described := make([]string, 0)
+	for _, t := range n.types() {
+		described = append(described, withArticle(t))
+	}
+
+	return strings.Join(described, " or ")
+}
+
+func (n *schemaNode) propertyNames() []string {
+	names := make([]string, 0)
+	for name := range n.Properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Returns the JSON schema type of a value parsed from YAML
+func typeOf(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case int, int64, uint64:
+		return "integer"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[interface{}]interface{}:
+		return "object"
+	}
+
+	return fmt.Sprintf("%T", value)
+}
+
+func withArticle(jsonType string) string {
+	switch jsonType {
+	case "object":
+		return "a map"
+	case "array":
+		return "a list"
+	case "integer":
+		return "an integer"
+	case "null":
+		return "empty"
+	}
+
+	return "a " + jsonType
+}
+
+func describePath(path string) string {
+	if path == "" {
+		return "the document"
+	}
+
+	return "'" + path + "'"
+}
+
+func inEnum(enum []interface{}, value interface{}) bool {
+	for _, allowed := range enum {
+		if fmt.Sprintf("%v", allowed) == fmt.Sprintf("%v", value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func describeEnum(enum []interface{}) string {
+	values := make([]string, 0)
+	for _, allowed := range enum {
+		values = append(values, fmt.Sprintf("'%v'", allowed))
+	}
+
+	return strings.Join(values, ", ")
+}
+
+// Returns the candidate closest to the input if it's a plausible typo
+func closestMatch(input string, candidates []string) string {
+	best := ""
+	bestDistance := len(input)/3 + 2
+
+	for _, candidate := range candidates {
+		distance := levenshtein(strings.ToLower(input), strings.ToLower(candidate))
+		if distance < bestDistance {
+			best = candidate
+			bestDistance = distance
+		}
+	}
+
+	return best
+}
+
+// Returns the edit distance between two strings
+func levenshtein(a string, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+
+			current[j] = minInt(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+
+	return previous[len(b)]
+}
+
+func minInt(values ...int) int {
+	result := values[0]
+	for _, value := range values[1:] {
+		if value < result {
+			result = value
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,259 @@
+package semver
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"strconv"
+	"strings"
+)
+
+// Minimal semantic versioning support for resolving kapp version constraints
+// against git tags.
+
+type Version struct {
+	Major      int
+	Minor      int
+	Patch      int
+	Prerelease string
+}
+
+// Parses a version like `1.2.3`, `v1.2` or `1.2.3-rc1`. Missing minor/patch
+// components default to 0.
+func Parse(input string) (Version, error) {
+	version := Version{}
+
+	input = strings.TrimPrefix(input, "v")
+	if input == "" {
+		return version, errors.New("Empty version")
+	}
+
+	if i := strings.Index(input, "-"); i >= 0 {
+		version.Prerelease = input[i+1:]
+		input = input[:i]
+	}
+
+	parts := strings.Split(input, ".")
+	if len(parts) > 3 {
+		return version, errors.New(fmt.Sprintf("Invalid version '%s'", input))
+	}
+
+	components := []*int{&version.Major, &version.Minor, &version.Patch}
+	for i, part := range parts {
+		number, err := strconv.Atoi(part)
+		if err != nil || number < 0 {
+			return version, errors.New(fmt.Sprintf("Invalid version '%s'", input))
+		}
+		*components[i] = number
+	}
+
+	return version, nil
+}
+
+// Returns -1, 0 or 1 if v is less than, equal to or greater than other.
+// Prerelease versions sort before their release.
+func (v Version) Compare(other Version) int {
+	pairs := [][2]int{
+		{v.Major, other.Major},
+		{v.Minor, other.Minor},
+		{v.Patch, other.Patch},
+	}
+
+	for _, pair := range pairs {
+		if pair[0] < pair[1] {
+			return -1
+		}
+		if pair[0] > pair[1] {
+			return 1
+		}
+	}
+
+	switch {
+	case v.Prerelease == other.Prerelease:
+		return 0
+	case v.Prerelease == "":
+		return 1
+	case other.Prerelease == "":
+		return -1
+	case v.Prerelease < other.Prerelease:
+		return -1
+	}
+
+	return 1
+}
+
+func (v Version) String() string {
+	version := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if v.Prerelease != "" {
+		version = version + "-" + v.Prerelease
+	}
+	return version
+}
+
+// A single comparison, e.g. `>=1.2.0`
+type comparison struct {
+	operator string
+	version  Version
+}
+
+// A set of comparisons that must all be satisfied
+type Constraint struct {
+	raw         string
+	comparisons []comparison
+}
+
+// Returns true if the string looks like a constraint rather than a version
+func IsConstraint(input string) bool {
+	return strings.ContainsAny(input, "~^<>=*xX, ")
+}
+
+// Parses a constraint. Supported forms are:
+//   * `1.2.3` or `=1.2.3` - exactly that version
+//   * `~1.2` or `~1.2.3` - at least that version but with the same minor version
+//   * `~1` - any version with the same major version
+//   * `^1.2.3` - at least that version but with the same major version (or
+//     minor version for 0.x versions)
+//   * `1.2.x`, `1.x`, `*` - wildcards
+//   * `>`, `>=`, `<`, `<=` - comparisons
+// Multiple constraints can be separated with commas or spaces, in which case
+// all of them must be satisfied.
+func ParseConstraint(input string) (Constraint, error) {
+	constraint := Constraint{raw: input}
+
+	fields := strings.FieldsFunc(input, func(r rune) bool {
+		return r == ',' || r == ' '
+	})
+
+	if len(fields) == 0 {
+		return constraint, errors.New("Empty version constraint")
+	}
+
+	for _, field := range fields {
+		comparisons, err := parseComparisons(field)
+		if err != nil {
+			return constraint, errors.Wrapf(err, "Invalid version constraint '%s'", input)
+		}
+		constraint.comparisons = append(constraint.comparisons, comparisons...)
+	}
+
+	return constraint, nil
+}
+
+func parseComparisons(field string) ([]comparison, error) {
+	for _, operator := range []string{">=", "<=", ">", "<", "="} {
+		if strings.HasPrefix(field, operator) {
+			version, err := Parse(strings.TrimPrefix(field, operator))
+			if err != nil {
+				return nil, err
+			}
+			return []comparison{{operator: operator, version: version}}, nil
+		}
+	}
+
+	if field == "*" || field == "x" || field == "X" {
+		return []comparison{}, nil
+	}
+
+	if strings.HasPrefix(field, "~") || strings.HasPrefix(field, "^") {
+		raw := field[1:]
+		lower, err := Parse(raw)
+		if err != nil {
+			return nil, err
+		}
+
+		numComponents := len(strings.Split(strings.SplitN(strings.TrimPrefix(raw, "v"), "-", 2)[0], "."))
+
+		var upper Version
+		if field[0] == '~' {
+			if numComponents == 1 {
+				upper = Version{Major: lower.Major + 1}
+			} else {
+				upper = Version{Major: lower.Major, Minor: lower.Minor + 1}
+			}
+		} else {
+			switch {
+			case lower.Major > 0 || numComponents == 1:
+				upper = Version{Major: lower.Major + 1}
+			case lower.Minor > 0 || numComponents == 2:
+				upper = Version{Minor: lower.Minor + 1}
+			default:
+				upper = Version{Patch: lower.Patch + 1}
+			}
+		}
+
+		return []comparison{
+			{operator: ">=", version: lower},
+			{operator: "<", version: upper},
+		}, nil
+	}
+
+	// wildcards, e.g. 1.2.x
+	parts := strings.Split(strings.TrimPrefix(field, "v"), ".")
+	for i, part := range parts {
+		if part == "x" || part == "X" || part == "*" {
+			lower, err := Parse(strings.Join(parts[:i], "."))
+			if i == 0 || err != nil {
+				return nil, errors.New(fmt.Sprintf("Invalid wildcard '%s'", field))
+			}
+
+			upper := Version{Major: lower.Major + 1}
+			if i == 2 {
+				upper = Version{Major: lower.Major, Minor: lower.Minor + 1}
+			}
+
+			return []comparison{
+				{operator: ">=", version: lower},
+				{operator: "<", version: upper},
+			}, nil
+		}
+	}
+
+	version, err := Parse(field)
+	if err != nil {
+		return nil, err
+	}
+	return []comparison{{operator: "=", version: version}}, nil
+}
+
+// Returns whether a version satisfies the constraint. Prerelease versions
+// only match constraints that explicitly name them.
+func (c Constraint) Check(version Version) bool {
+	if version.Prerelease != "" {
+		explicit := false
+		for _, comparison := range c.comparisons {
+			if comparison.version.Prerelease != "" {
+				explicit = true
+			}
+		}
+		if !explicit {
+			return false
+		}
+	}
+
+	for _, comparison := range c.comparisons {
+		result := version.Compare(comparison.version)
+
+		var ok bool
+		switch comparison.operator {
+		case "=":
+			ok = result == 0
+		case ">":
+			ok = result > 0
+		case ">=":
+			ok = result >= 0
+		case "<":
+			ok = result < 0
+		case "<=":
+			ok = result <= 0
+		}
+
+		if !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (c Constraint) String() string {
+	return c.raw
+}
@@ -0,0 +1,127 @@
+package semver
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name          string
+		desc          string
+		input         string
+		expectValue   Version
+		expectedError bool
+	}{
+		{
+			name:        "good_full",
+			desc:        "check full versions are parsed",
+			input:       "1.2.3",
+			expectValue: Version{Major: 1, Minor: 2, Patch: 3},
+		},
+		{
+			name:        "good_partial_prefixed",
+			desc:        "check partial versions with a 'v' prefix are parsed",
+			input:       "v0.1",
+			expectValue: Version{Major: 0, Minor: 1},
+		},
+		{
+			name:        "good_prerelease",
+			desc:        "check prerelease versions are parsed",
+			input:       "2.0.0-rc1",
+			expectValue: Version{Major: 2, Prerelease: "rc1"},
+		},
+		{
+			name:          "error_garbage",
+			desc:          "check invalid versions cause errors",
+			input:         "master",
+			expectedError: true,
+		},
+		{
+			name:          "error_too_many_components",
+			desc:          "check versions with too many components cause errors",
+			input:         "1.2.3.4",
+			expectedError: true,
+		},
+	}
+
+	for _, test := range tests {
+		result, err := Parse(test.input)
+		if test.expectedError {
+			assert.NotNil(t, err, "expected an error for %s", test.name)
+		} else {
+			assert.Nil(t, err)
+			assert.Equal(t, test.expectValue, result, "unexpected result for %s", test.name)
+		}
+	}
+}
+
+func TestConstraintCheck(t *testing.T) {
+	tests := []struct {
+		name       string
+		desc       string
+		constraint string
+		matches    []string
+		nonMatches []string
+	}{
+		{
+			name:       "tilde_minor",
+			desc:       "check ~ with a minor version allows patch bumps",
+			constraint: "~0.1",
+			matches:    []string{"0.1.0", "0.1.9"},
+			nonMatches: []string{"0.2.0", "0.0.9", "0.1.1-rc1"},
+		},
+		{
+			name:       "tilde_major",
+			desc:       "check ~ with only a major version allows minor bumps",
+			constraint: "~1",
+			matches:    []string{"1.0.0", "1.9.0"},
+			nonMatches: []string{"2.0.0"},
+		},
+		{
+			name:       "caret",
+			desc:       "check ^ allows minor bumps for non-zero major versions",
+			constraint: "^1.2.3",
+			matches:    []string{"1.2.3", "1.9.0"},
+			nonMatches: []string{"1.2.2", "2.0.0"},
+		},
+		{
+			name:       "caret_zero",
+			desc:       "check ^ only allows patch bumps for 0.x versions",
+			constraint: "^0.2.3",
+			matches:    []string{"0.2.3", "0.2.9"},
+			nonMatches: []string{"0.3.0"},
+		},
+		{
+			name:       "wildcard",
+			desc:       "check wildcards work",
+			constraint: "1.2.x",
+			matches:    []string{"1.2.0", "1.2.7"},
+			nonMatches: []string{"1.3.0"},
+		},
+		{
+			name:       "range",
+			desc:       "check multiple comparisons are ANDed",
+			constraint: ">=1.0, <1.5",
+			matches:    []string{"1.0.0", "1.4.9"},
+			nonMatches: []string{"0.9.0", "1.5.0"},
+		},
+	}
+
+	for _, test := range tests {
+		constraint, err := ParseConstraint(test.constraint)
+		assert.Nil(t, err)
+
+		for _, input := range test.matches {
+			version, err := Parse(input)
+			assert.Nil(t, err)
+			assert.True(t, constraint.Check(version), "%s should match %s", input, test.constraint)
+		}
+
+		for _, input := range test.nonMatches {
+			version, err := Parse(input)
+			assert.Nil(t, err)
+			assert.False(t, constraint.Check(version), "%s shouldn't match %s", input, test.constraint)
+		}
+	}
+}
@@ -1,12 +1,162 @@
 package sot
 
-// Uses Helm to determine which kapps are already installed in a target cluster
-type HelmSot struct{}
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/sugarkube/sugarkube/internal/pkg/kapp"
+	"github.com/sugarkube/sugarkube/internal/pkg/log"
+	"github.com/sugarkube/sugarkube/internal/pkg/provider"
+	"os/exec"
+	"strings"
+)
 
-func (s HelmSot) refresh() error {
-	panic("not implemented")
+// Uses Helm to determine which kapps are already installed in a target
+// cluster. Kapps are installed as releases named after their IDs in their
+// namespaces, and releases report the chart version, e.g. `wordpress-0.1.0`.
+type HelmSot struct {
+	unmanagedKapps
+	providerImpl provider.Provider
+	// the namespace each kapp is installed into keyed by fully qualified ID
+	namespaces map[string]string
+	// chart versions keyed by release key. Nil until refreshed.
+	releases map[string]string
+	// returns a page of `helm list` output starting at an offset. Runs helm
+	// if nil.
+	list func(offset string) ([]byte, error)
 }
 
-func (s HelmSot) isInstalled(name string, version string) (bool, error) {
-	panic("not implemented")
+// todo - make configurable
+const HELM_PATH = "helm"
+const KUBE_CONTEXT_KEY = "kube_context"
+
+// Output of `helm list --output json`. Helm only returns a page of releases
+// at a time, and sets Next to the offset of the next page if there are more.
+type helmList struct {
+	Next     string
+	Releases []struct {
+		Name      string
+		Chart     string
+		Status    string
+		Namespace string
+	}
+}
+
+// Releases are only unique within a namespace
+func releaseKey(namespace string, name string) string {
+	return namespace + "/" + name
+}
+
+// Runs `helm list` for a page of releases
+func (s *HelmSot) helmList(offset string) ([]byte, error) {
+	var stdoutBuf, stderrBuf bytes.Buffer
+
+	args := []string{"list", "--output", "json"}
+
+	if offset != "" {
+		args = append(args, "--offset", offset)
+	}
+
+	providerVars := provider.GetVars(s.providerImpl)
+	if kubeContext, ok := providerVars[KUBE_CONTEXT_KEY].(string); ok {
+		args = append(args, "--kube-context", kubeContext)
+	}
+
+	listCmd := exec.Command(HELM_PATH, args...)
+	listCmd.Stdout = &stdoutBuf
+	listCmd.Stderr = &stderrBuf
+	err := listCmd.Run()
+	if err != nil {
+		return nil, errors.Wrapf(err, "Error running: %s. Stderr=%s",
+			strings.Join(listCmd.Args, " "), stderrBuf.String())
+	}
+
+	return stdoutBuf.Bytes(), nil
+}
+
+// Lists every page of releases so large clusters aren't under-reported
+func (s *HelmSot) refresh() error {
+	list := s.list
+	if list == nil {
+		list = s.helmList
+	}
+
+	releases := map[string]string{}
+	offset := ""
+
+	for {
+		data, err := list(offset)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		page, next, err := parseHelmList(data)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		for key, version := range page {
+			releases[key] = version
+		}
+
+		if next == "" {
+			break
+		}
+
+		if next == offset {
+			return errors.New(fmt.Sprintf("Helm returned the same page of "+
+				"releases twice at offset '%s'", offset))
+		}
+
+		offset = next
+	}
+
+	log.Debugf("Helm reports %d installed release(s)", len(releases))
+
+	s.releases = releases
+
+	return nil
+}
+
+// Parses a page of `helm list` output into a map of chart versions keyed by
+// release key, and returns the offset of the next page if there is one.
+// Failed releases count as installed so they get upgraded.
+func parseHelmList(data []byte) (map[string]string, string, error) {
+	releases := map[string]string{}
+
+	// helm prints nothing at all if there are no releases
+	if len(bytes.TrimSpace(data)) == 0 {
+		return releases, "", nil
+	}
+
+	list := helmList{}
+	err := json.Unmarshal(data, &list)
+	if err != nil {
+		return nil, "", errors.Wrapf(err, "Error parsing helm output: %s", data)
+	}
+
+	for _, release := range list.Releases {
+		releases[releaseKey(release.Namespace, release.Name)] = release.Chart
+	}
+
+	return releases, list.Next, nil
+}
+
+func (s *HelmSot) installedVersion(fullyQualifiedId string) (string, bool, error) {
+	if s.releases == nil {
+		return "", false, errors.New(fmt.Sprintf("The %s SOT needs "+
+			"refreshing before use", HELM))
+	}
+
+	// releases are named after kapp IDs and installed into their namespaces
+	_, kappId := kapp.SplitKappRef(fullyQualifiedId)
+
+	namespace, ok := s.namespaces[fullyQualifiedId]
+	if !ok {
+		namespace = kappId
+	}
+
+	version, ok := s.releases[releaseKey(namespace, kappId)]
+	return version, ok, nil
 }
@@ -1,6 +1,85 @@
 package sot
 
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/sugarkube/sugarkube/internal/pkg/kapp"
+	"github.com/sugarkube/sugarkube/internal/pkg/provider"
+)
+
+// Kapps are identified by their fully qualified IDs (`<manifest>:<kapp>`)
 type Sot interface {
 	refresh() error
-	isInstalled(name string, version string) (bool, error)
+	// Returns the version of a kapp installed in the target cluster, and
+	// whether it's installed at all
+	installedVersion(fullyQualifiedId string) (string, bool, error)
+	isManaged(fullyQualifiedId string) bool
+}
+
+// implemented SOTs
+const HELM = "helm"
+
+// Factory that creates SOTs. Kapps ignored by the stack are unmanaged, so SOTs
+// won't report whether they're installed.
+func NewSot(name string, stackConfig *kapp.StackConfig,
+	providerImpl provider.Provider) (Sot, error) {
+	unmanaged := unmanagedKapps{}
+	namespaces := map[string]string{}
+
+	for _, manifest := range stackConfig.Manifests {
+		for _, kappObj := range manifest.Kapps {
+			if stackConfig.IsIgnored(kappObj) {
+				unmanaged[kappObj.FullyQualifiedId()] = true
+			}
+			namespaces[kappObj.FullyQualifiedId()] = kappObj.Namespace()
+		}
+	}
+
+	if name == HELM {
+		return &HelmSot{
+			unmanagedKapps: unmanaged,
+			providerImpl:   providerImpl,
+			namespaces:     namespaces,
+		}, nil
+	}
+
+	return nil, errors.New(fmt.Sprintf("SOT '%s' doesn't exist", name))
+}
+
+// Returns the name of the SOT configured for a stack
+func Name(stackConfig *kapp.StackConfig) string {
+	if stackConfig.Sot == "" {
+		return HELM
+	}
+
+	return stackConfig.Sot
+}
+
+// Refreshes a SOT's view of the target cluster
+func Refresh(s Sot) error {
+	return s.refresh()
+}
+
+// Returns whether sugarkube manages a kapp. Unmanaged kapps must never be
+// installed or destroyed.
+func IsManaged(s Sot, fullyQualifiedId string) bool {
+	return s.isManaged(fullyQualifiedId)
+}
+
+// Returns the version of a managed kapp installed in the target cluster, and
+// whether it's installed at all
+func InstalledVersion(s Sot, fullyQualifiedId string) (string, bool, error) {
+	if !s.isManaged(fullyQualifiedId) {
+		return "", false, errors.New(fmt.Sprintf("Kapp '%s' isn't managed by "+
+			"sugarkube", fullyQualifiedId))
+	}
+
+	return s.installedVersion(fullyQualifiedId)
+}
+
+// Fully qualified IDs of kapps sugarkube must leave alone. SOTs embed this.
+type unmanagedKapps map[string]bool
+
+func (u unmanagedKapps) isManaged(fullyQualifiedId string) bool {
+	return !u[fullyQualifiedId]
 }
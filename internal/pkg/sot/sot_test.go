@@ -0,0 +1,133 @@
+package sot
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/sugarkube/sugarkube/internal/pkg/kapp"
+	"testing"
+)
+
+func TestNewSotUnmanaged(t *testing.T) {
+	stackConfig, err := kapp.LoadStackConfig("large", "../../testdata/stacks.yaml")
+	assert.Nil(t, err)
+
+	stackConfig.Ignored = []string{"exampleManifest2:kappB"}
+
+	sotImpl, err := NewSot(HELM, stackConfig, nil)
+	assert.Nil(t, err)
+
+	assert.True(t, IsManaged(sotImpl, "manifest1:kappA"))
+	assert.False(t, IsManaged(sotImpl, "exampleManifest2:kappB"))
+
+	_, _, err = InstalledVersion(sotImpl, "exampleManifest2:kappB")
+	assert.Error(t, err)
+}
+
+func TestNewSotNonExistent(t *testing.T) {
+	stackConfig := &kapp.StackConfig{}
+	_, err := NewSot("nonexistent", stackConfig, nil)
+	assert.Error(t, err)
+}
+
+func TestParseHelmList(t *testing.T) {
+	tests := []struct {
+		name         string
+		desc         string
+		input        string
+		expected     map[string]string
+		expectedNext string
+	}{
+		{
+			name:     "good_empty",
+			desc:     "helm prints nothing when there are no releases",
+			input:    "",
+			expected: map[string]string{},
+		},
+		{
+			name: "good",
+			desc: "releases should be keyed by namespace and name",
+			input: `{"Next":"","Releases":[
+{"Name":"wordpress","Revision":2,"Status":"DEPLOYED","Chart":"wordpress-0.1.0","Namespace":"wordpress"},
+{"Name":"jenkins","Revision":1,"Status":"FAILED","Chart":"jenkins-0.2.0","Namespace":"ci"}]}`,
+			expected: map[string]string{
+				"wordpress/wordpress": "wordpress-0.1.0",
+				"ci/jenkins":          "jenkins-0.2.0",
+			},
+		},
+		{
+			name: "good_truncated",
+			desc: "the offset of the next page should be returned",
+			input: `{"Next":"jenkins","Releases":[
+{"Name":"wordpress","Revision":2,"Status":"DEPLOYED","Chart":"wordpress-0.1.0","Namespace":"wordpress"}]}`,
+			expected: map[string]string{
+				"wordpress/wordpress": "wordpress-0.1.0",
+			},
+			expectedNext: "jenkins",
+		},
+	}
+
+	for _, test := range tests {
+		actual, next, err := parseHelmList([]byte(test.input))
+		assert.Nil(t, err)
+		assert.Equal(t, test.expected, actual, "unexpected result for %s", test.name)
+		assert.Equal(t, test.expectedNext, next, "unexpected next page for %s", test.name)
+	}
+}
+
+func TestRefreshPages(t *testing.T) {
+	pages := map[string]string{
+		"": `{"Next":"jenkins","Releases":[
+{"Name":"wordpress","Chart":"wordpress-0.1.0","Namespace":"wordpress"}]}`,
+		"jenkins": `{"Next":"","Releases":[
+{"Name":"jenkins","Chart":"jenkins-0.2.0","Namespace":"jenkins"}]}`,
+	}
+
+	offsets := make([]string, 0)
+	sotImpl := &HelmSot{
+		unmanagedKapps: unmanagedKapps{},
+		list: func(offset string) ([]byte, error) {
+			offsets = append(offsets, offset)
+			return []byte(pages[offset]), nil
+		},
+	}
+
+	err := Refresh(sotImpl)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"", "jenkins"}, offsets, "every page should be listed")
+
+	_, installed, err := InstalledVersion(sotImpl, "ci:jenkins")
+	assert.Nil(t, err)
+	assert.True(t, installed, "releases on later pages should be reported")
+
+	// helm returning the same page again mustn't loop forever
+	pages["jenkins"] = pages[""]
+	sotImpl.list = func(offset string) ([]byte, error) {
+		return []byte(pages["jenkins"]), nil
+	}
+	assert.Error(t, Refresh(sotImpl))
+}
+
+func TestInstalledVersion(t *testing.T) {
+	sotImpl := &HelmSot{
+		unmanagedKapps: unmanagedKapps{},
+		namespaces:     map[string]string{"web:blog": "blogs"},
+		releases: map[string]string{
+			"wordpress/wordpress": "wordpress-0.1.0",
+			"blogs/blog":          "wordpress-0.2.0",
+			"other/jenkins":       "jenkins-0.1.0",
+		},
+	}
+
+	version, installed, err := InstalledVersion(sotImpl, "web:wordpress")
+	assert.Nil(t, err)
+	assert.True(t, installed)
+	assert.Equal(t, "wordpress-0.1.0", version)
+
+	version, installed, err = InstalledVersion(sotImpl, "web:blog")
+	assert.Nil(t, err)
+	assert.True(t, installed, "releases should be found in the kapp's namespace")
+	assert.Equal(t, "wordpress-0.2.0", version)
+
+	_, installed, err = InstalledVersion(sotImpl, "ci:jenkins")
+	assert.Nil(t, err)
+	assert.False(t, installed, "releases in other namespaces shouldn't match")
+}